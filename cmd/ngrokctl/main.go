@@ -1,16 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"text/tabwriter"
-)
-
-const (
-	healthEndpoint = "http://127.0.0.1:8081"
+	"time"
 )
 
 type Command struct {
@@ -29,6 +30,41 @@ type StatusData struct {
 	OperatorID      string `json:"operator_id"`
 	EndpointCount   int    `json:"endpoint_count"`
 	IngressEndpoint string `json:"ingress_endpoint"`
+	ConfiguredIngress string `json:"configured_ingress,omitempty"`
+	RegisteredIngress string `json:"registered_ingress,omitempty"`
+	IngressMismatch   bool   `json:"ingress_mismatch,omitempty"`
+	IngressTLSVerify  string `json:"ingress_tls_verify,omitempty"`
+	IngressPins       int    `json:"ingress_pins,omitempty"`
+	Ingresses       []IngressStatus `json:"ingresses,omitempty"`
+	API             *APIStatus `json:"api,omitempty"`
+	CertExpiry      time.Time  `json:"cert_expiry,omitempty"`
+}
+
+type IngressStatus struct {
+	Address   string    `json:"address"`
+	Healthy   bool      `json:"healthy"`
+	Probed    bool      `json:"probed"`
+	Preferred bool      `json:"preferred"`
+	Latency   string    `json:"latency,omitempty"`
+	LastProbe time.Time `json:"last_probe,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type APIStatus struct {
+	Healthy             bool       `json:"healthy"`
+	Circuit             string     `json:"circuit"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorCode       string     `json:"last_error_code,omitempty"`
+	PollInterval        string     `json:"poll_interval"`
+	NextPoll            *time.Time `json:"next_poll,omitempty"`
+}
+
+type HealthEndpoint struct {
+	Enabled      bool   `json:"enabled"`
+	URL          string `json:"url,omitempty"`
+	AuthRequired bool   `json:"auth_required"`
+	Certificate  string `json:"certificate,omitempty"`
 }
 
 type EndpointInfo struct {
@@ -40,6 +76,74 @@ type EndpointInfo struct {
 	LocalListener   bool   `json:"local_listener"`
 	NetworkPort     int    `json:"network_port"`
 	ListenInterface string `json:"listen_interface"`
+	Degraded        bool   `json:"degraded"`
+	Errors          int64  `json:"errors"`
+	LastErrorClass  string `json:"last_error_class,omitempty"`
+	LastErrorCode   string `json:"last_error_code,omitempty"`
+	LastError       string `json:"last_error,omitempty"`
+	Probe           *ProbeInfo `json:"probe,omitempty"`
+}
+
+type ProbeInfo struct {
+	OK                  bool      `json:"ok"`
+	Time                time.Time `json:"time"`
+	Latency             string    `json:"latency"`
+	StatusCode          int       `json:"status_code,omitempty"`
+	ErrorClass          string    `json:"error_class,omitempty"`
+	ErrorCode           string    `json:"error_code,omitempty"`
+	Error               string    `json:"error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+type ConnectionsData struct {
+	Endpoints []EndpointTraffic `json:"endpoints"`
+	Recent    []ConnectionInfo  `json:"recent"`
+}
+
+type EndpointTraffic struct {
+	ID                string  `json:"id"`
+	URL               string  `json:"url"`
+	Active            int64   `json:"active"`
+	Connections       int64   `json:"connections"`
+	BytesIn           int64   `json:"bytes_in"`
+	BytesOut          int64   `json:"bytes_out"`
+	ConnectionSeconds float64 `json:"connection_seconds"`
+}
+
+type ConnectionInfo struct {
+	EndpointID  string    `json:"endpoint_id"`
+	URL         string    `json:"url"`
+	ClientAddr  string    `json:"client_addr"`
+	Start       time.Time `json:"start"`
+	Duration    string    `json:"duration"`
+	BytesIn     int64     `json:"bytes_in"`
+	BytesOut    int64     `json:"bytes_out"`
+	CloseReason string    `json:"close_reason"`
+}
+
+type PlanData struct {
+	Changes   []PlannedChange `json:"changes"`
+	Unchanged int             `json:"unchanged"`
+}
+
+type PlannedChange struct {
+	Action        string        `json:"action"`
+	EndpointID    string        `json:"endpoint_id"`
+	URL           string        `json:"url"`
+	Hostname      string        `json:"hostname"`
+	IP            string        `json:"ip,omitempty"`
+	Port          int           `json:"port"`
+	ListenAddress string        `json:"listen_address,omitempty"`
+	ListenPort    int           `json:"listen_port,omitempty"`
+	Mode          string        `json:"mode"`
+	Changes       []FieldChange `json:"changes,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
 }
 
 func main() {
@@ -57,6 +161,14 @@ func main() {
 		cmdList()
 	case "health":
 		cmdHealth()
+	case "plan":
+		cmdPlan()
+	case "connections":
+		var endpoint string
+		if len(os.Args) > 2 {
+			endpoint = os.Args[2]
+		}
+		cmdConnections(endpoint)
 	case "set-api-key":
 		if len(os.Args) < 3 {
 			fmt.Println("Error: API key required")
@@ -89,12 +201,15 @@ func printUsage() {
 	fmt.Println("  status              Show daemon status")
 	fmt.Println("  list                List discovered bound endpoints")
 	fmt.Println("  health              Check daemon health")
+	fmt.Println("  plan                Show changes the next poll would make (dry run)")
+	fmt.Println("  connections [EP]    Show traffic per endpoint and recent connections")
 	fmt.Println("  set-api-key <KEY>   Set ngrok API key")
 	fmt.Println("  config edit         Open config file in editor")
 	fmt.Println("  help                Show this help message")
 	fmt.Println()
 	fmt.Println("Environment:")
 	fmt.Println("  NGROKD_SOCKET       Unix socket path (default: /var/run/ngrokd.sock)")
+	fmt.Println("  NGROKD_HEALTH_TOKEN Bearer token for the health server, if it requires one")
 }
 
 func getSocketPath() string {
@@ -160,6 +275,64 @@ func cmdStatus() {
 	
 	fmt.Printf("  Endpoints:           %d\n", status.EndpointCount)
 	fmt.Printf("  Ingress:             %s\n", status.IngressEndpoint)
+	switch status.IngressTLSVerify {
+	case "":
+	case "insecure":
+		fmt.Printf("  ⚠ Ingress TLS:       insecure (server certificate not verified)\n")
+	case "ca":
+		verify := "ca, fails open (verification failures are only logged)"
+		if status.IngressPins > 0 {
+			verify += fmt.Sprintf(", %d pinned keys", status.IngressPins)
+		}
+		fmt.Printf("  ⚠ Ingress TLS:       %s\n", verify)
+	default:
+		verify := status.IngressTLSVerify + ", fails closed"
+		if status.IngressPins > 0 {
+			verify += fmt.Sprintf(", %d pinned keys", status.IngressPins)
+		}
+		fmt.Printf("  Ingress TLS:         %s\n", verify)
+	}
+	if status.IngressMismatch {
+		fmt.Printf("  ⚠ Ingress mismatch:  configured %s, registered with %s\n",
+			status.ConfiguredIngress, status.RegisteredIngress)
+		fmt.Printf("                       Connections may fail with 'failed to read header length';\n")
+		fmt.Printf("                       remove ingressEndpoint from the config to use the registered one\n")
+	}
+	if len(status.Ingresses) > 1 || (len(status.Ingresses) == 1 && !status.Ingresses[0].Healthy) {
+		for _, ing := range status.Ingresses {
+			printIngress(ing)
+		}
+	}
+	
+	if !status.CertExpiry.IsZero() {
+		remaining := time.Until(status.CertExpiry)
+		if remaining <= 0 {
+			fmt.Printf("  ❌ Certificate:       Expired %s\n", status.CertExpiry.Format(time.RFC3339))
+		} else {
+			fmt.Printf("  Certificate:         Expires %s (in %s)\n",
+				status.CertExpiry.Format(time.RFC3339), remaining.Round(time.Hour))
+		}
+	}
+	
+	if api := status.API; api != nil && status.Registered {
+		if api.Healthy {
+			fmt.Printf("  ✓ ngrok API:         %s\n", "Healthy")
+		} else {
+			fmt.Printf("  ⚠ ngrok API:         Unhealthy (circuit %s, %d consecutive failures)\n",
+				api.Circuit, api.ConsecutiveFailures)
+			if api.LastErrorCode != "" {
+				fmt.Printf("  Last API Error:      [%s] %s\n", api.LastErrorCode, api.LastError)
+			} else if api.LastError != "" {
+				fmt.Printf("  Last API Error:      %s\n", api.LastError)
+			}
+			if api.NextPoll != nil {
+				fmt.Printf("  Next Poll:           in %s\n", time.Until(*api.NextPoll).Round(time.Second))
+			}
+		}
+		if api.PollInterval != "" {
+			fmt.Printf("  Poll Interval:       %s\n", api.PollInterval)
+		}
+	}
 	fmt.Println()
 	
 	if status.EndpointCount == 0 {
@@ -168,6 +341,33 @@ func cmdStatus() {
 	}
 }
 
+// printIngress prints one ingress endpoint's health under the status summary
+func printIngress(ing IngressStatus) {
+	marker := "✓"
+	state := "healthy"
+	switch {
+	case !ing.Healthy:
+		marker = "❌"
+		state = "unhealthy"
+	case !ing.Probed:
+		marker = "…"
+		state = "not probed yet"
+	}
+	
+	line := fmt.Sprintf("    %s %-40s %s", marker, ing.Address, state)
+	if ing.Latency != "" && ing.Healthy {
+		line += fmt.Sprintf(", %s", ing.Latency)
+	}
+	if ing.Preferred {
+		line += " (preferred)"
+	}
+	fmt.Println(line)
+	
+	if ing.LastError != "" {
+		fmt.Printf("        Last error: %s\n", ing.LastError)
+	}
+}
+
 func cmdList() {
 	resp, err := sendCommand(Command{Command: "list"})
 	if err != nil {
@@ -199,15 +399,32 @@ func cmdList() {
 		return
 	}
 
+	// Only show the probe column if the prober is enabled
+	probed := false
+	for _, ep := range endpoints {
+		if ep.Probe != nil {
+			probed = true
+		}
+	}
+
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "  URL\tLISTEN ADDRESS\tMODE\tSTATUS")
-	fmt.Fprintln(w, "  ---\t--------------\t----\t------")
+	if probed {
+		fmt.Fprintln(w, "  URL\tLISTEN ADDRESS\tMODE\tSTATUS\tPROBE")
+		fmt.Fprintln(w, "  ---\t--------------\t----\t------\t-----")
+	} else {
+		fmt.Fprintln(w, "  URL\tLISTEN ADDRESS\tMODE\tSTATUS")
+		fmt.Fprintln(w, "  ---\t--------------\t----\t------")
+	}
 	
 	for _, ep := range endpoints {
 		// Determine status
 		status := "✓"
 		if !ep.LocalListener {
 			status = "❌"
+		} else if ep.Probe != nil && !ep.Probe.OK {
+			status = "❌ probe failing"
+		} else if ep.Degraded {
+			status = "⚠️  degraded"
 		}
 		
 		// Format listen address
@@ -222,22 +439,273 @@ func cmdList() {
 			mode = "virtual"
 		}
 		
-		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", 
-			ep.URL, listenAddr, mode, status)
+		if probed {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n",
+				ep.URL, listenAddr, mode, status, formatProbe(ep.Probe))
+		} else {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", 
+				ep.URL, listenAddr, mode, status)
+		}
 	}
 	w.Flush()
 	
+	// Explain failing probes and degraded endpoints
+	for _, ep := range endpoints {
+		if ep.Probe == nil || ep.Probe.OK {
+			continue
+		}
+		reason := ep.Probe.Error
+		if ep.Probe.ErrorCode != "" {
+			reason = fmt.Sprintf("[%s] %s", ep.Probe.ErrorCode, ep.Probe.Error)
+		}
+		fmt.Println()
+		fmt.Printf("  ❌ %s: probe failed %d time(s) in a row: %s\n", ep.URL, ep.Probe.ConsecutiveFailures, reason)
+	}
+	for _, ep := range endpoints {
+		if !ep.Degraded {
+			continue
+		}
+		reason := ep.LastError
+		if ep.LastErrorCode != "" {
+			reason = fmt.Sprintf("[%s] %s", ep.LastErrorCode, ep.LastError)
+		}
+		fmt.Println()
+		fmt.Printf("  ⚠️  %s: %s failure: %s\n", ep.URL, ep.LastErrorClass, reason)
+	}
+	
 	fmt.Println()
 	fmt.Printf("  Total: %d endpoint(s)\n", len(endpoints))
 	fmt.Println()
 }
 
+// formatProbe summarizes a probe result for the list table
+func formatProbe(probe *ProbeInfo) string {
+	if probe == nil {
+		return "-"
+	}
+	result := "✓"
+	if !probe.OK {
+		result = "❌"
+	}
+	if probe.StatusCode != 0 {
+		result += fmt.Sprintf(" %d", probe.StatusCode)
+	}
+	return fmt.Sprintf("%s %s", result, probe.Latency)
+}
+
+// recentShown is how many recent connections cmdConnections prints
+const recentShown = 20
+
+func cmdConnections(endpoint string) {
+	cmd := Command{Command: "connections"}
+	if endpoint != "" {
+		cmd.Args = []string{endpoint}
+	}
+	resp, err := sendCommand(cmd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !resp.Success {
+		fmt.Printf("Error: %s\n", resp.Error)
+		os.Exit(1)
+	}
+
+	var data ConnectionsData
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		fmt.Printf("Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("╔═══════════════════════════════════════════════════════╗")
+	fmt.Println("║            Forwarded Connections                      ║")
+	fmt.Println("╚═══════════════════════════════════════════════════════╝")
+	fmt.Println()
+
+	if len(data.Endpoints) == 0 {
+		if endpoint != "" {
+			fmt.Printf("  No endpoint with ID or URL %s.\n", endpoint)
+		} else {
+			fmt.Println("  No endpoints bound.")
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  URL\tACTIVE\tCONNECTIONS\tIN\tOUT\tTIME")
+	fmt.Fprintln(w, "  ---\t------\t-----------\t--\t---\t----")
+	for _, ep := range data.Endpoints {
+		fmt.Fprintf(w, "  %s\t%d\t%d\t%s\t%s\t%s\n",
+			ep.URL, ep.Active, ep.Connections,
+			formatBytes(ep.BytesIn), formatBytes(ep.BytesOut),
+			time.Duration(ep.ConnectionSeconds*float64(time.Second)).Round(time.Second))
+	}
+	w.Flush()
+	fmt.Println()
+
+	if len(data.Recent) == 0 {
+		fmt.Println("  No finished connections yet.")
+		fmt.Println()
+		return
+	}
+
+	recent := data.Recent
+	if len(recent) > recentShown {
+		fmt.Printf("  Recent connections (newest %d of %d):\n", recentShown, len(recent))
+		recent = recent[:recentShown]
+	} else {
+		fmt.Println("  Recent connections (newest first):")
+	}
+	fmt.Println()
+
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  START\tURL\tCLIENT\tDURATION\tIN\tOUT\tCLOSE")
+	fmt.Fprintln(w, "  -----\t---\t------\t--------\t--\t---\t-----")
+	for _, conn := range recent {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			conn.Start.Local().Format("15:04:05"), conn.URL, conn.ClientAddr, conn.Duration,
+			formatBytes(conn.BytesIn), formatBytes(conn.BytesOut), conn.CloseReason)
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func cmdPlan() {
+	resp, err := sendCommand(Command{Command: "plan"})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !resp.Success {
+		fmt.Printf("Error: %s\n", resp.Error)
+		os.Exit(1)
+	}
+
+	var plan PlanData
+	if err := json.Unmarshal(resp.Data, &plan); err != nil {
+		fmt.Printf("Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("╔═══════════════════════════════════════════════════════╗")
+	fmt.Println("║            Reconciliation Plan (dry run)              ║")
+	fmt.Println("╚═══════════════════════════════════════════════════════╝")
+	fmt.Println()
+
+	if len(plan.Changes) == 0 {
+		fmt.Printf("  No changes. %d endpoint(s) up to date.\n", plan.Unchanged)
+		fmt.Println()
+		return
+	}
+
+	markers := map[string]string{"add": "+", "update": "~", "remove": "-"}
+	counts := map[string]int{}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "    URL\tLISTEN ADDRESS\tMODE\tIP")
+	fmt.Fprintln(w, "    ---\t--------------\t----\t--")
+
+	for _, c := range plan.Changes {
+		counts[c.Action]++
+
+		listenAddr := "-"
+		if c.ListenAddress != "" {
+			listenAddr = fmt.Sprintf("%s:%d", c.ListenAddress, c.ListenPort)
+		}
+
+		fmt.Fprintf(w, "  %s %s\t%s\t%s\t%s\n",
+			markers[c.Action], c.URL, listenAddr, c.Mode, c.IP)
+
+		for _, f := range c.Changes {
+			fmt.Fprintf(w, "      %s: %s → %s\t\t\t\n", f.Field, f.Old, f.New)
+		}
+		if c.Error != "" {
+			fmt.Fprintf(w, "      ❌ %s\t\t\t\n", c.Error)
+		}
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Printf("  Plan: %d to add, %d to update, %d to remove, %d unchanged\n",
+		counts["add"], counts["update"], counts["remove"], plan.Unchanged)
+	fmt.Println()
+}
+
+// healthGet fetches a path from the daemon's health server, whose address
+// and certificate are discovered through the control socket. The bearer
+// token, if the server requires one, comes from NGROKD_HEALTH_TOKEN.
+func healthGet(path string) (*http.Response, error) {
+	resp, err := sendCommand(Command{Command: "health-endpoint"})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+
+	var endpoint HealthEndpoint
+	if err := json.Unmarshal(resp.Data, &endpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse health endpoint: %w", err)
+	}
+	if !endpoint.Enabled {
+		return nil, fmt.Errorf("the health server is disabled (health.enabled: false)")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	if endpoint.Certificate != "" {
+		// Trust exactly the certificate the daemon reported, whatever it was issued for
+		block, _ := pem.Decode([]byte(endpoint.Certificate))
+		if block == nil {
+			return nil, fmt.Errorf("daemon reported an invalid health server certificate")
+		}
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+					if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], block.Bytes) {
+						return fmt.Errorf("health server certificate doesn't match the one reported by the daemon")
+					}
+					return nil
+				},
+			},
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.AuthRequired {
+		token := os.Getenv("NGROKD_HEALTH_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("the health server requires a bearer token; set NGROKD_HEALTH_TOKEN to health.bearer_token")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return client.Do(req)
+}
+
 func cmdHealth() {
 	// Check health endpoint
-	resp, err := http.Get(healthEndpoint + "/status")
+	resp, err := healthGet("/status")
 	if err != nil {
 		fmt.Printf("Error: Failed to connect to health endpoint: %v\n", err)
-		fmt.Println("\nIs ngrokd running?")
 		os.Exit(1)
 	}
 	defer resp.Body.Close()
@@ -9,7 +9,7 @@ api:
   url: https://api.ngrok.com
   key: ""
 
-ingressEndpoint: "kubernetes-binding-ingress.ngrok.io:443"
+# ingressEndpoint: "kubernetes-binding-ingress.ngrok.io:443"  # Optional: overrides the registered ingress
 
 server:
   log_level: info
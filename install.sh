@@ -143,7 +143,7 @@ api:
   url: https://api.ngrok.com
   key: ""  # Set via: ngrokctl set-api-key YOUR_KEY
 
-ingressEndpoint: "kubernetes-binding-ingress.ngrok.io:443"
+# ingressEndpoint: "kubernetes-binding-ingress.ngrok.io:443"  # Optional: overrides the registered ingress
 
 server:
   log_level: info
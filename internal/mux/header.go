@@ -64,6 +64,16 @@ func (e *BindingUpgradeFailure) Error() string {
 	return fmt.Sprintf("binding upgrade failure: [%s]: %s", e.resp.ErrorCode, e.resp.ErrorMessage)
 }
 
+// ErrorCode returns the ngrok error code the server rejected the upgrade with
+func (e *BindingUpgradeFailure) ErrorCode() string {
+	return e.resp.ErrorCode
+}
+
+// ErrorMessage returns the server's explanation for rejecting the upgrade
+func (e *BindingUpgradeFailure) ErrorMessage() string {
+	return e.resp.ErrorMessage
+}
+
 // UpgradeToBindingConnection upgrades a connection to a binding connection by exchanging header information
 // with the server. It may return a BindingUpgradeFailure error if the server can't upgrade the connection. The
 // underlying connection may also return an error if the connection is closed or otherwise fails.
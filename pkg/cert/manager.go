@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
@@ -17,15 +18,19 @@ type Manager struct {
 	apiClient   *ngrokapi.Client
 	logger      logr.Logger
 	operatorID  string
+
+	// ingressEndpoint is the ingress named by the binding at registration
+	ingressEndpoint string
 }
 
 // Config holds the configuration for the certificate manager
 type Config struct {
 	CertDir     string
-	APIKey      string
+	APIClient   *ngrokapi.Client
 	Description string
 	Metadata    string
 	Region      string
+	Selectors   []string // Endpoint selectors for the operator binding
 	Logger      logr.Logger
 }
 
@@ -35,11 +40,15 @@ func NewManager(config Config) *Manager {
 		config.CertDir = filepath.Join(os.Getenv("HOME"), ".ngrok-forward-proxy", "certs")
 	}
 
-	return &Manager{
+	m := &Manager{
 		provisioner: NewProvisioner(config.CertDir),
-		apiClient:   ngrokapi.NewClient(config.APIKey),
+		apiClient:   config.APIClient,
 		logger:      config.Logger,
 	}
+	m.loadOperatorID()
+	m.loadIngressEndpoint()
+
+	return m
 }
 
 // EnsureCertificate ensures a valid certificate exists, provisioning one if necessary
@@ -53,6 +62,13 @@ func (m *Manager) EnsureCertificate(ctx context.Context, config Config) (tls.Cer
 		cert, err := m.provisioner.LoadCertificate()
 		if err != nil {
 			m.logger.Info("Failed to load existing certificate, will provision new one", "error", err)
+		} else if leaf, err := leafCertificate(cert); err == nil && time.Now().After(leaf.NotAfter) {
+			// Expired - re-issue against the existing operator if we have one
+			m.logger.Info("Existing certificate has expired", "notAfter", leaf.NotAfter)
+			m.loadOperatorID()
+			if m.operatorID != "" {
+				return m.RenewCertificate(ctx)
+			}
 		} else {
 			// Load operator ID from file if it exists
 			m.loadOperatorID()
@@ -100,7 +116,8 @@ func (m *Manager) provisionCertificate(ctx context.Context, config Config) (tls.
 		EnabledFeatures: []string{"bindings"},
 		Region:          region,
 		Binding: &ngrokapi.KubernetesOperatorBindingCreate{
-			CSR: string(csrPEM),
+			EndpointSelectors: config.Selectors,
+			CSR:               string(csrPEM),
 		},
 	}
 
@@ -114,6 +131,7 @@ func (m *Manager) provisionCertificate(ctx context.Context, config Config) (tls.
 	ingressEp := "not provided"
 	if operator.Binding != nil && operator.Binding.IngressEndpoint != "" {
 		ingressEp = operator.Binding.IngressEndpoint
+		m.ingressEndpoint = operator.Binding.IngressEndpoint
 	}
 	
 	m.logger.Info("Successfully registered with ngrok",
@@ -145,6 +163,11 @@ func (m *Manager) provisionCertificate(ctx context.Context, config Config) (tls.
 	if err := m.saveOperatorID(); err != nil {
 		m.logger.Info("Failed to save operator ID", "error", err)
 	}
+	if m.ingressEndpoint != "" {
+		if err := m.saveIngressEndpoint(); err != nil {
+			m.logger.Info("Failed to save ingress endpoint", "error", err)
+		}
+	}
 
 	// Step 5: Load and return certificate
 	cert, err := tls.X509KeyPair(certPEM, privateKeyPEM)
@@ -168,11 +191,40 @@ func (m *Manager) loadOperatorID() {
 	}
 }
 
+func (m *Manager) saveIngressEndpoint() error {
+	path := filepath.Join(m.provisioner.certDir, "ingress_endpoint")
+	return os.WriteFile(path, []byte(m.ingressEndpoint), 0644)
+}
+
+func (m *Manager) loadIngressEndpoint() {
+	path := filepath.Join(m.provisioner.certDir, "ingress_endpoint")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		m.ingressEndpoint = string(data)
+	}
+}
+
 // GetOperatorID returns the operator ID (if registered)
 func (m *Manager) GetOperatorID() string {
 	return m.operatorID
 }
 
+// RegisteredIngressEndpoint returns the ingress endpoint the binding named
+// at registration, or "" if it didn't name one
+func (m *Manager) RegisteredIngressEndpoint() string {
+	return m.ingressEndpoint
+}
+
+// SetRegisteredIngressEndpoint records a changed binding ingress endpoint
+// and saves it next to the operator ID
+func (m *Manager) SetRegisteredIngressEndpoint(endpoint string) error {
+	if endpoint == m.ingressEndpoint {
+		return nil
+	}
+	m.ingressEndpoint = endpoint
+	return m.saveIngressEndpoint()
+}
+
 // GetIngressEndpoint returns the ingress endpoint for the operator
 func (m *Manager) GetIngressEndpoint(ctx context.Context) (string, error) {
 	if m.operatorID == "" {
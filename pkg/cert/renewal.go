@@ -0,0 +1,154 @@
+package cert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
+)
+
+const (
+	// DefaultRenewFraction renews once two thirds of the lifetime has elapsed
+	DefaultRenewFraction = 0.66
+
+	// renewRetryInterval is the wait between failed renewal attempts
+	renewRetryInterval = 5 * time.Minute
+
+	// renewCheckInterval caps the wait between checks so clock jumps
+	// (e.g. suspend/resume) and certs replaced on disk are noticed
+	renewCheckInterval = time.Hour
+)
+
+// RenewCertificate re-issues the binding certificate for the registered
+// operator using a freshly generated key and CSR, and saves it to disk
+func (m *Manager) RenewCertificate(ctx context.Context) (tls.Certificate, error) {
+	if m.operatorID == "" {
+		return tls.Certificate{}, fmt.Errorf("operator not registered")
+	}
+
+	m.logger.Info("Renewing binding certificate", "operatorID", m.operatorID)
+
+	privateKeyPEM, csrPEM, err := m.provisioner.GenerateKeyAndCSR()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate key and CSR: %w", err)
+	}
+
+	operator, err := m.apiClient.UpdateKubernetesOperator(ctx, m.operatorID, &ngrokapi.KubernetesOperatorUpdate{
+		Binding: &ngrokapi.KubernetesOperatorBindingUpdate{
+			CSR: string(csrPEM),
+		},
+	})
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to re-issue certificate: %w", err)
+	}
+
+	if operator.Binding == nil || operator.Binding.Cert.Cert == "" {
+		return tls.Certificate{}, fmt.Errorf("no certificate returned in API response")
+	}
+
+	certPEM := []byte(operator.Binding.Cert.Cert)
+
+	// Validate the pair before it replaces the one on disk
+	cert, err := tls.X509KeyPair(certPEM, privateKeyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	if err := m.provisioner.SaveCertificate(privateKeyPEM, certPEM); err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to save certificate: %w", err)
+	}
+
+	m.logger.Info("Binding certificate renewed",
+		"notBefore", operator.Binding.Cert.NotBefore,
+		"notAfter", operator.Binding.Cert.NotAfter)
+
+	return cert, nil
+}
+
+// RunRenewal renews the certificate on disk once fraction of its lifetime
+// has elapsed, calling onRenew with every new certificate. It blocks until
+// ctx is done.
+func (m *Manager) RunRenewal(ctx context.Context, fraction float64, onRenew func(tls.Certificate)) {
+	if fraction <= 0 || fraction >= 1 {
+		fraction = DefaultRenewFraction
+	}
+
+	var scheduled time.Time
+
+	for {
+		wait := renewRetryInterval
+
+		cert, err := m.provisioner.LoadCertificate()
+		if err != nil {
+			m.logger.Error(err, "Failed to load certificate for renewal check")
+		} else if leaf, err := leafCertificate(cert); err != nil {
+			m.logger.Error(err, "Failed to parse certificate for renewal check")
+		} else {
+			renewAt := renewalTime(leaf, fraction)
+
+			if time.Now().Before(renewAt) {
+				wait = min(time.Until(renewAt), renewCheckInterval)
+				if !renewAt.Equal(scheduled) {
+					scheduled = renewAt
+					m.logger.Info("Next certificate renewal scheduled",
+						"notAfter", leaf.NotAfter,
+						"renewAt", renewAt)
+				}
+			} else if newCert, err := m.RenewCertificate(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				m.logger.Error(err, "⚠️  Certificate renewal failed, will retry",
+					"notAfter", leaf.NotAfter,
+					"retryIn", renewRetryInterval.String())
+			} else {
+				onRenew(newCert)
+				continue
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// CertificateExpiry returns the NotAfter time of the certificate on disk
+func (m *Manager) CertificateExpiry() (time.Time, error) {
+	cert, err := m.provisioner.LoadCertificate()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	leaf, err := leafCertificate(cert)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return leaf.NotAfter, nil
+}
+
+// renewalTime returns the point at which fraction of the certificate's
+// lifetime has elapsed
+func renewalTime(leaf *x509.Certificate, fraction float64) time.Time {
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return leaf.NotBefore.Add(time.Duration(float64(lifetime) * fraction))
+}
+
+// leafCertificate returns the parsed leaf of a key pair
+func leafCertificate(cert tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("no certificate in key pair")
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
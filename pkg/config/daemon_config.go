@@ -7,19 +7,36 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultIngressEndpoint is dialed when neither the config nor the
+// registration names an ingress endpoint
+const DefaultIngressEndpoint = "kubernetes-binding-ingress.ngrok.io:443"
+
 // DaemonConfig represents the ngrokd daemon configuration
 type DaemonConfig struct {
 	API             APIConfig             `yaml:"api"`
-	IngressEndpoint string                `yaml:"ingressEndpoint,omitempty"`
+	IngressEndpoint string                `yaml:"ingressEndpoint,omitempty"` // Overrides the ingress from registration
+	Ingress         IngressConfig         `yaml:"ingress"`
 	Server          ServerConfig          `yaml:"server"`
+	Health          HealthConfig          `yaml:"health"`
 	BoundEndpoints  BoundEndpointsConfig  `yaml:"bound_endpoints"`
 	Net             NetConfig             `yaml:"net"`
+	DNS             DNSConfig             `yaml:"dns"`
+	Endpoints       EndpointsConfig       `yaml:"endpoints"`
+	Probe           ProbeConfig           `yaml:"probe"`
 }
 
 // APIConfig holds ngrok API settings
 type APIConfig struct {
-	URL string `yaml:"url,omitempty"`
-	Key string `yaml:"key,omitempty"`
+	URL       string `yaml:"url,omitempty"`
+	Key       string `yaml:"key,omitempty"`
+	Timeout   int    `yaml:"timeout,omitempty"`    // Request timeout in seconds
+	ProxyURL  string `yaml:"proxy_url,omitempty"`  // Optional HTTP(S) proxy for API calls
+	CABundle  string `yaml:"ca_bundle,omitempty"`  // Optional PEM bundle trusted for the API
+	UserAgent string `yaml:"user_agent,omitempty"`
+
+	// MaxRetries is how many times a failed API request is retried
+	// (429/5xx and network errors). Negative disables retries.
+	MaxRetries int `yaml:"max_retries,omitempty"`
 }
 
 // ServerConfig holds server settings
@@ -28,12 +45,41 @@ type ServerConfig struct {
 	SocketPath string `yaml:"socket_path,omitempty"`
 	ClientCert string `yaml:"client_cert,omitempty"`
 	ClientKey  string `yaml:"client_key,omitempty"`
+
+	// ShutdownTimeout is how long (in seconds) to drain in-flight
+	// connections on SIGINT/SIGTERM before force-closing them
+	ShutdownTimeout int `yaml:"shutdown_timeout,omitempty"`
+
+	// CertRenewFraction is the fraction of the binding certificate's
+	// lifetime after which it is renewed (0 < x < 1)
+	CertRenewFraction float64 `yaml:"cert_renew_fraction,omitempty"`
+}
+
+// HealthConfig holds settings for the health, status and metrics HTTP server
+type HealthConfig struct {
+	Enabled *bool  `yaml:"enabled,omitempty"` // Default: true
+	Address string `yaml:"address,omitempty"`
+	Port    int    `yaml:"port,omitempty"`
+
+	// TLSCert and TLSKey are PEM files; set both to serve HTTPS
+	TLSCert string `yaml:"tls_cert,omitempty"`
+	TLSKey  string `yaml:"tls_key,omitempty"`
+
+	// BearerToken, if set, is required on /status and /metrics
+	BearerToken string `yaml:"bearer_token,omitempty"`
+}
+
+// IsEnabled reports whether the health server should run
+func (h HealthConfig) IsEnabled() bool {
+	return h.Enabled == nil || *h.Enabled
 }
 
 // BoundEndpointsConfig holds bound endpoint settings
 type BoundEndpointsConfig struct {
 	PollInterval int      `yaml:"poll_interval,omitempty"`
 	Selectors    []string `yaml:"selectors,omitempty"`
+	PageSize     int      `yaml:"page_size,omitempty"` // Endpoints requested per API page
+	MaxPages     int      `yaml:"max_pages,omitempty"` // Safety cap on pages followed per poll
 }
 
 // NetConfig holds network interface settings
@@ -45,6 +91,94 @@ type NetConfig struct {
 	Overrides       map[string]string `yaml:"overrides,omitempty"`        // hostname -> listen_interface override
 }
 
+// IngressConfig holds settings for connections to the ngrok ingress
+type IngressConfig struct {
+	// Endpoints are additional host:port ingress endpoints to fail over
+	// to, alongside ingressEndpoint and the one named by the operator binding
+	Endpoints     []string `yaml:"endpoints,omitempty"`
+	DialTimeout   int      `yaml:"dial_timeout,omitempty"`   // Seconds before a dial fails over to the next endpoint
+	ProbeInterval int      `yaml:"probe_interval,omitempty"` // Seconds between health probes of each endpoint
+	PoolSize      int      `yaml:"pool_size,omitempty"`      // Idle pre-handshaked connections to keep; 0 disables the pool
+	PoolMaxIdle   int      `yaml:"pool_max_idle,omitempty"`  // Seconds a pooled connection may stay idle before it is replaced
+
+	// TLSVerify is "strict" (refuse on failure), "ca" (warn on failure)
+	// or "insecure" (don't verify). Defaults to strict.
+	TLSVerify string   `yaml:"tls_verify,omitempty"`
+	CABundle  string   `yaml:"ca_bundle,omitempty"` // PEM file or directory trusted for the ingress
+	Pins      []string `yaml:"pins,omitempty"`      // sha256/<base64> SPKI pins for the ingress chain
+}
+
+// DNSConfig holds local name resolution settings
+type DNSConfig struct {
+	// Mode selects how hostnames resolve: "hosts" writes /etc/hosts,
+	// "server" runs the embedded DNS server, "both" does both
+	Mode      string   `yaml:"mode,omitempty"`
+	Listen    string   `yaml:"listen,omitempty"`    // DNS server listen address (UDP and TCP)
+	TTL       int      `yaml:"ttl,omitempty"`       // TTL in seconds for managed records
+	Upstreams []string `yaml:"upstreams,omitempty"` // Resolvers for other names; empty refuses them
+}
+
+// EndpointsConfig holds per-endpoint forwarding settings
+type EndpointsConfig struct {
+	Defaults  EndpointConfig            `yaml:"defaults,omitempty"`
+	Overrides map[string]EndpointConfig `yaml:"overrides,omitempty"` // hostname -> settings
+}
+
+// EndpointConfig holds forwarding settings for one endpoint. Empty fields
+// fall back to the defaults.
+type EndpointConfig struct {
+	// ForwardedHeaders controls X-Forwarded-* and Forwarded headers on
+	// HTTP endpoints: "append", "replace" or "skip"
+	ForwardedHeaders string `yaml:"forwarded_headers,omitempty"`
+
+	// ProxyProtocol sends a PROXY protocol header on TCP endpoints: "v1",
+	// "v2", or "off" to disable it for an override
+	ProxyProtocol string `yaml:"proxy_protocol,omitempty"`
+
+	IdleTimeout int `yaml:"idle_timeout,omitempty"` // Seconds without traffic before a connection is closed; 0 or negative disables
+	MaxLifetime int `yaml:"max_lifetime,omitempty"` // Seconds before a connection is closed regardless of traffic; negative disables
+}
+
+// For returns the settings for a hostname with its override applied over the defaults
+func (c EndpointsConfig) For(hostname string) EndpointConfig {
+	result := c.Defaults
+	override, exists := c.Overrides[hostname]
+	if !exists {
+		return result
+	}
+	if override.ForwardedHeaders != "" {
+		result.ForwardedHeaders = override.ForwardedHeaders
+	}
+	if override.ProxyProtocol != "" {
+		result.ProxyProtocol = override.ProxyProtocol
+	}
+	if override.IdleTimeout != 0 {
+		result.IdleTimeout = override.IdleTimeout
+	}
+	if override.MaxLifetime != 0 {
+		result.MaxLifetime = override.MaxLifetime
+	}
+	return result
+}
+
+// ProbeConfig holds settings for synthetic probes of bound endpoints
+type ProbeConfig struct {
+	Enabled  bool `yaml:"enabled,omitempty"`
+	Interval int  `yaml:"interval,omitempty"` // Seconds between probes of each endpoint
+	Timeout  int  `yaml:"timeout,omitempty"`  // Seconds before a probe fails
+
+	// HTTP is the request sent to HTTP endpoints. Without a path, probes
+	// only check the binding upgrade.
+	HTTP ProbeHTTPConfig `yaml:"http,omitempty"`
+}
+
+// ProbeHTTPConfig is the request a probe sends to HTTP endpoints
+type ProbeHTTPConfig struct {
+	Method       string `yaml:"method,omitempty"`
+	Path         string `yaml:"path,omitempty"`
+	ExpectStatus []int  `yaml:"expect_status,omitempty"` // Accepted status codes; empty accepts any below 500
+}
+
 // LoadDaemonConfig loads daemon configuration from file
 func LoadDaemonConfig(path string) (*DaemonConfig, error) {
 	data, err := os.ReadFile(path)
@@ -68,8 +202,20 @@ func (c *DaemonConfig) setDefaults() {
 	if c.API.URL == "" {
 		c.API.URL = "https://api.ngrok.com"
 	}
-	if c.IngressEndpoint == "" {
-		c.IngressEndpoint = "kubernetes-binding-ingress.ngrok.io:443"
+	if c.API.Timeout == 0 {
+		c.API.Timeout = 30
+	}
+	if c.Ingress.DialTimeout == 0 {
+		c.Ingress.DialTimeout = 5
+	}
+	if c.Ingress.ProbeInterval == 0 {
+		c.Ingress.ProbeInterval = 30
+	}
+	if c.Ingress.TLSVerify == "" {
+		c.Ingress.TLSVerify = "strict"
+	}
+	if c.Ingress.PoolMaxIdle == 0 {
+		c.Ingress.PoolMaxIdle = 30
 	}
 	if c.Server.LogLevel == "" {
 		c.Server.LogLevel = "info"
@@ -83,9 +229,27 @@ func (c *DaemonConfig) setDefaults() {
 	if c.Server.ClientKey == "" {
 		c.Server.ClientKey = getDefaultKeyPath()
 	}
+	if c.Server.ShutdownTimeout == 0 {
+		c.Server.ShutdownTimeout = 30
+	}
+	if c.Server.CertRenewFraction == 0 {
+		c.Server.CertRenewFraction = 0.66
+	}
+	if c.Health.Address == "" {
+		c.Health.Address = "127.0.0.1"
+	}
+	if c.Health.Port == 0 {
+		c.Health.Port = 8081
+	}
 	if c.BoundEndpoints.PollInterval == 0 {
 		c.BoundEndpoints.PollInterval = 30
 	}
+	if c.BoundEndpoints.PageSize == 0 {
+		c.BoundEndpoints.PageSize = 100
+	}
+	if c.BoundEndpoints.MaxPages == 0 {
+		c.BoundEndpoints.MaxPages = 100
+	}
 	if len(c.BoundEndpoints.Selectors) == 0 {
 		c.BoundEndpoints.Selectors = []string{"true"}
 	}
@@ -101,4 +265,25 @@ func (c *DaemonConfig) setDefaults() {
 	if c.Net.StartPort == 0 {
 		c.Net.StartPort = 9080
 	}
+	if c.DNS.Mode == "" {
+		c.DNS.Mode = "hosts"
+	}
+	if c.DNS.Listen == "" {
+		c.DNS.Listen = "127.0.0.1:53"
+	}
+	if c.DNS.TTL == 0 {
+		c.DNS.TTL = 30
+	}
+	if c.Endpoints.Defaults.ForwardedHeaders == "" {
+		c.Endpoints.Defaults.ForwardedHeaders = "append"
+	}
+	if c.Probe.Interval == 0 {
+		c.Probe.Interval = 60
+	}
+	if c.Probe.Timeout == 0 {
+		c.Probe.Timeout = 10
+	}
+	if c.Probe.HTTP.Method == "" {
+		c.Probe.HTTP.Method = "GET"
+	}
 }
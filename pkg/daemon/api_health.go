@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/socket"
+)
+
+const (
+	// Consecutive poll failures before the circuit opens
+	breakerFailureThreshold = 3
+
+	// Upper bound on the backed-off poll interval
+	breakerMaxInterval = 10 * time.Minute
+)
+
+// Circuit states reported in status output
+const (
+	circuitClosed   = "closed"    // API healthy, polling at the configured interval
+	circuitOpen     = "open"      // API unhealthy, polling backed off
+	circuitHalfOpen = "half-open" // backoff elapsed, next poll is a trial
+)
+
+// apiBreaker is a circuit breaker around ngrok API polling. After
+// repeated failures it stretches the poll interval exponentially until
+// a poll succeeds again.
+type apiBreaker struct {
+	mu          sync.Mutex
+	state       string
+	failures    int
+	lastError   string
+	lastCode    string
+	lastSuccess time.Time
+	openUntil   time.Time
+	interval    time.Duration // current effective poll interval
+}
+
+func newAPIBreaker() *apiBreaker {
+	return &apiBreaker{state: circuitClosed}
+}
+
+// nextInterval returns how long to wait before the next poll
+func (b *apiBreaker) nextInterval(base time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	interval := base
+	if b.state == circuitOpen {
+		interval = b.backoffLocked(base)
+		b.openUntil = time.Now().Add(interval)
+	}
+	b.interval = interval
+	return interval
+}
+
+// beforePoll moves an open circuit to half-open once its backoff elapsed
+func (b *apiBreaker) beforePoll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitOpen && !time.Now().Before(b.openUntil) {
+		b.state = circuitHalfOpen
+	}
+}
+
+// recordSuccess closes the circuit
+func (b *apiBreaker) recordSuccess() (recovered bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	recovered = b.state != circuitClosed
+	b.state = circuitClosed
+	b.failures = 0
+	b.lastSuccess = time.Now()
+	return recovered
+}
+
+// recordFailure counts a failed poll and opens the circuit once the
+// failure threshold is reached
+func (b *apiBreaker) recordFailure(err error) (opened bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastError = err.Error()
+	b.lastCode = ""
+
+	var apiErr *ngrokapi.APIError
+	if errors.As(err, &apiErr) {
+		b.lastCode = apiErr.ErrorCode
+	}
+
+	if b.state != circuitOpen && (b.state == circuitHalfOpen || b.failures >= breakerFailureThreshold) {
+		b.state = circuitOpen
+		return true
+	}
+	return false
+}
+
+// backoffLocked doubles the base interval for every failure past the threshold
+func (b *apiBreaker) backoffLocked(base time.Duration) time.Duration {
+	interval := base
+	for i := breakerFailureThreshold; i <= b.failures && interval < breakerMaxInterval; i++ {
+		interval *= 2
+	}
+	if interval > breakerMaxInterval {
+		interval = breakerMaxInterval
+	}
+	return interval
+}
+
+// status returns the breaker state for status output
+func (b *apiBreaker) status() *socket.APIStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := &socket.APIStatus{
+		Circuit:             b.state,
+		Healthy:             b.state == circuitClosed,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+		LastErrorCode:       b.lastCode,
+		PollInterval:        b.interval.String(),
+	}
+	if !b.lastSuccess.IsZero() {
+		lastSuccess := b.lastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+	if b.state == circuitOpen {
+		nextPoll := b.openUntil
+		status.NextPoll = &nextPoll
+	}
+	return status
+}
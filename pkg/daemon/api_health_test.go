@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
+)
+
+func TestAPIBreaker(t *testing.T) {
+	const base = 30 * time.Second
+	b := newAPIBreaker()
+	fail := errors.New("api down")
+
+	// Failures below the threshold keep polling at the base interval
+	for i := 1; i < breakerFailureThreshold; i++ {
+		if b.recordFailure(fail) {
+			t.Fatalf("circuit opened after %d failures, want %d", i, breakerFailureThreshold)
+		}
+		if got := b.nextInterval(base); got != base {
+			t.Fatalf("interval after %d failures = %s, want %s", i, got, base)
+		}
+	}
+
+	if !b.recordFailure(&ngrokapi.APIError{StatusCode: 503, ErrorCode: "ERR_NGROK_500"}) {
+		t.Fatal("circuit didn't open at the failure threshold")
+	}
+	if got := b.nextInterval(base); got != 2*base {
+		t.Errorf("interval when opened = %s, want %s", got, 2*base)
+	}
+	status := b.status()
+	if status.Circuit != circuitOpen || status.Healthy || status.LastErrorCode != "ERR_NGROK_500" {
+		t.Errorf("status = %+v, want open and unhealthy with the API error code", status)
+	}
+
+	// Backoff doubles per failure up to the cap
+	for i := 0; i < 10; i++ {
+		b.recordFailure(fail)
+	}
+	if got := b.nextInterval(base); got != breakerMaxInterval {
+		t.Errorf("interval after many failures = %s, want %s", got, breakerMaxInterval)
+	}
+
+	// Once the backoff has elapsed the next poll is a trial
+	b.openUntil = time.Now().Add(-time.Second)
+	b.beforePoll()
+	if b.state != circuitHalfOpen {
+		t.Fatalf("state = %s, want %s", b.state, circuitHalfOpen)
+	}
+
+	// A failed trial reopens the circuit, a successful one closes it
+	b.recordFailure(fail)
+	if b.state != circuitOpen {
+		t.Fatalf("state after failed trial = %s, want %s", b.state, circuitOpen)
+	}
+	b.state = circuitHalfOpen
+	if !b.recordSuccess() {
+		t.Error("recordSuccess didn't report recovery")
+	}
+	if got := b.nextInterval(base); got != base || !b.status().Healthy {
+		t.Errorf("after recovery interval = %s healthy = %v, want %s and healthy", got, b.status().Healthy, base)
+	}
+}
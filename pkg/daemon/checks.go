@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// pollStallGrace is how long a poll may take before the polling loop
+	// counts as stalled; polls are bounded by the API timeout and retries
+	pollStallGrace = 5 * time.Minute
+
+	// acceptStallAfter is how long a listener may fail to accept before
+	// its accept loop counts as stalled
+	acceptStallAfter = 30 * time.Second
+)
+
+// registerHealthChecks adds the daemon's readiness and liveness checks.
+// Ready means registered, polled at least once, every endpoint's listener
+// bound and an ingress reachable. Live means no background loop stalled.
+func (d *Daemon) registerHealthChecks() {
+	d.healthServer.AddReadinessCheck("registered", d.checkRegistered)
+	d.healthServer.AddReadinessCheck("poll", d.checkPolled)
+	d.healthServer.AddReadinessCheck("listeners", d.checkListeners)
+	d.healthServer.AddReadinessCheck("ingress", d.checkIngress)
+
+	d.healthServer.AddLivenessCheck("accept_loops", d.checkAcceptLoops)
+}
+
+func (d *Daemon) checkRegistered() (bool, string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if !d.registered {
+		return false, "not registered, waiting for an API key"
+	}
+	return true, "operator " + d.operatorID
+}
+
+func (d *Daemon) checkPolled() (bool, string) {
+	api := d.apiBreaker.status()
+	if api.LastSuccess == nil {
+		if api.LastError != "" {
+			return false, "no successful poll yet: " + api.LastError
+		}
+		return false, "no successful poll yet"
+	}
+	return true, fmt.Sprintf("last successful poll %s ago", time.Since(*api.LastSuccess).Round(time.Second))
+}
+
+func (d *Daemon) checkListeners() (bool, string) {
+	d.mu.RLock()
+	r := d.reconciler
+	d.mu.RUnlock()
+
+	if r == nil {
+		return false, "forwarder not started"
+	}
+
+	endpoints := r.Endpoints()
+	var unbound []string
+	for _, ep := range endpoints {
+		if !ep.LocalListener {
+			unbound = append(unbound, ep.Hostname)
+		}
+	}
+	if len(unbound) > 0 {
+		sort.Strings(unbound)
+		return false, fmt.Sprintf("%d of %d listeners not bound: %s",
+			len(unbound), len(endpoints), strings.Join(unbound, ", "))
+	}
+	return true, fmt.Sprintf("%d of %d listeners bound", len(endpoints), len(endpoints))
+}
+
+func (d *Daemon) checkIngress() (bool, string) {
+	d.mu.RLock()
+	fwd := d.forwarder
+	d.mu.RUnlock()
+
+	if fwd == nil {
+		return false, "forwarder not started"
+	}
+
+	var lastError string
+	for _, state := range fwd.IngressStates() {
+		if state.Healthy && state.Probed {
+			return true, fmt.Sprintf("%s reachable in %s", state.Address, state.Latency.Round(time.Millisecond))
+		}
+		if state.LastError != "" {
+			lastError = state.LastError
+		}
+	}
+	if lastError != "" {
+		return false, "no ingress endpoint reachable: " + lastError
+	}
+	return false, "ingress endpoints not probed yet"
+}
+
+func (d *Daemon) checkAcceptLoops() (bool, string) {
+	d.mu.RLock()
+	mgr := d.listenerMgr
+	d.mu.RUnlock()
+
+	if mgr == nil {
+		return true, "no listeners"
+	}
+
+	stalled := mgr.StalledListeners(acceptStallAfter)
+	if len(stalled) == 0 {
+		return true, ""
+	}
+
+	reasons := make([]string, 0, len(stalled))
+	for name, reason := range stalled {
+		reasons = append(reasons, name+": "+reason)
+	}
+	sort.Strings(reasons)
+	return false, strings.Join(reasons, "; ")
+}
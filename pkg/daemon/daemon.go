@@ -1,20 +1,26 @@
 package daemon
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/cert"
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/config"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/dns"
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/forwarder"
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/health"
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/hosts"
@@ -22,6 +28,8 @@ import (
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/listener"
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/netif"
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/reconciler"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/selector"
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/socket"
 	"github.com/fsnotify/fsnotify"
 	"gopkg.in/yaml.v3"
@@ -31,27 +39,48 @@ const (
 	defaultConfigPath = "/etc/ngrokd/config.yml"
 )
 
+// newNetInterface creates the virtual network interface; tests replace it
+var newNetInterface = netif.New
+
 // Daemon represents the ngrokd daemon
 type Daemon struct {
 	config       *config.DaemonConfig
 	logger       logr.Logger
 	
+	apiClient    *ngrokapi.Client
+	apiBreaker   *apiBreaker
+	pollMetrics  *pollMetrics
+	selectors    *selector.Set
 	certManager  *cert.Manager
 	ipAllocator  *ipalloc.Allocator
 	hostsManager *hosts.Manager
+	dnsServer    *dns.Server
+	hostsTargets hostsTargets // where hostname mappings are published (dns.mode)
 	socketServer *socket.Server
 	healthServer *health.Server
 	netInterface netif.Interface
 	
 	forwarder    *forwarder.Forwarder
 	listenerMgr  *listener.Manager
+	reconciler   *reconciler.Reconciler
 	
 	operatorID   string
 	registered   bool
 	configPath   string
 	
+	// registeredIngress is the ingress endpoint the binding named at registration
+	registeredIngress string
+	
+	// ctx is cancelled on shutdown to stop background loops
+	ctx    context.Context
+	cancel context.CancelFunc
+	loops  sync.WaitGroup
+	
+	// registerMu serializes registration and forwarder setup, which are
+	// too slow to run under mu
+	registerMu sync.Mutex
+	
 	mu               sync.RWMutex
-	endpoints        map[string]socket.EndpointInfo // endpoint ID -> info
 	nextPort         int                            // For network-accessible mode
 	networkPortsByHost map[string]int               // hostname -> network port (persistent)
 }
@@ -67,9 +96,35 @@ func New(configPath string, logger logr.Logger) (*Daemon, error) {
 		config:             cfg,
 		logger:             logger,
 		configPath:         configPath,
-		endpoints:          make(map[string]socket.EndpointInfo),
 		nextPort:           cfg.Net.StartPort,
 		networkPortsByHost: make(map[string]int),
+		apiBreaker:         newAPIBreaker(),
+		pollMetrics:        newPollMetrics(),
+	}
+	
+	// Reject at boot what a reload would reject, before anything binds
+	if err := d.validateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.selectors = d.compileSelectors(cfg.BoundEndpoints.Selectors)
+	
+	// Build the ngrok API client shared by registration and polling
+	d.apiClient, err = ngrokapi.New(ngrokapi.Config{
+		BaseURL:   cfg.API.URL,
+		APIKey:    cfg.API.Key,
+		Timeout:   time.Duration(cfg.API.Timeout) * time.Second,
+		ProxyURL:  cfg.API.ProxyURL,
+		CABundle:  cfg.API.CABundle,
+		UserAgent: cfg.API.UserAgent,
+		PageSize:  cfg.BoundEndpoints.PageSize,
+		MaxPages:  cfg.BoundEndpoints.MaxPages,
+		MaxRetries: cfg.API.MaxRetries,
+		Logger:    logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ngrok API client: %w", err)
 	}
 	
 	// Check if already registered
@@ -78,6 +133,10 @@ func New(configPath string, logger logr.Logger) (*Daemon, error) {
 		d.operatorID = string(data)
 		d.registered = true
 		logger.Info("Found existing registration", "operatorID", d.operatorID)
+		
+		if data, err := os.ReadFile(d.getIngressEndpointPath()); err == nil {
+			d.registeredIngress = ingressAddress(string(data))
+		}
 	}
 	
 	return d, nil
@@ -87,8 +146,25 @@ func New(configPath string, logger logr.Logger) (*Daemon, error) {
 func (d *Daemon) Start() error {
 	d.logger.Info("Starting ngrokd daemon")
 	
+	// Catch SIGINT/SIGTERM early so a signal during startup still tears down cleanly
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	
+	// Undo whatever was set up if startup fails part way, so a failed start
+	// doesn't leave the interface, socket file or DNS listener behind
+	started := false
+	defer func() {
+		if started {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.config.Server.ShutdownTimeout)*time.Second)
+		defer cancel()
+		d.Shutdown(ctx)
+	}()
+	
 	// Create virtual network interface
-	netInterface, err := netif.New(netif.Config{
+	netInterface, err := newNetInterface(netif.Config{
 		Name:   d.config.Net.InterfaceName,
 		Subnet: d.config.Net.Subnet,
 		Logger: d.logger,
@@ -106,6 +182,9 @@ func (d *Daemon) Start() error {
 	
 	// Initialize components
 	d.hostsManager = hosts.NewManager(d.logger)
+	if err := d.startNameResolution(); err != nil {
+		return err
+	}
 	
 	// On macOS, use 127.0.0.0/8 to avoid utun routing conflicts
 	subnet := d.config.Net.Subnet
@@ -133,47 +212,164 @@ func (d *Daemon) Start() error {
 		return fmt.Errorf("failed to start socket server: %w", err)
 	}
 	
-	// Start health server
+	// Endpoint status is tracked even when the health server isn't served
 	d.healthServer = health.NewServer(health.Config{
-		Address: "127.0.0.1",
-		Port:    8081,
-		Logger:  d.logger,
+		Address:     d.config.Health.Address,
+		Port:        d.config.Health.Port,
+		TLSCert:     d.config.Health.TLSCert,
+		TLSKey:      d.config.Health.TLSKey,
+		BearerToken: d.config.Health.BearerToken,
+		Logger:      d.logger,
 	})
-	if err := d.healthServer.Start(); err != nil {
-		d.logger.Error(err, "Failed to start health server")
+	d.registerHealthChecks()
+	if d.config.Health.IsEnabled() {
+		if err := d.healthServer.Start(); err != nil {
+			return fmt.Errorf("failed to start health server (change health.port or set health.enabled: false): %w", err)
+		}
+	} else {
+		d.logger.Info("Health server disabled (health.enabled: false)")
 	}
 	
-	// Check if registered
-	if !d.registered {
-		if d.config.API.Key == "" {
-			d.logger.Info("Not registered and no API key provided")
-			d.logger.Info("Waiting for API key via: ngrok daemon set-api-key <KEY>")
-			d.logger.Info("Socket listening at", "path", d.config.Server.SocketPath)
-			// Will register when API key is provided via socket
+	// Register if needed, then start polling
+	d.mu.RLock()
+	registered, apiKey := d.registered, d.config.API.Key
+	d.mu.RUnlock()
+	if !registered && apiKey == "" {
+		d.logger.Info("Not registered and no API key provided")
+		d.logger.Info("Waiting for API key via: ngrok daemon set-api-key <KEY>")
+		d.logger.Info("Socket listening at", "path", d.config.Server.SocketPath)
+		// Will register when API key is provided via socket
+	} else if err := d.ensureRegistered(); err != nil {
+		return err
+	}
+	
+	// Start config file watcher for auto-reload
+	d.loops.Add(1)
+	go d.watchConfig()
+	
+	d.logger.Info("Daemon started successfully")
+	started = true
+	
+	// Run until signalled
+	sig := <-sigCh
+	d.logger.Info("Received signal, shutting down", "signal", sig.String())
+	
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.config.Server.ShutdownTimeout)*time.Second)
+	defer cancel()
+	
+	return d.Shutdown(ctx)
+}
+
+// Shutdown stops the polling loop and config watcher, drains in-flight
+// connections until ctx is done, and removes the virtual interface, IP
+// aliases and hosts entries created by the daemon.
+func (d *Daemon) Shutdown(ctx context.Context) error {
+	d.logger.Info("Shutting down ngrokd daemon",
+		"drain_timeout", fmt.Sprintf("%ds", d.config.Server.ShutdownTimeout))
+	
+	// Stop background loops
+	d.cancel()
+	d.loops.Wait()
+	
+	d.mu.RLock()
+	fwd, listenerMgr, r := d.forwarder, d.listenerMgr, d.reconciler
+	d.mu.RUnlock()
+	
+	// Stop accepting and drain in-flight connections
+	if listenerMgr != nil {
+		if err := listenerMgr.Shutdown(ctx); err != nil {
+			d.logger.Info("Drain deadline exceeded, remaining connections were closed")
 		} else {
-			// Auto-register
-			if err := d.register(); err != nil {
-				return fmt.Errorf("failed to register: %w", err)
+			d.logger.Info("All connections drained")
+		}
+	}
+	
+	// Close pre-warmed ingress connections
+	if fwd != nil {
+		fwd.Close()
+	}
+	
+	// Remove IP aliases and the virtual interface.
+	// Persistent IP mappings are kept so endpoints get the same IPs on restart.
+	if d.netInterface != nil {
+		if r != nil {
+			removed := make(map[string]bool)
+			for _, ep := range r.Endpoints() {
+				if removed[ep.Placement.IP] {
+					continue
+				}
+				removed[ep.Placement.IP] = true
+				
+				if ip := net.ParseIP(ep.Placement.IP); ip != nil {
+					if err := d.netInterface.RemoveIP(ip); err != nil {
+						d.logger.V(1).Info("Failed to remove IP from interface", "ip", ep.Placement.IP, "error", err)
+					}
+				}
 			}
 		}
+		
+		if err := d.netInterface.Destroy(); err != nil {
+			d.logger.Error(err, "Failed to destroy virtual network interface")
+		}
 	}
 	
-	// If registered, start polling
-	if d.registered {
-		if err := d.initializeForwarder(); err != nil {
-			return fmt.Errorf("failed to initialize forwarder: %w", err)
+	if d.dnsServer != nil {
+		if err := d.dnsServer.Stop(); err != nil {
+			d.logger.Error(err, "Failed to stop DNS server")
 		}
-		go d.pollingLoop()
 	}
 	
-	// Start config file watcher for auto-reload
-	go d.watchConfig()
+	// Remove managed /etc/hosts section
+	if d.hostsManager != nil {
+		if err := d.hostsManager.RemoveAll(); err != nil {
+			d.logger.Error(err, "Failed to clean up /etc/hosts")
+		}
+	}
 	
-	// Run forever
-	d.logger.Info("Daemon started successfully")
-	select {}
+	if d.socketServer != nil {
+		d.socketServer.Stop()
+	}
+	
+	if d.healthServer != nil {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := d.healthServer.Stop(stopCtx); err != nil {
+			d.logger.Error(err, "Failed to stop health server")
+		}
+	}
+	
+	d.logger.Info("Shutdown complete")
+	return nil
+}
+
+// ensureRegistered registers the operator if it isn't yet, sets up the
+// forwarder and starts the loops that need a registered operator.
+// Concurrent callers are serialized, so only the first one does any work.
+func (d *Daemon) ensureRegistered() error {
+	d.registerMu.Lock()
+	defer d.registerMu.Unlock()
+	
+	d.mu.RLock()
+	registered, started := d.registered, d.forwarder != nil
+	d.mu.RUnlock()
+	
+	if started {
+		return nil
+	}
+	if !registered {
+		if err := d.register(); err != nil {
+			return fmt.Errorf("failed to register: %w", err)
+		}
+	}
+	if err := d.initializeForwarder(); err != nil {
+		return fmt.Errorf("failed to initialize forwarder: %w", err)
+	}
+	d.startRegisteredLoops()
+	return nil
 }
 
+// register creates the operator and its binding certificate. Callers hold
+// registerMu.
 func (d *Daemon) register() error {
 	d.logger.Info("Registering with ngrok API")
 	
@@ -183,39 +379,91 @@ func (d *Daemon) register() error {
 		return fmt.Errorf("failed to create cert directory: %w", err)
 	}
 	
-	d.certManager = cert.NewManager(cert.Config{
-		CertDir:     certDir,
-		APIKey:      d.config.API.Key,
-		Description: "ngrokd daemon",
-		Region:      "global",
-		Logger:      d.logger,
-	})
+	d.mu.RLock()
+	selectors := append([]string(nil), d.config.BoundEndpoints.Selectors...)
+	d.mu.RUnlock()
+	
+	certManager := d.newCertManager()
 	
 	ctx := context.Background()
-	_, err := d.certManager.EnsureCertificate(ctx, cert.Config{
+	_, err := certManager.EnsureCertificate(ctx, cert.Config{
 		CertDir:     certDir,
-		APIKey:      d.config.API.Key,
+		APIClient:   d.apiClient,
 		Description: "ngrokd daemon",
 		Region:      "global",
+		Selectors:   selectors,
 		Logger:      d.logger,
 	})
 	if err != nil {
 		return err
 	}
 	
-	d.operatorID = d.certManager.GetOperatorID()
-	d.registered = true
+	operatorID := certManager.GetOperatorID()
 	
 	// Save operator ID
 	operatorIDPath := d.getOperatorIDPath()
-	if err := os.WriteFile(operatorIDPath, []byte(d.operatorID), 0644); err != nil {
+	if err := os.WriteFile(operatorIDPath, []byte(operatorID), 0644); err != nil {
 		return err
 	}
 	
-	d.logger.Info("Registration complete", "operatorID", d.operatorID)
+	d.mu.Lock()
+	d.certManager = certManager
+	d.operatorID = operatorID
+	d.registeredIngress = ingressAddress(certManager.RegisteredIngressEndpoint())
+	d.registered = true
+	d.mu.Unlock()
+	
+	d.logger.Info("Registration complete", "operatorID", operatorID)
 	return nil
 }
 
+func (d *Daemon) newCertManager() *cert.Manager {
+	return cert.NewManager(cert.Config{
+		CertDir:     d.getCertDir(),
+		APIClient:   d.apiClient,
+		Description: "ngrokd daemon",
+		Region:      "global",
+		Logger:      d.logger,
+	})
+}
+
+// startRegisteredLoops starts the background loops that need a registered
+// operator. Callers hold registerMu.
+func (d *Daemon) startRegisteredLoops() {
+	// Already registered on a previous run - no manager was created by register()
+	d.mu.RLock()
+	certManager := d.certManager
+	d.mu.RUnlock()
+	if certManager == nil {
+		certManager = d.newCertManager()
+		d.mu.Lock()
+		d.certManager = certManager
+		d.mu.Unlock()
+	}
+	
+	d.loops.Add(2)
+	go d.pollingLoop()
+	go d.certRenewalLoop()
+	
+	if d.config.Probe.Enabled {
+		d.loops.Add(1)
+		go d.probeLoop()
+	}
+}
+
+// certRenewalLoop re-issues the binding certificate before it expires and
+// hot-swaps it into the forwarder
+func (d *Daemon) certRenewalLoop() {
+	defer d.loops.Done()
+	
+	d.certManager.RunRenewal(d.ctx, d.config.Server.CertRenewFraction, func(c tls.Certificate) {
+		d.forwarder.SetCertificate(c)
+		d.logger.Info("✓ New binding certificate in use for new connections")
+	})
+}
+
+// initializeForwarder creates the forwarder, listener manager and
+// reconciler. Callers hold registerMu.
 func (d *Daemon) initializeForwarder() error {
 	// Load certificate
 	cert, err := tls.LoadX509KeyPair(d.config.Server.ClientCert, d.config.Server.ClientKey)
@@ -223,34 +471,101 @@ func (d *Daemon) initializeForwarder() error {
 		return fmt.Errorf("failed to load certificate: %w", err)
 	}
 	
+	ingress := d.ingressEndpoint()
+	if d.ingressMismatch() {
+		d.logger.Info("⚠️  Configured ingressEndpoint differs from the one this operator was registered with - connections may fail with 'failed to read header length'",
+			"configured", d.config.IngressEndpoint,
+			"registered", d.registeredIngress)
+	}
+	
 	// Create forwarder
-	d.forwarder, err = forwarder.New(forwarder.Config{
-		IngressEndpoint: d.config.IngressEndpoint,
-		TLSCert:         cert,
-		Logger:          d.logger,
+	fwd, err := forwarder.New(forwarder.Config{
+		IngressEndpoint:  ingress,
+		IngressEndpoints: d.config.Ingress.Endpoints,
+		DialTimeout:      time.Duration(d.config.Ingress.DialTimeout) * time.Second,
+		ProbeInterval:    time.Duration(d.config.Ingress.ProbeInterval) * time.Second,
+		TLSCert:          cert,
+		PoolSize:         d.config.Ingress.PoolSize,
+		PoolMaxIdle:      time.Duration(d.config.Ingress.PoolMaxIdle) * time.Second,
+		TLSVerify:        d.config.Ingress.TLSVerify,
+		CABundle:         d.config.Ingress.CABundle,
+		Pins:             d.config.Ingress.Pins,
+		Logger:           d.logger,
 	})
 	if err != nil {
 		return err
 	}
 	
+	// Keep the registered ingress first even when another one probes faster
+	if registered := d.preferredIngress(); registered != "" {
+		fwd.PreferIngressEndpoint(registered)
+	}
+	
 	// Create listener manager
-	d.listenerMgr = listener.New(d.forwarder, d.logger)
-	d.listenerMgr.SetStatusCallback(d.healthServer)
+	listenerMgr := listener.New(fwd, d.logger)
+	listenerMgr.SetStatusCallback(d.healthServer)
+	
+	// Create reconciler that converges listeners on the API's bound endpoints
+	r := reconciler.New(reconciler.Config{
+		Network:   d.netInterface,
+		Listeners: listenerMgr,
+		Hosts:     d.hostsTargets,
+		Status:    d.healthServer,
+		Allocator: placer{d},
+		Options:   d.endpointOptions,
+		Logger:    d.logger,
+	})
+	
+	d.mu.Lock()
+	d.forwarder = fwd
+	d.listenerMgr = listenerMgr
+	d.reconciler = r
+	d.mu.Unlock()
+	
+	d.healthServer.SetPoolStatsFunc(func() health.PoolStats {
+		return health.PoolStats(fwd.PoolStats())
+	})
+	d.healthServer.SetMetricsFunc(d.writeMetrics)
 	
 	return nil
 }
 
 func (d *Daemon) pollingLoop() {
-	ticker := time.NewTicker(time.Duration(d.config.BoundEndpoints.PollInterval) * time.Second)
-	defer ticker.Stop()
+	defer d.loops.Done()
 	
 	d.logger.Info("Starting polling loop", "interval", fmt.Sprintf("%ds", d.config.BoundEndpoints.PollInterval))
 	
+	// Liveness fails if a poll hangs or the loop stops waking up
+	heartbeat := d.healthServer.Heartbeat("poll_loop")
+	defer heartbeat.Stop()
+	heartbeat.Beat(pollStallGrace)
+	
+	// Sync selectors and the ingress endpoint with the operator binding
+	d.syncOperatorBinding()
+	
 	// Poll immediately on startup
+	heartbeat.Beat(pollStallGrace)
 	d.pollAndReconcile()
 	
-	for range ticker.C {
-		d.pollAndReconcile()
+	for {
+		// Interval is re-read each cycle so reloads and API backoff apply
+		d.mu.RLock()
+		base := time.Duration(d.config.BoundEndpoints.PollInterval) * time.Second
+		d.mu.RUnlock()
+		
+		interval := d.apiBreaker.nextInterval(base)
+		heartbeat.Beat(interval + pollStallGrace)
+		
+		timer := time.NewTimer(interval)
+		select {
+		case <-d.ctx.Done():
+			timer.Stop()
+			d.logger.Info("Polling loop stopped")
+			return
+		case <-timer.C:
+			d.apiBreaker.beforePoll()
+			d.pollAndReconcile()
+		}
 	}
 }
 
@@ -258,44 +573,51 @@ func (d *Daemon) pollAndReconcile() {
 	d.logger.V(1).Info("Polling for bound endpoints")
 	
 	// Fetch bound endpoints from API
-	ctx := context.Background()
-	client := ngrokapi.NewClient(d.config.API.Key)
-	
-	apiEndpoints, err := client.ListBoundEndpoints(ctx, d.operatorID)
+	ctx := d.ctx
+	start := time.Now()
+	apiEndpoints, err := d.apiClient.ListBoundEndpoints(ctx, d.operatorID)
+	if ctx.Err() == nil {
+		d.pollMetrics.record(time.Since(start), err)
+	}
+	if err != nil && ctx.Err() == nil {
+		if d.apiBreaker.recordFailure(err) {
+			d.logger.Info("⚠️  ngrok API unhealthy, backing off polling",
+				"consecutive_failures", breakerFailureThreshold)
+		}
+	}
 	if err != nil {
+		// Never reconcile against a partial list - it would remove live endpoints
+		var pageErr *ngrokapi.PaginationError
+		if errors.As(err, &pageErr) {
+			d.logger.Error(err, "Incomplete bound endpoint list, skipping reconciliation",
+				"failed_page", pageErr.Page,
+				"fetched", len(pageErr.Endpoints))
+			return
+		}
 		d.logger.Error(err, "Failed to fetch bound endpoints")
 		return
 	}
 	
-	d.logger.V(1).Info("Found bound endpoints", "count", len(apiEndpoints))
-	
-	// Build desired state
-	desired := make(map[string]ngrokapi.Endpoint)
-	for _, ep := range apiEndpoints {
-		desired[ep.ID] = ep
+	if d.apiBreaker.recordSuccess() {
+		d.logger.Info("✓ ngrok API recovered, resuming normal polling")
 	}
 	
-	d.mu.Lock()
+	d.logger.V(1).Info("Found bound endpoints", "count", len(apiEndpoints))
 	
-	// Remove deleted endpoints
-	for id := range d.endpoints {
-		if _, exists := desired[id]; !exists {
-			d.removeEndpoint(id)
-		}
+	// Apply selectors client-side so each daemon only sees its own endpoints
+	d.mu.RLock()
+	selected := d.selectors.Filter(apiEndpoints)
+	d.mu.RUnlock()
+	if skipped := len(apiEndpoints) - len(selected); skipped > 0 {
+		d.logger.V(1).Info("Filtered bound endpoints by selector", "selected", len(selected), "skipped", skipped)
 	}
 	
-	// Add new endpoints
-	for id, ep := range desired {
-		if _, exists := d.endpoints[id]; !exists {
-			d.addEndpoint(ep)
-		}
+	// Listeners outlive the polling loop; Shutdown drains and closes them
+	plan := d.reconciler.Reconcile(context.Background(), selected)
+	if !plan.Empty() {
+		d.logger.V(1).Info("Reconciled bound endpoints", "changes", len(plan.Changes), "unchanged", plan.Unchanged)
 	}
 	
-	d.mu.Unlock()
-	
-	// Update /etc/hosts
-	d.updateHosts()
-	
 	// Save IP mappings
 	ipMappingsPath := d.getIPMappingsPath()
 	d.ipAllocator.SavePersistentMappings(ipMappingsPath)
@@ -320,6 +642,12 @@ func (d *Daemon) getOperatorIDPath() string {
 	return filepath.Join(certDir, "operator_id")
 }
 
+// getIngressEndpointPath is where the cert manager saves the registered ingress
+func (d *Daemon) getIngressEndpointPath() string {
+	certDir := d.getCertDir()
+	return filepath.Join(certDir, "ingress_endpoint")
+}
+
 func (d *Daemon) getIPMappingsPath() string {
 	certDir := d.getCertDir()
 	return filepath.Join(certDir, "ip_mappings.json")
@@ -341,6 +669,8 @@ func fileExists(path string) bool {
 }
 
 func (d *Daemon) watchConfig() {
+	defer d.loops.Done()
+	
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		d.logger.Error(err, "Failed to create config watcher")
@@ -357,13 +687,40 @@ func (d *Daemon) watchConfig() {
 	
 	d.logger.Info("Watching config file for changes", "path", d.configPath)
 	
+	// Also watch the client certificate files so rotated pairs are picked up
+	certPath := filepath.Clean(d.config.Server.ClientCert)
+	keyPath := filepath.Clean(d.config.Server.ClientKey)
+	for _, dir := range []string{filepath.Dir(certPath), filepath.Dir(keyPath)} {
+		if dir == configDir {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			d.logger.Error(err, "Failed to watch certificate directory", "path", dir)
+		}
+	}
+	
+	d.logger.Info("Watching client certificate for changes", "cert", certPath, "key", keyPath)
+	
 	for {
 		select {
+		case <-d.ctx.Done():
+			return
+			
 		case event, ok := <-watcher.Events:
 			if !ok {
 				return
 			}
 			
+			changed := event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create
+			
+			// Client certificate or key rotated on disk
+			if changed && isClientCertEvent(event.Name, certPath, keyPath) {
+				// Small delay so both halves of the pair are written
+				time.Sleep(100 * time.Millisecond)
+				d.reloadClientCert()
+				continue
+			}
+			
 			// Only care about changes to our config file
 			if event.Name != d.configPath {
 				continue
@@ -386,6 +743,67 @@ func (d *Daemon) watchConfig() {
 	}
 }
 
+// isClientCertEvent reports whether a watcher event may have replaced the
+// client certificate or key. Besides the files themselves this matches
+// Kubernetes secret and configmap mounts, which rotate by swapping the
+// "..data" symlink the files point through.
+func isClientCertEvent(name, certPath, keyPath string) bool {
+	if name == certPath || name == keyPath {
+		return true
+	}
+	dir := filepath.Dir(name)
+	return strings.HasPrefix(filepath.Base(name), "..") &&
+		(dir == filepath.Dir(certPath) || dir == filepath.Dir(keyPath))
+}
+
+// reloadClientCert loads the client certificate pair from disk and swaps it
+// into the forwarder. Invalid pairs are rejected and the current one is kept.
+func (d *Daemon) reloadClientCert() {
+	d.mu.RLock()
+	fwd := d.forwarder
+	d.mu.RUnlock()
+	
+	if fwd == nil {
+		return
+	}
+	
+	newCert, err := tls.LoadX509KeyPair(d.config.Server.ClientCert, d.config.Server.ClientKey)
+	if err != nil {
+		d.logger.Error(err, "❌ Invalid client certificate pair - keeping current certificate",
+			"cert", d.config.Server.ClientCert,
+			"key", d.config.Server.ClientKey)
+		return
+	}
+	
+	leaf := newCert.Leaf
+	if leaf == nil {
+		leaf, err = x509.ParseCertificate(newCert.Certificate[0])
+		if err != nil {
+			d.logger.Error(err, "❌ Unparseable client certificate - keeping current certificate")
+			return
+		}
+	}
+	
+	now := time.Now()
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		d.logger.Error(fmt.Errorf("certificate valid from %s to %s", leaf.NotBefore, leaf.NotAfter),
+			"❌ Client certificate is not currently valid - keeping current certificate")
+		return
+	}
+	
+	// Skip no-op reloads (e.g. our own renewal writing the same pair)
+	current := fwd.Certificate()
+	if len(current.Certificate) > 0 && bytes.Equal(current.Certificate[0], newCert.Certificate[0]) {
+		d.logger.V(1).Info("Client certificate unchanged")
+		return
+	}
+	
+	fwd.SetCertificate(newCert)
+	d.logger.Info("✓ Client certificate reloaded",
+		"subject", leaf.Subject.String(),
+		"notAfter", leaf.NotAfter)
+}
+
 func (d *Daemon) reloadConfig() {
 	// Load new config
 	newCfg, err := config.LoadDaemonConfig(d.configPath)
@@ -403,17 +821,42 @@ func (d *Daemon) reloadConfig() {
 	}
 	
 	d.mu.Lock()
-	defer d.mu.Unlock()
 	
 	// Update settings that can be hot-reloaded
 	oldPollInterval := d.config.BoundEndpoints.PollInterval
 	oldOverrides := d.config.Net.Overrides
 	oldListenInterface := d.config.Net.ListenInterface
+	oldSelectors := d.config.BoundEndpoints.Selectors
+	oldEndpoints := d.config.Endpoints
 	
 	d.config.BoundEndpoints.PollInterval = newCfg.BoundEndpoints.PollInterval
+	d.config.BoundEndpoints.Selectors = newCfg.BoundEndpoints.Selectors
 	d.config.Net.Overrides = newCfg.Net.Overrides
 	d.config.Net.ListenInterface = newCfg.Net.ListenInterface
 	d.config.Net.StartPort = newCfg.Net.StartPort
+	d.config.Endpoints = newCfg.Endpoints
+	
+	// Ingress endpoints and the pool are only set up at startup
+	if fmt.Sprintf("%v", d.config.Ingress) != fmt.Sprintf("%v", newCfg.Ingress) {
+		d.logger.Info("⚠️  ingress settings changed - restart ngrokd to apply them")
+	}
+	
+	// DNS listeners are only set up at startup
+	if fmt.Sprintf("%v", d.config.DNS) != fmt.Sprintf("%v", newCfg.DNS) {
+		d.logger.Info("⚠️  dns settings changed - restart ngrokd to apply them")
+	}
+	
+	// So is the health server; Enabled is a pointer, so compare it by value
+	oldHealth, newHealth := d.config.Health, newCfg.Health
+	oldHealth.Enabled, newHealth.Enabled = nil, nil
+	if oldHealth != newHealth || d.config.Health.IsEnabled() != newCfg.Health.IsEnabled() {
+		d.logger.Info("⚠️  health settings changed - restart ngrokd to apply them")
+	}
+	
+	// The prober reads its settings when it starts
+	if fmt.Sprintf("%v", d.config.Probe) != fmt.Sprintf("%v", newCfg.Probe) {
+		d.logger.Info("⚠️  probe settings changed - restart ngrokd to apply them")
+	}
 	
 	// Log what changed
 	if oldPollInterval != newCfg.BoundEndpoints.PollInterval {
@@ -422,44 +865,236 @@ func (d *Daemon) reloadConfig() {
 			"new", newCfg.BoundEndpoints.PollInterval)
 	}
 	
+	if !stringSlicesEqual(oldSelectors, newCfg.BoundEndpoints.Selectors) {
+		d.selectors = d.compileSelectors(newCfg.BoundEndpoints.Selectors)
+		d.logger.Info("✓ Endpoint selectors updated",
+			"old", oldSelectors,
+			"new", newCfg.BoundEndpoints.Selectors)
+		
+		// Update the operator binding without holding the lock. It is
+		// tracked so Shutdown doesn't close the forwarder under it.
+		if d.registered {
+			d.loops.Add(1)
+			go func() {
+				defer d.loops.Done()
+				d.syncOperatorBinding()
+			}()
+		}
+	}
+	
 	// Check if listen interfaces changed for existing endpoints
 	overridesChanged := fmt.Sprintf("%v", oldOverrides) != fmt.Sprintf("%v", newCfg.Net.Overrides)
 	defaultChanged := oldListenInterface != newCfg.Net.ListenInterface
 	
-	if overridesChanged || defaultChanged {
-		d.logger.Info("✓ Listen interface configuration changed")
-		d.logger.Info("⚠️  Rebinding existing endpoints (active connections will drop)")
-		
-		// Rebind affected endpoints
-		endpointsToRebind := []string{}
+	endpointsChanged := fmt.Sprintf("%v", oldEndpoints) != fmt.Sprintf("%v", newCfg.Endpoints)
+	
+	r := d.reconciler
+	d.mu.Unlock()
+	
+	if endpointsChanged {
+		d.logger.Info("✓ Endpoint forwarding settings changed")
+	}
+	
+	if (overridesChanged || defaultChanged || endpointsChanged) && r != nil {
+		if overridesChanged || defaultChanged {
+			d.logger.Info("✓ Listen interface configuration changed")
+		}
 		
-		for id, ep := range d.endpoints {
-			// Check if this endpoint's listen interface changed
-			oldInterface := d.getListenInterfaceForHostname(ep.Hostname, oldOverrides, oldListenInterface)
-			newInterface := d.getListenInterfaceForHostname(ep.Hostname, newCfg.Net.Overrides, newCfg.Net.ListenInterface)
-			
-			if oldInterface != newInterface {
-				endpointsToRebind = append(endpointsToRebind, id)
-				d.logger.Info("Endpoint needs rebinding",
-					"hostname", ep.Hostname,
-					"old_interface", oldInterface,
-					"new_interface", newInterface)
+		// Re-plan against the last polled endpoints with the new settings.
+		// Forwarding setting changes are applied in place; only endpoints
+		// whose listener moved are rebound.
+		plan := r.Resync(context.Background())
+		rebound, updated := 0, 0
+		for _, change := range plan.Changes {
+			switch {
+			case change.OptionsOnly():
+				updated++
+				d.logger.Info("Endpoint updated in place", "endpoint", change.URL())
+			case change.Action == reconciler.ActionUpdate:
+				rebound++
+				d.logger.Info("⚠️  Endpoint rebound (active connections dropped)", "endpoint", change.URL(), "listen_address", change.Placement.ListenAddr())
 			}
 		}
 		
-		// Rebind endpoints (unlock during operations)
-		if len(endpointsToRebind) > 0 {
-			d.mu.Unlock()
-			d.rebindEndpoints(endpointsToRebind)
-			d.mu.Lock()
-			
-			d.logger.Info("✓ Rebinding complete", "count", len(endpointsToRebind))
-		}
+		d.logger.Info("✓ Reload applied", "rebound", rebound, "updated_in_place", updated)
 	}
 	
 	d.logger.Info("✅ Config reloaded successfully")
 }
 
+// compileSelectors parses endpoint selectors for client-side filtering.
+// Selectors outside the locally supported subset are left to the API.
+func (d *Daemon) compileSelectors(exprs []string) *selector.Set {
+	set, unsupported := selector.NewSet(exprs)
+	for _, expr := range unsupported {
+		d.logger.Info("⚠️  Selector can't be evaluated locally, relying on server-side filtering",
+			"selector", expr)
+	}
+	return set
+}
+
+// endpointOptions returns the configured forwarding settings for an endpoint
+func (d *Daemon) endpointOptions(hostname string, port int) forwarder.EndpointOptions {
+	d.mu.RLock()
+	cfg := d.config.Endpoints.For(hostname)
+	d.mu.RUnlock()
+	
+	options := forwarder.EndpointOptions{
+		ForwardedHeaders: cfg.ForwardedHeaders,
+		ProxyProtocol:    cfg.ProxyProtocol,
+	}
+	if options.ProxyProtocol == "off" {
+		options.ProxyProtocol = ""
+	}
+	if cfg.IdleTimeout > 0 {
+		options.IdleTimeout = time.Duration(cfg.IdleTimeout) * time.Second
+	}
+	if cfg.MaxLifetime > 0 {
+		options.MaxLifetime = time.Duration(cfg.MaxLifetime) * time.Second
+	}
+	return options
+}
+
+// syncOperatorBinding adds the binding's ingress endpoint to the forwarder
+// and updates the binding's endpoint selectors if they differ from the
+// configured ones
+func (d *Daemon) syncOperatorBinding() {
+	d.mu.RLock()
+	operatorID := d.operatorID
+	fwd := d.forwarder
+	selectors := append([]string(nil), d.config.BoundEndpoints.Selectors...)
+	d.mu.RUnlock()
+	
+	if operatorID == "" {
+		return
+	}
+	
+	operator, err := d.apiClient.GetKubernetesOperator(d.ctx, operatorID)
+	if err != nil {
+		d.logger.Error(err, "Failed to fetch operator to check endpoint selectors")
+		return
+	}
+	
+	// The binding names the ingress this operator is meant to use
+	if operator.Binding != nil && operator.Binding.IngressEndpoint != "" && fwd != nil {
+		d.recordRegisteredIngress(operator.Binding.IngressEndpoint)
+		if registered := d.preferredIngress(); registered != "" {
+			fwd.PreferIngressEndpoint(registered)
+		} else {
+			fwd.AddIngressEndpoint(ingressAddress(operator.Binding.IngressEndpoint))
+		}
+	}
+	
+	if operator.Binding != nil && stringSlicesEqual(operator.Binding.EndpointSelectors, selectors) {
+		return
+	}
+	
+	_, err = d.apiClient.UpdateKubernetesOperator(d.ctx, operatorID, &ngrokapi.KubernetesOperatorUpdate{
+		Binding: &ngrokapi.KubernetesOperatorBindingUpdate{
+			EndpointSelectors: selectors,
+		},
+	})
+	if err != nil {
+		d.logger.Error(err, "Failed to update operator endpoint selectors", "selectors", selectors)
+		return
+	}
+	
+	d.logger.Info("✓ Operator binding selectors updated", "selectors", selectors)
+}
+
+// recordRegisteredIngress saves the binding's ingress endpoint if it changed
+func (d *Daemon) recordRegisteredIngress(endpoint string) {
+	address := ingressAddress(endpoint)
+	
+	d.mu.Lock()
+	changed := address != d.registeredIngress
+	d.registeredIngress = address
+	d.mu.Unlock()
+	
+	if !changed {
+		return
+	}
+	
+	d.logger.Info("✓ Operator binding ingress endpoint recorded", "address", address)
+	if err := d.certManager.SetRegisteredIngressEndpoint(endpoint); err != nil {
+		d.logger.Info("Failed to save ingress endpoint", "error", err)
+	}
+}
+
+// ingressEndpoint returns the ingress to dial first: the configured one
+// if set, else the one from registration, else the default
+func (d *Daemon) ingressEndpoint() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	
+	switch {
+	case d.ingressOverride() != "":
+		return d.config.IngressEndpoint
+	case d.registeredIngress != "":
+		return d.registeredIngress
+	default:
+		return config.DefaultIngressEndpoint
+	}
+}
+
+// ingressMismatch reports whether an explicitly configured ingress differs
+// from the one the operator was registered with
+func (d *Daemon) ingressMismatch() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	
+	override := d.ingressOverride()
+	return override != "" && d.registeredIngress != "" && override != d.registeredIngress
+}
+
+// preferredIngress returns the registered ingress unless the config
+// overrides it, or "" if there is nothing to prefer
+func (d *Daemon) preferredIngress() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	
+	if d.ingressOverride() != "" {
+		return ""
+	}
+	return d.registeredIngress
+}
+
+// ingressOverride returns the explicitly configured ingress address, or ""
+// if unset. The default written by older installers and container images
+// doesn't count, so those configs still use the registered ingress.
+// Callers hold d.mu.
+func (d *Daemon) ingressOverride() string {
+	address := ingressAddress(d.config.IngressEndpoint)
+	if address == config.DefaultIngressEndpoint {
+		return ""
+	}
+	return address
+}
+
+// ingressAddress adds the default port to an ingress endpoint without one
+func ingressAddress(endpoint string) string {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		return net.JoinHostPort(endpoint, "443")
+	}
+	return endpoint
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (d *Daemon) validateConfig(cfg *config.DaemonConfig) error {
 	// Validate poll interval
 	if cfg.BoundEndpoints.PollInterval <= 0 {
@@ -494,54 +1129,109 @@ func (d *Daemon) validateConfig(cfg *config.DaemonConfig) error {
 		}
 	}
 	
-	// Validate start_port
-	if cfg.Net.StartPort < 1 || cfg.Net.StartPort > 65535 {
-		return fmt.Errorf("start_port must be between 1 and 65535")
+	// Validate dns
+	switch cfg.DNS.Mode {
+	case dnsModeHosts, dnsModeServer, dnsModeBoth:
+	default:
+		return fmt.Errorf("dns.mode must be 'hosts', 'server' or 'both'")
+	}
+	if _, _, err := net.SplitHostPort(cfg.DNS.Listen); err != nil {
+		return fmt.Errorf("dns.listen must be host:port: %w", err)
 	}
 	
-	return nil
-}
-
-func (d *Daemon) getListenInterfaceForHostname(hostname string, overrides map[string]string, defaultInterface string) string {
-	if override, exists := overrides[hostname]; exists {
-		return override
+	// Validate endpoint settings
+	endpointSettings := map[string]config.EndpointConfig{"defaults": cfg.Endpoints.Defaults}
+	for hostname, override := range cfg.Endpoints.Overrides {
+		endpointSettings[hostname] = override
+	}
+	for name, settings := range endpointSettings {
+		switch settings.ForwardedHeaders {
+		case "", forwarder.ForwardedAppend, forwarder.ForwardedReplace, forwarder.ForwardedSkip:
+		default:
+			return fmt.Errorf("invalid forwarded_headers for '%s': must be 'append', 'replace' or 'skip'", name)
+		}
+		switch settings.ProxyProtocol {
+		case "", "off", forwarder.ProxyProtocolV1, forwarder.ProxyProtocolV2:
+		default:
+			return fmt.Errorf("invalid proxy_protocol for '%s': must be 'v1', 'v2' or 'off'", name)
+		}
 	}
-	return defaultInterface
-}
-
-func (d *Daemon) rebindEndpoints(endpointIDs []string) {
-	d.mu.Lock()
 	
-	// Collect endpoint info before stopping
-	endpointsToRecreate := []ngrokapi.Endpoint{}
+	// Validate ingress
+	for _, address := range cfg.Ingress.Endpoints {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("invalid ingress endpoint '%s': must be host:port", address)
+		}
+	}
+	if cfg.Ingress.DialTimeout < 1 {
+		return fmt.Errorf("ingress.dial_timeout must be at least 1 second")
+	}
+	if cfg.Ingress.ProbeInterval < 1 {
+		return fmt.Errorf("ingress.probe_interval must be at least 1 second")
+	}
+	switch cfg.Ingress.TLSVerify {
+	case forwarder.TLSVerifyStrict, forwarder.TLSVerifyCA, forwarder.TLSVerifyInsecure:
+	default:
+		return fmt.Errorf("ingress.tls_verify must be 'strict', 'ca' or 'insecure'")
+	}
+	for _, pin := range cfg.Ingress.Pins {
+		if err := forwarder.ValidatePin(pin); err != nil {
+			return fmt.Errorf("ingress.pins: %w", err)
+		}
+	}
+	if cfg.Ingress.CABundle != "" {
+		if _, err := os.Stat(cfg.Ingress.CABundle); err != nil {
+			return fmt.Errorf("ingress.ca_bundle: %w", err)
+		}
+	}
+	if err := forwarder.ValidateCABundle(cfg.Ingress.TLSVerify, cfg.Ingress.CABundle); err != nil {
+		return err
+	}
+	if cfg.Ingress.PoolSize < 0 {
+		return fmt.Errorf("ingress.pool_size must not be negative")
+	}
+	if cfg.Ingress.PoolMaxIdle < 1 {
+		return fmt.Errorf("ingress.pool_max_idle must be at least 1 second")
+	}
 	
-	for _, id := range endpointIDs {
-		ep, exists := d.endpoints[id]
-		if !exists {
-			continue
+	// Validate health
+	if cfg.Health.Port < 1 || cfg.Health.Port > 65535 {
+		return fmt.Errorf("health.port must be between 1 and 65535")
+	}
+	if (cfg.Health.TLSCert == "") != (cfg.Health.TLSKey == "") {
+		return fmt.Errorf("health.tls_cert and health.tls_key must be set together")
+	}
+	
+	// Validate probe
+	if cfg.Probe.Interval < 1 {
+		return fmt.Errorf("probe.interval must be at least 1 second")
+	}
+	if cfg.Probe.Timeout < 1 {
+		return fmt.Errorf("probe.timeout must be at least 1 second")
+	}
+	if cfg.Probe.HTTP.Path != "" && !strings.HasPrefix(cfg.Probe.HTTP.Path, "/") {
+		return fmt.Errorf("probe.http.path must start with /")
+	}
+	if strings.ContainsAny(cfg.Probe.HTTP.Path+cfg.Probe.HTTP.Method, " \t\r\n") {
+		return fmt.Errorf("probe.http.method and probe.http.path must not contain whitespace")
+	}
+	for _, status := range cfg.Probe.HTTP.ExpectStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("probe.http.expect_status: %d is not an HTTP status code", status)
 		}
-		
-		// Stop existing listener
-		d.listenerMgr.StopListener(id)
-		d.logger.Info("Stopped listener for rebinding", "endpoint", ep.URL)
-		
-		// Remove from tracking
-		delete(d.endpoints, id)
-		
-		// Store endpoint info for recreation
-		endpointsToRecreate = append(endpointsToRecreate, ngrokapi.Endpoint{
-			ID:  ep.ID,
-			URL: ep.URL,
-		})
 	}
 	
-	d.mu.Unlock()
+	// Validate cert_renew_fraction
+	if cfg.Server.CertRenewFraction <= 0 || cfg.Server.CertRenewFraction >= 1 {
+		return fmt.Errorf("cert_renew_fraction must be between 0 and 1 (exclusive)")
+	}
 	
-	// Recreate listeners immediately with new config
-	for _, ep := range endpointsToRecreate {
-		d.logger.Info("Recreating listener with new config", "endpoint", ep.URL)
-		d.addEndpoint(ep)
+	// Validate start_port
+	if cfg.Net.StartPort < 1 || cfg.Net.StartPort > 65535 {
+		return fmt.Errorf("start_port must be between 1 and 65535")
 	}
+	
+	return nil
 }
 
 func (d *Daemon) loadNetworkPortMappings(path string) error {
@@ -632,265 +1322,251 @@ func (d *Daemon) ipExistsOnMachine(ipAddr string) bool {
 	return false
 }
 
-func (d *Daemon) addEndpoint(ep ngrokapi.Endpoint) {
-	// Parse hostname and port from URL
-	hostname, port, err := ipalloc.ParseHostname(ep.URL)
-	if err != nil {
-		d.logger.Error(err, "Failed to parse endpoint", "url", ep.URL)
-		return
-	}
-	
-	// Allocate IP for hostname and port (reuses IP if port available)
-	ipStr, err := d.ipAllocator.AllocateIPForPort(hostname, port)
-	if err != nil {
-		d.logger.Error(err, "Failed to allocate IP", "hostname", hostname, "port", port)
-		return
-	}
+// Socket command implementations
+
+func (d *Daemon) GetStatus() socket.StatusResponse {
+	// Counted before taking d.mu: the reconciler takes d.mu while holding its own lock
+	endpointCount := d.endpointCount()
+	ingress := d.ingressEndpoint()
+	mismatch := d.ingressMismatch()
+	certExpiry := d.certExpiry()
 	
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		d.logger.Error(fmt.Errorf("invalid IP"), "Failed to parse allocated IP", "ip", ipStr)
-		return
-	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	
-	// Add IP to virtual interface
-	if d.netInterface != nil {
-		if err := d.netInterface.AddIP(ip); err != nil {
-			d.logger.Error(err, "Failed to add IP to interface", "ip", ipStr)
-			// Continue anyway - listener may still work
+	status := socket.StatusResponse{
+		Registered:        d.registered,
+		OperatorID:        d.operatorID,
+		EndpointCount:     endpointCount,
+		IngressEndpoint:   ingress,
+		ConfiguredIngress: d.config.IngressEndpoint,
+		RegisteredIngress: d.registeredIngress,
+		IngressMismatch:   mismatch,
+		API:               d.apiBreaker.status(),
+		CertExpiry:        certExpiry,
+	}
+	
+	if d.forwarder != nil {
+		status.IngressTLSVerify = d.forwarder.TLSVerifyMode()
+		status.IngressPins = d.forwarder.PinCount()
+		for _, state := range d.forwarder.IngressStates() {
+			ingress := socket.IngressStatus{
+				Address:   state.Address,
+				Healthy:   state.Healthy,
+				Probed:    state.Probed,
+				Preferred: state.Preferred,
+				LastProbe: state.LastProbe,
+				LastError: state.LastError,
+			}
+			if state.Probed {
+				ingress.Latency = state.Latency.Round(time.Millisecond).String()
+			}
+			if state.Preferred {
+				status.IngressEndpoint = state.Address
+			}
+			status.Ingresses = append(status.Ingresses, ingress)
 		}
 	}
 	
-	// Determine listen interface for this endpoint
-	listenInterface := d.config.Net.ListenInterface // Default
+	return status
+}
+
+// certExpiry returns the binding certificate's NotAfter, or zero if unknown
+func (d *Daemon) certExpiry() time.Time {
+	d.mu.RLock()
+	certManager := d.certManager
+	d.mu.RUnlock()
 	
-	// Check for per-endpoint override
-	if override, exists := d.config.Net.Overrides[hostname]; exists {
-		listenInterface = override
-		d.logger.Info("Using endpoint override", 
-			"hostname", hostname, 
-			"listen_interface", listenInterface)
+	if certManager == nil {
+		return time.Time{}
 	}
-	
-	// Resolve interface name to IP if needed
-	resolvedIP, err := d.resolveInterfaceToIP(listenInterface)
+	notAfter, err := certManager.CertificateExpiry()
 	if err != nil {
-		d.logger.Error(err, "❌ Failed to resolve listen_interface",
-			"endpoint", ep.URL,
-			"hostname", hostname,
-			"listen_interface", listenInterface,
-			"available_interfaces", d.listAvailableInterfaces())
-		return
-	}
-	
-	// Update listen interface with resolved IP
-	if resolvedIP != listenInterface {
-		d.logger.Info("Resolved interface name to IP",
-			"interface", listenInterface,
-			"ip", resolvedIP,
-			"hostname", hostname)
-		listenInterface = resolvedIP
-	}
-	
-	// Validate resolved interface
-	if listenInterface != "virtual" && listenInterface != "0.0.0.0" {
-		// Check if specific IP exists on machine
-		if !d.ipExistsOnMachine(listenInterface) {
-			d.logger.Error(nil, "❌ Invalid listen_interface - IP does not exist on this machine",
-				"endpoint", ep.URL,
-				"hostname", hostname,
-				"listen_interface", listenInterface,
-				"available_interfaces", d.listAvailableInterfaces())
-			return
-		}
+		return time.Time{}
 	}
+	return notAfter
+}
+
+// endpointCount returns the number of endpoints with local listeners
+func (d *Daemon) endpointCount() int {
+	d.mu.RLock()
+	r := d.reconciler
+	d.mu.RUnlock()
 	
-	// Determine listen address and port based on mode
-	var listenAddr string
-	var listenPort int
-	virtualMode := listenInterface == "virtual"
-	
-	if virtualMode {
-		// Virtual mode: unique IP, original port
-		listenAddr = ipStr
-		listenPort = port
-	} else {
-		// Network mode: specific interface, persistent port
-		listenAddr = listenInterface
-		
-		// Use hostname:port as key to support same hostname with different ports
-		endpointKey := fmt.Sprintf("%s:%d", hostname, port)
-		
-		// Check if this endpoint already has a network port assigned
-		if existingPort, exists := d.networkPortsByHost[endpointKey]; exists {
-			listenPort = existingPort
-			d.logger.V(1).Info("Reusing network port", "endpoint_key", endpointKey, "port", existingPort)
-		} else {
-			// Allocate new port
-			listenPort = d.nextPort
-			d.networkPortsByHost[endpointKey] = listenPort
-			d.nextPort++
-			d.logger.Info("Allocated network port", "endpoint_key", endpointKey, "port", listenPort)
-		}
+	if r == nil {
+		return 0
 	}
-	
-	// Create listener with retry on port conflict
-	endpoint := forwarder.BoundEndpoint{
-		Name:         ep.ID,
-		URI:          ep.URL,
-		Port:         port,
-		LocalPort:    listenPort,
-		LocalAddress: listenAddr,
+	return len(r.Endpoints())
+}
+
+// HealthEndpoint tells clients such as ngrokctl how to reach the health server.
+// The bearer token is never returned: any local user can query the socket.
+func (d *Daemon) HealthEndpoint() socket.HealthEndpoint {
+	url := d.healthServer.URL()
+	if url == "" {
+		return socket.HealthEndpoint{}
+	}
+	return socket.HealthEndpoint{
+		Enabled:      true,
+		URL:          url,
+		AuthRequired: d.config.Health.BearerToken != "",
+		Certificate:  d.healthServer.CertificatePEM(),
 	}
-	
-	ctx := context.Background()
-	localListenerOK := true
-	networkPort := 0
-	maxRetries := 20
-	
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		err := d.listenerMgr.StartListener(ctx, endpoint)
-		if err == nil {
-			// Success!
-			break
+}
+
+func (d *Daemon) ListEndpoints() []socket.EndpointInfo {
+	d.mu.RLock()
+	r := d.reconciler
+	d.mu.RUnlock()
+	
+	if r == nil {
+		return []socket.EndpointInfo{}
+	}
+	
+	endpoints := r.Endpoints()
+	result := make([]socket.EndpointInfo, 0, len(endpoints))
+	for _, ep := range endpoints {
+		info := socket.EndpointInfo{
+			ID:              ep.ID,
+			Hostname:        ep.Hostname,
+			IP:              ep.Placement.IP,
+			Port:            ep.Port,
+			URL:             ep.URL,
+			Proto:           ep.Proto,
+			LocalListener:   ep.LocalListener,
+			ListenInterface: ep.Placement.ListenInterface,
 		}
-		
-		// Check if it's a port conflict
-		if !virtualMode && (strings.Contains(err.Error(), "address already in use") || strings.Contains(err.Error(), "bind: address already in use")) {
-			// Try next port
-			d.logger.Info("Port in use, trying next port",
-				"endpoint", ep.URL,
-				"conflicted_port", listenPort,
-				"next_port", d.nextPort)
-			
-			listenPort = d.nextPort
-			d.nextPort++
-			endpoint.LocalPort = listenPort
-			
-			// Update the mapping with the new port
-			endpointKey := fmt.Sprintf("%s:%d", hostname, port)
-			d.networkPortsByHost[endpointKey] = listenPort
-			continue
+		if !ep.Placement.Virtual() {
+			info.NetworkPort = ep.Placement.ListenPort
 		}
-		
-		// Other error or max retries
-		d.logger.Error(err, "⚠️  Failed to start listener", 
-			"endpoint", ep.URL, 
-			"port", listenPort,
-			"address", listenAddr,
-			"attempt", attempt+1)
-		
-		localListenerOK = false
-		
-		if virtualMode {
-			d.logger.Error(err, "⚠️  Endpoint unavailable - port conflict on unique IP")
-		}
-		return
-	}
-	
-	// Track network port if not in virtual mode
-	if !virtualMode {
-		networkPort = listenPort
-	}
-	
-	// Log success
-	if virtualMode {
-		d.logger.Info("Started listener",
-			"endpoint", ep.URL,
-			"address", fmt.Sprintf("%s:%d", listenAddr, listenPort),
-			"mode", "virtual")
-	} else {
-		d.logger.Info("Started listener",
-			"endpoint", ep.URL,
-			"address", fmt.Sprintf("%s:%d", listenAddr, listenPort),
-			"mode", "network",
-			"accessible_from", listenInterface)
-	}
-	
-	// Register with health server
-	d.healthServer.RegisterEndpoint(ep.ID, fmt.Sprintf("%s:%d", ipStr, port), ep.URL)
-	
-	// Track endpoint with listener status
-	d.endpoints[ep.ID] = socket.EndpointInfo{
-		ID:              ep.ID,
-		Hostname:        hostname,
-		IP:              ipStr,
-		Port:            port,
-		URL:             ep.URL,
-		LocalListener:   localListenerOK,
-		NetworkPort:     networkPort,
-		ListenInterface: listenInterface,
-	}
-	
-	d.logger.Info("Added bound endpoint",
-		"hostname", hostname,
-		"ip", ipStr,
-		"port", port,
-		"url", ep.URL)
-}
-
-func (d *Daemon) removeEndpoint(id string) {
-	if ep, exists := d.endpoints[id]; exists {
-		// Stop listener
-		d.listenerMgr.StopListener(id)
-		
-		// Remove IP from interface
-		if d.netInterface != nil {
-			ip := net.ParseIP(ep.IP)
-			if ip != nil {
-				if err := d.netInterface.RemoveIP(ip); err != nil {
-					d.logger.Error(err, "Failed to remove IP from interface", "ip", ep.IP)
+		if status, ok := d.healthServer.Endpoint(ep.ID); ok {
+			info.Degraded = status.Degraded
+			info.Errors = status.Errors
+			info.LastErrorClass = status.LastErrorClass
+			info.LastErrorCode = status.LastErrorCode
+			info.LastError = status.LastError
+			if probe := status.Probe; probe != nil {
+				info.Probe = &socket.ProbeInfo{
+					OK:                  probe.OK,
+					Time:                probe.Time,
+					Latency:             probe.Latency.Round(time.Millisecond).String(),
+					StatusCode:          probe.StatusCode,
+					ErrorClass:          probe.ErrorClass,
+					ErrorCode:           probe.ErrorCode,
+					Error:               probe.Error,
+					ConsecutiveFailures: probe.ConsecutiveFailures,
 				}
 			}
 		}
-		
-		// Release IP
-		d.ipAllocator.ReleaseIP(ep.Hostname)
-		
-		// Remove from tracking
-		delete(d.endpoints, id)
-		
-		d.logger.Info("Removed bound endpoint", "hostname", ep.Hostname, "ip", ep.IP)
+		result = append(result, info)
 	}
+	return result
 }
 
-func (d *Daemon) updateHosts() {
-	mappings := d.ipAllocator.GetAllMappings()
-	if err := d.hostsManager.UpdateHosts(mappings); err != nil {
-		d.logger.Error(err, "Failed to update /etc/hosts")
+// Connections returns forwarded traffic per endpoint and the most recently
+// finished connections. A non-empty endpoint limits both to the endpoint
+// with that ID or URL.
+func (d *Daemon) Connections(endpoint string) socket.ConnectionsResponse {
+	matches := func(id, url string) bool {
+		return endpoint == "" || endpoint == id || endpoint == url
 	}
-}
-
-// Socket command implementations
-
-func (d *Daemon) GetStatus() socket.StatusResponse {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
 	
-	return socket.StatusResponse{
-		Registered:      d.registered,
-		OperatorID:      d.operatorID,
-		EndpointCount:   len(d.endpoints),
-		IngressEndpoint: d.config.IngressEndpoint,
+	resp := socket.ConnectionsResponse{
+		Endpoints: []socket.EndpointTraffic{},
+		Recent:    []socket.ConnectionInfo{},
 	}
+	for _, ep := range d.healthServer.Endpoints() {
+		if !matches(ep.Name, ep.TargetURI) {
+			continue
+		}
+		resp.Endpoints = append(resp.Endpoints, socket.EndpointTraffic{
+			ID:                ep.Name,
+			URL:               ep.TargetURI,
+			Active:            ep.Connections,
+			Connections:       ep.TotalConnections,
+			BytesIn:           ep.BytesIn,
+			BytesOut:          ep.BytesOut,
+			ConnectionSeconds: ep.ConnectionSeconds,
+		})
+	}
+	for _, conn := range d.healthServer.RecentConnections() {
+		if !matches(conn.Endpoint, conn.TargetURI) {
+			continue
+		}
+		resp.Recent = append(resp.Recent, socket.ConnectionInfo{
+			EndpointID:  conn.Endpoint,
+			URL:         conn.TargetURI,
+			ClientAddr:  conn.ClientAddr,
+			Start:       conn.Start,
+			Duration:    conn.Duration.Round(time.Millisecond).String(),
+			BytesIn:     conn.BytesIn,
+			BytesOut:    conn.BytesOut,
+			CloseReason: conn.CloseReason,
+		})
+	}
+	return resp
 }
 
-func (d *Daemon) ListEndpoints() []socket.EndpointInfo {
+// Plan fetches the bound endpoints and returns the changes the next
+// reconciliation would make, without applying them
+func (d *Daemon) Plan() (socket.PlanResponse, error) {
 	d.mu.RLock()
-	defer d.mu.RUnlock()
+	r := d.reconciler
+	operatorID := d.operatorID
+	selectors := d.selectors
+	d.mu.RUnlock()
 	
-	result := make([]socket.EndpointInfo, 0, len(d.endpoints))
-	for _, ep := range d.endpoints {
-		result = append(result, ep)
+	if r == nil {
+		return socket.PlanResponse{}, fmt.Errorf("daemon is not registered")
 	}
-	return result
+	
+	ctx, cancel := context.WithTimeout(d.ctx, time.Duration(d.config.API.Timeout)*time.Second)
+	defer cancel()
+	
+	apiEndpoints, err := d.apiClient.ListBoundEndpoints(ctx, operatorID)
+	if err != nil {
+		return socket.PlanResponse{}, fmt.Errorf("failed to fetch bound endpoints: %w", err)
+	}
+	
+	plan := r.Plan(selectors.Filter(apiEndpoints))
+	
+	resp := socket.PlanResponse{
+		Changes:   make([]socket.PlannedChange, 0, len(plan.Changes)),
+		Unchanged: plan.Unchanged,
+	}
+	for _, c := range plan.Changes {
+		pc := socket.PlannedChange{
+			Action:        string(c.Action),
+			EndpointID:    c.ID(),
+			URL:           c.URL(),
+			Hostname:      c.Hostname,
+			IP:            c.Placement.IP,
+			Port:          c.Port,
+			ListenAddress: c.Placement.ListenAddress,
+			ListenPort:    c.Placement.ListenPort,
+			Mode:          "network",
+		}
+		if c.Placement.Virtual() {
+			pc.Mode = "virtual"
+		}
+		for _, f := range c.Fields {
+			pc.Changes = append(pc.Changes, socket.FieldChange{Field: f.Field, Old: f.Old, New: f.New})
+		}
+		if c.Err != nil {
+			pc.Error = c.Err.Error()
+		}
+		resp.Changes = append(resp.Changes, pc)
+	}
+	
+	return resp, nil
 }
 
 func (d *Daemon) SetAPIKey(key string) error {
 	d.mu.Lock()
 	
-	// Update in-memory config
+	// Update in-memory config and the shared API client
 	d.config.API.Key = key
+	d.apiClient.SetAPIKey(key)
 	
 	d.mu.Unlock()
 	
@@ -900,28 +1576,9 @@ func (d *Daemon) SetAPIKey(key string) error {
 		return fmt.Errorf("failed to save API key to config: %w", err)
 	}
 	
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	
-	// If not registered, register now
-	if !d.registered {
-		d.mu.Unlock() // Unlock before register (it needs lock)
-		if err := d.register(); err != nil {
-			d.mu.Lock()
-			return err
-		}
-		d.mu.Lock()
-		
-		// Initialize forwarder
-		if err := d.initializeForwarder(); err != nil {
-			return err
-		}
-		
-		// Start polling
-		go d.pollingLoop()
-	}
-	
-	return nil
+	// Register now if this is the first key, then start polling and
+	// certificate renewal
+	return d.ensureRegistered()
 }
 
 func (d *Daemon) saveAPIKeyToConfig(apiKey string) error {
@@ -0,0 +1,26 @@
+package daemon
+
+import "testing"
+
+func TestIsClientCertEvent(t *testing.T) {
+	const cert, key = "/etc/ngrokd/tls.crt", "/etc/ngrokd/tls.key"
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"/etc/ngrokd/tls.crt", true},
+		{"/etc/ngrokd/tls.key", true},
+		{"/etc/ngrokd/..data", true},
+		{"/etc/ngrokd/..data_tmp", true},
+		{"/etc/ngrokd/config.yml", false},
+		{"/etc/ngrokd/..data/tls.crt", false},
+		{"/var/lib/..data", false},
+	}
+
+	for _, tt := range tests {
+		if got := isClientCertEvent(tt.name, cert, key); got != tt.want {
+			t.Errorf("isClientCertEvent(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -51,7 +51,7 @@ func (d *Daemon) resolveInterfaceToIP(interfaceSpec string) (string, error) {
 			continue
 		}
 		
-		d.logger.Info("Resolved interface to IP",
+		d.logger.V(1).Info("Resolved interface to IP",
 			"interface", interfaceSpec,
 			"ip", ip.String())
 		
@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/metrics"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
+)
+
+// Poll outcomes exported on /metrics
+const (
+	pollSuccess    = "success"
+	pollError      = "error"
+	pollIncomplete = "incomplete" // some pages fetched, reconciliation skipped
+)
+
+// pollMetrics tracks how long bound endpoint polls take and how they end
+type pollMetrics struct {
+	duration *metrics.Histogram
+	outcomes *metrics.CounterVec
+}
+
+func newPollMetrics() *pollMetrics {
+	return &pollMetrics{
+		duration: metrics.NewHistogram(metrics.LatencyBuckets),
+		outcomes: metrics.NewCounterVec(),
+	}
+}
+
+// record counts one poll of the ngrok API
+func (p *pollMetrics) record(took time.Duration, err error) {
+	p.duration.ObserveDuration(took)
+
+	var pageErr *ngrokapi.PaginationError
+	switch {
+	case err == nil:
+		p.outcomes.Inc(pollSuccess)
+	case errors.As(err, &pageErr):
+		p.outcomes.Inc(pollIncomplete)
+	default:
+		p.outcomes.Inc(pollError)
+	}
+}
+
+// writeMetrics adds the daemon's poll, certificate and ingress metrics to /metrics
+func (d *Daemon) writeMetrics(w *metrics.Writer) {
+	w.Family("ngrokd_poll_duration_seconds", "histogram", "Time to fetch the bound endpoint list from the ngrok API.")
+	w.Histogram("ngrokd_poll_duration_seconds", d.pollMetrics.duration)
+
+	w.Family("ngrokd_polls_total", "counter", "Bound endpoint polls by outcome.")
+	w.CounterVec("ngrokd_polls_total", "outcome", d.pollMetrics.outcomes)
+
+	if expiry := d.certExpiry(); !expiry.IsZero() {
+		w.Family("ngrokd_certificate_expiry_timestamp_seconds", "gauge", "Unix time the binding certificate expires.")
+		w.Sample("ngrokd_certificate_expiry_timestamp_seconds", float64(expiry.Unix()))
+	}
+
+	d.mu.RLock()
+	fwd := d.forwarder
+	d.mu.RUnlock()
+	if fwd != nil {
+		fwd.WriteMetrics(w)
+	}
+}
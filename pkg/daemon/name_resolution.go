@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/dns"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/reconciler"
+)
+
+// DNS modes (dns.mode)
+const (
+	dnsModeHosts  = "hosts"  // write /etc/hosts (default)
+	dnsModeServer = "server" // embedded DNS server only
+	dnsModeBoth   = "both"   // both of the above
+)
+
+// hostsTargets publishes hostname -> IP mappings to several destinations
+type hostsTargets []reconciler.Hosts
+
+// UpdateHosts updates every target, returning all errors
+func (t hostsTargets) UpdateHosts(mappings map[string]string) error {
+	var errs []error
+	for _, target := range t {
+		if err := target.UpdateHosts(mappings); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// startNameResolution sets up /etc/hosts and/or the embedded DNS server
+// according to dns.mode
+func (d *Daemon) startNameResolution() error {
+	mode := d.config.DNS.Mode
+	switch mode {
+	case dnsModeHosts, dnsModeServer, dnsModeBoth:
+	default:
+		return fmt.Errorf("invalid dns.mode %q: must be 'hosts', 'server' or 'both'", mode)
+	}
+
+	if mode == dnsModeHosts || mode == dnsModeBoth {
+		d.hostsTargets = append(d.hostsTargets, d.hostsManager)
+	} else {
+		// Drop entries left behind by an earlier run in hosts mode
+		if err := d.hostsManager.RemoveAll(); err != nil {
+			d.logger.V(1).Info("Could not clean up /etc/hosts", "error", err)
+		}
+	}
+
+	if mode == dnsModeServer || mode == dnsModeBoth {
+		d.dnsServer = dns.NewServer(dns.Config{
+			Address:   d.config.DNS.Listen,
+			TTL:       d.config.DNS.TTL,
+			Upstreams: d.config.DNS.Upstreams,
+			Logger:    d.logger,
+		})
+		if err := d.dnsServer.Start(); err != nil {
+			return fmt.Errorf("failed to start DNS server: %w", err)
+		}
+		d.hostsTargets = append(d.hostsTargets, d.dnsServer)
+	}
+
+	d.logger.Info("Name resolution configured", "mode", mode)
+	return nil
+}
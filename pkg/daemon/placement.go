@@ -0,0 +1,150 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/reconciler"
+)
+
+// placer decides where endpoints listen: a unique virtual IP on the
+// endpoint's own port, or a persistent port on a shared network interface.
+// It implements reconciler.Allocator.
+type placer struct {
+	d *Daemon
+}
+
+// listenInterface returns the resolved listen interface for a hostname
+func (p placer) listenInterface(hostname string) (string, error) {
+	d := p.d
+
+	d.mu.RLock()
+	listenInterface := d.config.Net.ListenInterface
+	if override, exists := d.config.Net.Overrides[hostname]; exists {
+		listenInterface = override
+		d.logger.V(1).Info("Using endpoint override",
+			"hostname", hostname,
+			"listen_interface", listenInterface)
+	}
+	d.mu.RUnlock()
+
+	resolvedIP, err := d.resolveInterfaceToIP(listenInterface)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve listen_interface %q (available: %s): %w",
+			listenInterface, strings.Join(d.listAvailableInterfaces(), ", "), err)
+	}
+
+	if resolvedIP != "virtual" && resolvedIP != "0.0.0.0" && !d.ipExistsOnMachine(resolvedIP) {
+		return "", fmt.Errorf("invalid listen_interface %q - IP does not exist on this machine (available: %s)",
+			resolvedIP, strings.Join(d.listAvailableInterfaces(), ", "))
+	}
+
+	return resolvedIP, nil
+}
+
+// Preview returns the placement Allocate would produce without reserving anything
+func (p placer) Preview(hostname string, port int) (reconciler.Placement, error) {
+	d := p.d
+
+	listenInterface, err := p.listenInterface(hostname)
+	if err != nil {
+		return reconciler.Placement{}, err
+	}
+
+	ip, err := d.ipAllocator.PreviewIPForPort(hostname, port)
+	if err != nil {
+		return reconciler.Placement{}, err
+	}
+
+	if listenInterface == "virtual" {
+		return reconciler.Placement{IP: ip, ListenInterface: listenInterface, ListenAddress: ip, ListenPort: port}, nil
+	}
+
+	d.mu.RLock()
+	listenPort, exists := d.networkPortsByHost[networkPortKey(hostname, port)]
+	if !exists {
+		listenPort = d.nextPort
+	}
+	d.mu.RUnlock()
+
+	return reconciler.Placement{IP: ip, ListenInterface: listenInterface, ListenAddress: listenInterface, ListenPort: listenPort}, nil
+}
+
+// Allocate reserves an IP for the hostname and, in network mode, a
+// persistent listen port
+func (p placer) Allocate(hostname string, port int) (reconciler.Placement, error) {
+	d := p.d
+
+	// Resolve first so a bad interface doesn't leave an IP allocated
+	listenInterface, err := p.listenInterface(hostname)
+	if err != nil {
+		return reconciler.Placement{}, err
+	}
+
+	// Allocate IP for hostname and port (reuses IP if port available)
+	ip, err := d.ipAllocator.AllocateIPForPort(hostname, port)
+	if err != nil {
+		return reconciler.Placement{}, fmt.Errorf("failed to allocate IP: %w", err)
+	}
+
+	if listenInterface == "virtual" {
+		// Virtual mode: unique IP, original port
+		return reconciler.Placement{IP: ip, ListenInterface: listenInterface, ListenAddress: ip, ListenPort: port}, nil
+	}
+
+	// Network mode: specific interface, persistent port.
+	// hostname:port is the key so one hostname can expose several ports.
+	endpointKey := networkPortKey(hostname, port)
+
+	d.mu.Lock()
+	listenPort, exists := d.networkPortsByHost[endpointKey]
+	if exists {
+		d.logger.V(1).Info("Reusing network port", "endpoint_key", endpointKey, "port", listenPort)
+	} else {
+		listenPort = d.nextPort
+		d.networkPortsByHost[endpointKey] = listenPort
+		d.nextPort++
+		d.logger.Info("Allocated network port", "endpoint_key", endpointKey, "port", listenPort)
+	}
+	d.mu.Unlock()
+
+	return reconciler.Placement{IP: ip, ListenInterface: listenInterface, ListenAddress: listenInterface, ListenPort: listenPort}, nil
+}
+
+// Reassign moves a network-mode endpoint to the next free port after a bind conflict
+func (p placer) Reassign(hostname string, port int, current reconciler.Placement) (reconciler.Placement, error) {
+	d := p.d
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.nextPort > 65535 {
+		return current, fmt.Errorf("no network ports left above %d", d.config.Net.StartPort)
+	}
+
+	current.ListenPort = d.nextPort
+	d.networkPortsByHost[networkPortKey(hostname, port)] = d.nextPort
+	d.nextPort++
+
+	return current, nil
+}
+
+// Release frees the endpoint's port on its IP, or the hostname's whole IP
+// allocation when releaseIP is set. Network port mappings are kept so the
+// endpoint gets the same port if it comes back.
+func (p placer) Release(hostname string, port int, releaseIP bool) {
+	if releaseIP {
+		p.d.ipAllocator.ReleaseIP(hostname)
+		return
+	}
+	p.d.ipAllocator.ReleasePort(hostname, port)
+}
+
+// Mappings returns all hostname -> IP allocations
+func (p placer) Mappings() map[string]string {
+	return p.d.ipAllocator.GetAllMappings()
+}
+
+func networkPortKey(hostname string, port int) string {
+	return fmt.Sprintf("%s:%d", hostname, port)
+}
@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/forwarder"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/health"
+)
+
+// probeConcurrency bounds how many endpoints are probed at once
+const probeConcurrency = 8
+
+// probeErrorStatus is the error class of an HTTP probe that got an
+// unexpected status code
+const probeErrorStatus = "status"
+
+// probeLoop periodically probes every endpoint with a local listener
+// through the forwarder, so endpoints whose binding rejects connections
+// show up before clients hit them
+func (d *Daemon) probeLoop() {
+	defer d.loops.Done()
+
+	cfg := d.config.Probe
+	interval := time.Duration(cfg.Interval) * time.Second
+	timeout := time.Duration(cfg.Timeout) * time.Second
+
+	var req *forwarder.HTTPProbe
+	if cfg.HTTP.Path != "" {
+		req = &forwarder.HTTPProbe{
+			Method:       cfg.HTTP.Method,
+			Path:         cfg.HTTP.Path,
+			ExpectStatus: cfg.HTTP.ExpectStatus,
+		}
+	}
+
+	d.logger.Info("Starting endpoint prober",
+		"interval", interval,
+		"timeout", timeout,
+		"http_path", cfg.HTTP.Path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			d.logger.Info("Endpoint prober stopped")
+			return
+		case <-ticker.C:
+			d.probeEndpoints(req, timeout)
+		}
+	}
+}
+
+// probeEndpoints probes the endpoints with a local listener and records
+// the results on the health server
+func (d *Daemon) probeEndpoints(req *forwarder.HTTPProbe, timeout time.Duration) {
+	d.mu.RLock()
+	fwd, mgr := d.forwarder, d.listenerMgr
+	d.mu.RUnlock()
+
+	if fwd == nil || mgr == nil {
+		return
+	}
+
+	sem := make(chan struct{}, probeConcurrency)
+	var wg sync.WaitGroup
+	for _, ep := range mgr.ActiveEndpoints() {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := fwd.ProbeEndpoint(ep, req, timeout)
+			d.healthServer.RecordProbe(ep.Name, probeStatus(result))
+		}()
+	}
+	wg.Wait()
+}
+
+// probeStatus converts a probe result for the health server
+func probeStatus(result forwarder.ProbeResult) health.ProbeStatus {
+	status := health.ProbeStatus{
+		OK:         result.Err == nil,
+		Latency:    result.Latency,
+		StatusCode: result.StatusCode,
+	}
+	if result.Err == nil {
+		return status
+	}
+
+	status.Error = result.Err.Error()
+	if result.StatusCode != 0 {
+		status.ErrorClass = probeErrorStatus
+		return status
+	}
+
+	failure := forwarder.Classify(result.Err)
+	status.ErrorClass = failure.Class
+	status.ErrorCode = failure.Code
+	if failure.Message != "" {
+		status.Error = failure.Message
+	}
+	return status
+}
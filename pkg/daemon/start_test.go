@@ -0,0 +1,130 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/netif"
+)
+
+// fakeInterface records whether it was created and destroyed
+type fakeInterface struct {
+	created, destroyed bool
+}
+
+func (i *fakeInterface) Name() string               { return "ngrokd-test" }
+func (i *fakeInterface) Create(subnet string) error { i.created = true; return nil }
+func (i *fakeInterface) Destroy() error             { i.destroyed = true; return nil }
+func (i *fakeInterface) AddIP(ip net.IP) error      { return nil }
+func (i *fakeInterface) RemoveIP(ip net.IP) error   { return nil }
+
+// freePort returns a port that was free on 127.0.0.1 for TCP and UDP
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	pc, err := net.ListenPacket("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Skipf("port %d is free for TCP but not UDP", port)
+	}
+	pc.Close()
+	return port
+}
+
+func TestStartTearsDownWhenHealthPortIsTaken(t *testing.T) {
+	dir := t.TempDir()
+	hostsPath := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(hostsPath, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NGROKD_HOSTS_PATH", hostsPath)
+
+	iface := &fakeInterface{}
+	newNetInterface = func(netif.Config) (netif.Interface, error) { return iface, nil }
+	t.Cleanup(func() { newNetInterface = netif.New })
+
+	// Hold the health port so the health server can't bind it
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	socketPath := filepath.Join(dir, "ngrokd.sock")
+	dnsAddr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	configPath := filepath.Join(dir, "config.yml")
+	config := fmt.Sprintf(`ingress:
+  tls_verify: ca
+server:
+  socket_path: %s
+  client_cert: %s
+  shutdown_timeout: 1
+health:
+  address: 127.0.0.1
+  port: %d
+dns:
+  mode: server
+  listen: %s
+`, socketPath, filepath.Join(dir, "tls.crt"), taken.Addr().(*net.TCPAddr).Port, dnsAddr)
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := New(configPath, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Start()
+	if err == nil || !strings.Contains(err.Error(), "health server") {
+		t.Fatalf("Start() = %v, want a health server error", err)
+	}
+
+	if !iface.created || !iface.destroyed {
+		t.Errorf("interface created %v, destroyed %v; want both", iface.created, iface.destroyed)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("socket file left behind: %v", err)
+	}
+
+	// The DNS listeners were closed, so the address can be bound again
+	ln, err := net.Listen("tcp", dnsAddr)
+	if err != nil {
+		t.Errorf("DNS TCP listener left behind: %v", err)
+	} else {
+		ln.Close()
+	}
+	pc, err := net.ListenPacket("udp", dnsAddr)
+	if err != nil {
+		t.Errorf("DNS UDP listener left behind: %v", err)
+	} else {
+		pc.Close()
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yml")
+	config := `ingress:
+  dial_timeout: -1
+`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := New(configPath, logr.Discard())
+	if err == nil || !strings.Contains(err.Error(), "ingress.dial_timeout") {
+		t.Fatalf("New() = %v, want an ingress.dial_timeout error", err)
+	}
+}
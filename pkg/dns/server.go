@@ -0,0 +1,435 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	defaultTTL = 30
+
+	// upstreamTimeout bounds each forwarded query
+	upstreamTimeout = 2 * time.Second
+
+	// tcpIdleTimeout closes idle TCP client connections
+	tcpIdleTimeout = 10 * time.Second
+
+	maxUDPSize = 4096
+
+	// maxUDPWorkers bounds the UDP queries handled at once; further
+	// packets wait in the socket buffer
+	maxUDPWorkers = 64
+)
+
+// Server is an embedded DNS resolver that answers A/AAAA queries for
+// managed hostnames and forwards or refuses everything else
+type Server struct {
+	addr      string
+	ttl       uint32
+	upstreams []string
+	logger    logr.Logger
+
+	mu      sync.RWMutex
+	records map[string]net.IP // lowercased FQDN (with trailing dot) -> IP
+
+	udp     *net.UDPConn
+	tcp     net.Listener
+	workers chan struct{} // UDP worker slots
+	wg      sync.WaitGroup
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{} // open TCP client connections
+	stopped bool
+}
+
+// Config holds the DNS server configuration
+type Config struct {
+	Address   string   // host:port to listen on (UDP and TCP)
+	TTL       int      // TTL in seconds for managed records
+	Upstreams []string // Resolvers (host:port) for other names; empty refuses them
+	Logger    logr.Logger
+}
+
+// NewServer creates a new DNS server
+func NewServer(config Config) *Server {
+	if config.TTL <= 0 {
+		config.TTL = defaultTTL
+	}
+
+	upstreams := make([]string, 0, len(config.Upstreams))
+	for _, u := range config.Upstreams {
+		if _, _, err := net.SplitHostPort(u); err != nil {
+			u = net.JoinHostPort(u, "53")
+		}
+		upstreams = append(upstreams, u)
+	}
+
+	return &Server{
+		addr:      config.Address,
+		ttl:       uint32(config.TTL),
+		upstreams: upstreams,
+		logger:    config.Logger,
+		records:   make(map[string]net.IP),
+		workers:   make(chan struct{}, maxUDPWorkers),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Start starts listening on UDP and TCP
+func (s *Server) Start() error {
+	udpAddr, err := net.ResolveUDPAddr("udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("invalid DNS listen address %s: %w", s.addr, err)
+	}
+
+	s.udp, err = net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s/udp: %w", s.addr, err)
+	}
+
+	s.tcp, err = net.Listen("tcp", s.addr)
+	if err != nil {
+		s.udp.Close()
+		return fmt.Errorf("failed to listen on %s/tcp: %w", s.addr, err)
+	}
+
+	s.logger.Info("Starting DNS server",
+		"address", s.addr,
+		"upstreams", s.upstreams,
+		"ttl", s.ttl)
+
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+
+	return nil
+}
+
+// Stop stops the DNS server, closing open TCP connections, and waits for
+// in-flight queries to finish
+func (s *Server) Stop() error {
+	s.logger.Info("Stopping DNS server")
+
+	var errs []error
+	if s.udp != nil {
+		errs = append(errs, s.udp.Close())
+	}
+	if s.tcp != nil {
+		errs = append(errs, s.tcp.Close())
+	}
+
+	s.connsMu.Lock()
+	s.stopped = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsMu.Unlock()
+
+	s.wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// UpdateHosts replaces the managed records with the given hostname -> IP mappings
+func (s *Server) UpdateHosts(mappings map[string]string) error {
+	records := make(map[string]net.IP, len(mappings))
+	for hostname, ipStr := range mappings {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			s.logger.Info("Skipping invalid IP for DNS record", "hostname", hostname, "ip", ipStr)
+			continue
+		}
+		records[canonicalName(hostname)] = ip
+	}
+
+	s.mu.Lock()
+	s.records = records
+	s.mu.Unlock()
+
+	s.logger.V(1).Info("DNS records updated", "entries", len(records))
+	return nil
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, addr, err := s.udp.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.logger.Error(err, "DNS UDP read failed")
+			continue
+		}
+
+		query := make([]byte, n)
+		copy(query, buf[:n])
+
+		// Wait for a free worker rather than start one per packet
+		s.workers <- struct{}{}
+		s.wg.Add(1)
+		go func() {
+			defer func() {
+				<-s.workers
+				s.wg.Done()
+			}()
+
+			resp := s.handle("udp", query)
+			if resp == nil {
+				return
+			}
+			if _, err := s.udp.WriteToUDP(resp, addr); err != nil {
+				s.logger.V(1).Info("DNS UDP write failed", "client", addr.String(), "error", err)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.logger.Error(err, "DNS TCP accept failed")
+			continue
+		}
+
+		if !s.trackConn(conn) {
+			conn.Close()
+			return
+		}
+		s.wg.Add(1)
+		go s.handleTCPConn(conn)
+	}
+}
+
+// trackConn records an open TCP connection so Stop can close it. It
+// returns false once the server is stopping.
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	if s.stopped {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// handleTCPConn serves length-prefixed queries until the client is idle or closes
+func (s *Server) handleTCPConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.connsMu.Lock()
+		delete(s.conns, conn)
+		s.connsMu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+
+		query, err := readTCPMessage(conn)
+		if err != nil {
+			return
+		}
+
+		resp := s.handle("tcp", query)
+		if resp == nil {
+			return
+		}
+
+		if err := writeTCPMessage(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a single query. It returns nil if the query is unparseable.
+func (s *Server) handle(network string, query []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+
+	questions, err := p.AllQuestions()
+	if err != nil || len(questions) != 1 || header.Response {
+		return s.reply(header, questions, dnsmessage.RCodeFormatError, nil, false)
+	}
+
+	q := questions[0]
+	name := strings.ToLower(q.Name.String())
+
+	s.mu.RLock()
+	ip, managed := s.records[name]
+	s.mu.RUnlock()
+
+	if !managed {
+		if len(s.upstreams) == 0 || header.OpCode != 0 {
+			return s.reply(header, questions, dnsmessage.RCodeRefused, nil, false)
+		}
+
+		resp, err := s.forward(network, query)
+		if err != nil {
+			s.logger.V(1).Info("DNS forward failed", "name", name, "error", err)
+			return s.reply(header, questions, dnsmessage.RCodeServerFailure, nil, false)
+		}
+		return resp
+	}
+
+	s.logger.V(1).Info("DNS query", "name", name, "type", q.Type.String(), "ip", ip.String())
+
+	// Managed names only have A or AAAA records; other types get an
+	// empty NOERROR answer so resolvers don't fall back elsewhere
+	var answer *dnsmessage.Resource
+	hdr := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: s.ttl}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		if q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL {
+			hdr.Type = dnsmessage.TypeA
+			answer = &dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: [4]byte(ip4)}}
+		}
+	} else if q.Type == dnsmessage.TypeAAAA || q.Type == dnsmessage.TypeALL {
+		hdr.Type = dnsmessage.TypeAAAA
+		answer = &dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}}
+	}
+
+	return s.reply(header, questions, dnsmessage.RCodeSuccess, answer, true)
+}
+
+// reply builds a response to the query header and questions
+func (s *Server) reply(query dnsmessage.Header, questions []dnsmessage.Question, rcode dnsmessage.RCode, answer *dnsmessage.Resource, authoritative bool) []byte {
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), dnsmessage.Header{
+		ID:                 query.ID,
+		Response:           true,
+		OpCode:             query.OpCode,
+		Authoritative:      authoritative,
+		RecursionDesired:   query.RecursionDesired,
+		RecursionAvailable: len(s.upstreams) > 0,
+		RCode:              rcode,
+	})
+	b.EnableCompression()
+
+	if err := b.StartQuestions(); err != nil {
+		return nil
+	}
+	for _, q := range questions {
+		if err := b.Question(q); err != nil {
+			return nil
+		}
+	}
+
+	if answer != nil {
+		if err := b.StartAnswers(); err != nil {
+			return nil
+		}
+
+		var err error
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			err = b.AResource(answer.Header, *body)
+		case *dnsmessage.AAAAResource:
+			err = b.AAAAResource(answer.Header, *body)
+		}
+		if err != nil {
+			return nil
+		}
+	}
+
+	msg, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+// forward relays a query to the upstream resolvers in order, returning the first response
+func (s *Server) forward(network string, query []byte) ([]byte, error) {
+	var lastErr error
+	for _, upstream := range s.upstreams {
+		resp, err := exchange(network, upstream, query)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// exchange sends one query to a resolver and reads the response
+func exchange(network, upstream string, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(network, upstream, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(conn)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, maxUDPSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// readTCPMessage reads a 2-byte length-prefixed DNS message
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeTCPMessage writes a 2-byte length-prefixed DNS message
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// canonicalName lowercases a hostname and adds the trailing dot
+func canonicalName(hostname string) string {
+	name := strings.ToLower(hostname)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
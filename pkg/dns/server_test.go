@@ -0,0 +1,315 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newQuery builds a query for name and type with the given ID
+func newQuery(t *testing.T, id uint16, name string, qtype dnsmessage.Type) []byte {
+	t.Helper()
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  qtype,
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func parseResponse(t *testing.T, resp []byte) dnsmessage.Message {
+	t.Helper()
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		t.Fatalf("unparseable response: %v", err)
+	}
+	if !msg.Header.Response {
+		t.Error("response flag not set")
+	}
+	return msg
+}
+
+// startServer starts a server on loopback with the given records
+func startServer(t *testing.T, upstreams []string, records map[string]string) *Server {
+	t.Helper()
+
+	s := NewServer(Config{Address: "127.0.0.1:0", TTL: 60, Upstreams: upstreams, Logger: logr.Discard()})
+	s.UpdateHosts(records)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Stop() })
+	return s
+}
+
+func TestHandle(t *testing.T) {
+	s := NewServer(Config{TTL: 60, Logger: logr.Discard()})
+	s.UpdateHosts(map[string]string{
+		"api.ngrok.app": "10.107.0.5",
+		"v6.ngrok.app":  "fd00::5",
+		"bad.ngrok.app": "not-an-ip",
+	})
+
+	tests := []struct {
+		name   string
+		qname  string
+		qtype  dnsmessage.Type
+		rcode  dnsmessage.RCode
+		answer string // "" for no answer
+	}{
+		{"A", "api.ngrok.app.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, "10.107.0.5"},
+		{"case insensitive", "API.Ngrok.App.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, "10.107.0.5"},
+		{"AAAA", "v6.ngrok.app.", dnsmessage.TypeAAAA, dnsmessage.RCodeSuccess, "fd00::5"},
+		{"AAAA for an IPv4 record", "api.ngrok.app.", dnsmessage.TypeAAAA, dnsmessage.RCodeSuccess, ""},
+		{"A for an IPv6 record", "v6.ngrok.app.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, ""},
+		{"other type", "api.ngrok.app.", dnsmessage.TypeMX, dnsmessage.RCodeSuccess, ""},
+		{"unmanaged without upstreams", "example.com.", dnsmessage.TypeA, dnsmessage.RCodeRefused, ""},
+		{"invalid IP skipped", "bad.ngrok.app.", dnsmessage.TypeA, dnsmessage.RCodeRefused, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := parseResponse(t, s.handle("udp", newQuery(t, 42, tt.qname, tt.qtype)))
+
+			if msg.Header.ID != 42 {
+				t.Errorf("ID = %d, want 42", msg.Header.ID)
+			}
+			if msg.Header.RCode != tt.rcode {
+				t.Errorf("rcode = %s, want %s", msg.Header.RCode, tt.rcode)
+			}
+			if len(msg.Questions) != 1 || msg.Questions[0].Name.String() != tt.qname {
+				t.Errorf("questions = %v, want the query echoed", msg.Questions)
+			}
+
+			if tt.answer == "" {
+				if len(msg.Answers) != 0 {
+					t.Errorf("answers = %v, want none", msg.Answers)
+				}
+				return
+			}
+			if len(msg.Answers) != 1 {
+				t.Fatalf("answers = %v, want one", msg.Answers)
+			}
+			if !msg.Header.Authoritative {
+				t.Error("managed answer isn't authoritative")
+			}
+			answer := msg.Answers[0]
+			if answer.Header.TTL != 60 {
+				t.Errorf("TTL = %d, want 60", answer.Header.TTL)
+			}
+			var got net.IP
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				got = body.A[:]
+			case *dnsmessage.AAAAResource:
+				got = body.AAAA[:]
+			}
+			if !got.Equal(net.ParseIP(tt.answer)) {
+				t.Errorf("answer = %v, want %s", answer.Body, tt.answer)
+			}
+		})
+	}
+}
+
+func TestHandleMalformed(t *testing.T) {
+	s := NewServer(Config{Logger: logr.Discard()})
+
+	if resp := s.handle("udp", []byte{0x01}); resp != nil {
+		t.Errorf("response to a truncated header = %x, want none", resp)
+	}
+
+	// A header with no questions
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 7})
+	query, _ := b.Finish()
+	if msg := parseResponse(t, s.handle("udp", query)); msg.Header.RCode != dnsmessage.RCodeFormatError {
+		t.Errorf("rcode = %s, want %s", msg.Header.RCode, dnsmessage.RCodeFormatError)
+	}
+}
+
+// startUpstream starts a UDP resolver that answers every query with
+// answer, or never answers if answer is nil
+func startUpstream(t *testing.T, answer net.IP) string {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, maxUDPSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if answer == nil {
+				continue
+			}
+
+			var p dnsmessage.Parser
+			header, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RecursionAvailable: true})
+			b.StartQuestions()
+			b.Question(q)
+			b.StartAnswers()
+			b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 300}, dnsmessage.AResource{A: [4]byte(answer.To4())})
+			resp, _ := b.Finish()
+			conn.WriteToUDP(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// exchangeUDP sends a query to the server over UDP and parses the response
+func exchangeUDP(t *testing.T, s *Server, query []byte) dnsmessage.Message {
+	t.Helper()
+
+	conn, err := net.Dial("udp", s.udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write(query); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxUDPSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseResponse(t, buf[:n])
+}
+
+func TestForwardsUnmanagedNames(t *testing.T) {
+	upstream := startUpstream(t, net.IPv4(93, 184, 216, 34))
+	silent := startUpstream(t, nil)
+	s := startServer(t, []string{silent, upstream}, map[string]string{"api.ngrok.app": "10.107.0.5"})
+
+	// The silent upstream times out, so the next one answers
+	msg := exchangeUDP(t, s, newQuery(t, 9, "example.com.", dnsmessage.TypeA))
+	if msg.Header.ID != 9 || msg.Header.RCode != dnsmessage.RCodeSuccess || len(msg.Answers) != 1 {
+		t.Fatalf("response = %+v, want the upstream's answer", msg)
+	}
+	if a, ok := msg.Answers[0].Body.(*dnsmessage.AResource); !ok || net.IP(a.A[:]).String() != "93.184.216.34" {
+		t.Errorf("answer = %v, want 93.184.216.34", msg.Answers[0].Body)
+	}
+
+	// Managed names are still answered locally
+	msg = exchangeUDP(t, s, newQuery(t, 10, "api.ngrok.app.", dnsmessage.TypeA))
+	if !msg.Header.Authoritative || len(msg.Answers) != 1 {
+		t.Errorf("managed response = %+v, want a local authoritative answer", msg)
+	}
+}
+
+func TestForwardFailureIsServFail(t *testing.T) {
+	s := startServer(t, []string{startUpstream(t, nil)}, nil)
+
+	msg := exchangeUDP(t, s, newQuery(t, 3, "example.com.", dnsmessage.TypeA))
+	if msg.Header.RCode != dnsmessage.RCodeServerFailure {
+		t.Errorf("rcode = %s, want %s", msg.Header.RCode, dnsmessage.RCodeServerFailure)
+	}
+}
+
+func TestTCPFraming(t *testing.T) {
+	s := startServer(t, nil, map[string]string{"api.ngrok.app": "10.107.0.5"})
+
+	conn, err := net.Dial("tcp", s.tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Two queries on one connection: the first whole, the second split
+	// across writes in the middle of its length prefix
+	var framed []byte
+	for id, name := range []string{"api.ngrok.app.", "example.com."} {
+		query := newQuery(t, uint16(id+1), name, dnsmessage.TypeA)
+		framed = append(framed, byte(len(query)>>8), byte(len(query)))
+		framed = append(framed, query...)
+	}
+	first := len(framed) - len(newQuery(t, 2, "example.com.", dnsmessage.TypeA)) - 1
+	for _, part := range [][]byte{framed[:first], framed[first:]} {
+		if _, err := conn.Write(part); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := []dnsmessage.RCode{dnsmessage.RCodeSuccess, dnsmessage.RCodeRefused}
+	for i, rcode := range want {
+		resp, err := readTCPMessage(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := parseResponse(t, resp)
+		if msg.Header.ID != uint16(i+1) || msg.Header.RCode != rcode {
+			t.Errorf("response %d = id %d %s, want id %d %s", i, msg.Header.ID, msg.Header.RCode, i+1, rcode)
+		}
+	}
+}
+
+func TestStopClosesTCPConnections(t *testing.T) {
+	s := NewServer(Config{Address: "127.0.0.1:0", Logger: logr.Discard()})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", s.tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Wait until the connection is being served
+	if err := writeTCPMessage(conn, newQuery(t, 1, "example.com.", dnsmessage.TypeA)); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := readTCPMessage(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	// An idle client would otherwise hold Stop for tcpIdleTimeout
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(tcpIdleTimeout / 2):
+		t.Fatal("Stop waited for an idle TCP client")
+	}
+
+	if _, err := readTCPMessage(conn); err == nil {
+		t.Error("connection still open after Stop")
+	}
+}
@@ -0,0 +1,78 @@
+package forwarder
+
+import (
+	"io"
+	"sync"
+)
+
+// Copy buffer size classes
+const (
+	// smallBufferSize fits the payload of one TLS record, the most a
+	// tls.Conn returns per read
+	smallBufferSize = 16 << 10
+
+	// largeBufferSize is used for reads from plain sockets, so bulk
+	// uploads cross the TLS layer in fewer, fuller writes
+	largeBufferSize = 64 << 10
+)
+
+var (
+	smallBuffers = sync.Pool{New: func() any { b := make([]byte, smallBufferSize); return &b }}
+	largeBuffers = sync.Pool{New: func() any { b := make([]byte, largeBufferSize); return &b }}
+)
+
+// getBuffer returns a pooled buffer of at least size bytes
+func getBuffer(size int) *[]byte {
+	if size > smallBufferSize {
+		return largeBuffers.Get().(*[]byte)
+	}
+	return smallBuffers.Get().(*[]byte)
+}
+
+// putBuffer returns a buffer from getBuffer to its pool
+func putBuffer(b *[]byte) {
+	switch cap(*b) {
+	case smallBufferSize:
+		smallBuffers.Put(b)
+	case largeBufferSize:
+		largeBuffers.Put(b)
+	}
+}
+
+// copyBuffered copies src to dst through a pooled buffer of the given
+// size class until EOF, calling onRead (if set) after every read. Unlike
+// io.Copy it never allocates a buffer of its own.
+//
+// There is no splice fast path: one side of every tunnel is the TLS
+// ingress connection, so the data has to pass through user space, and a
+// kernel copy couldn't report reads to the idle timeout.
+func copyBuffered(dst io.Writer, src io.Reader, size int, onRead func()) (int64, error) {
+	bp := getBuffer(size)
+	defer putBuffer(bp)
+	buf := *bp
+
+	var written int64
+	for {
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			if onRead != nil {
+				onRead()
+			}
+
+			nw, werr := dst.Write(buf[:nr])
+			written += int64(nw)
+			if werr != nil {
+				return written, werr
+			}
+			if nw != nr {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
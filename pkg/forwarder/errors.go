@@ -0,0 +1,109 @@
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/ishanjain/ngrok-forward-proxy/internal/mux"
+)
+
+// Failure classes of a forwarding error
+const (
+	FailureDial        = "dial"         // connecting to the ingress failed
+	FailureDialTimeout = "dial_timeout" // connecting to the ingress timed out
+	FailureTLS         = "tls"          // the mTLS handshake with the ingress failed
+	FailureUpgrade     = "upgrade"      // the ingress refused or broke off the binding upgrade
+	FailureSetup       = "setup"        // the connection couldn't be set up before dialing, e.g. a bad endpoint URI
+	FailureReset       = "reset"        // the connection was reset mid-stream
+	FailureOther       = "other"
+)
+
+// ForwardError is a forwarding error with the stage it failed at
+type ForwardError struct {
+	Class string
+
+	// Code and Message are ngrok's error for a refused upgrade
+	Code    string
+	Message string
+
+	Err error
+}
+
+func (e *ForwardError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ForwardError) Unwrap() error {
+	return e.Err
+}
+
+// Setup reports whether the connection failed before it was upgraded,
+// so no traffic was forwarded
+func (e *ForwardError) Setup() bool {
+	switch e.Class {
+	case FailureDial, FailureDialTimeout, FailureTLS, FailureUpgrade, FailureSetup:
+		return true
+	}
+	return false
+}
+
+// Classify returns the ForwardError in err's chain, classifying err itself
+// as a stream error if there is none. Errors from ForwardConnection and
+// ProbeEndpoint always carry one.
+func Classify(err error) *ForwardError {
+	var fe *ForwardError
+	if errors.As(err, &fe) {
+		return fe
+	}
+	return streamError(err)
+}
+
+// setupError classifies an error from before the binding upgrade. Errors
+// already classified as setup failures, including joined dial errors, are
+// returned as is.
+func setupError(err error) error {
+	var fe *ForwardError
+	if errors.As(err, &fe) && fe.Setup() {
+		return err
+	}
+	return &ForwardError{Class: FailureSetup, Err: err}
+}
+
+// dialError classifies a failed TCP connect to the ingress
+func dialError(address string, err error) error {
+	class := FailureDial
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		class = FailureDialTimeout
+	}
+	return &ForwardError{Class: class, Err: fmt.Errorf("failed to dial ingress endpoint %s: %w", address, err)}
+}
+
+// handshakeError classifies a failed mTLS handshake with the ingress
+func handshakeError(address string, err error) error {
+	return &ForwardError{Class: FailureTLS, Err: fmt.Errorf("TLS handshake with ingress endpoint %s failed: %w", address, err)}
+}
+
+// upgradeError classifies a failed binding upgrade, keeping ngrok's error
+// code and message if the ingress refused it
+func upgradeError(err error) error {
+	fe := &ForwardError{Class: FailureUpgrade, Err: fmt.Errorf("failed to upgrade connection: %w", err)}
+
+	var failure *mux.BindingUpgradeFailure
+	if errors.As(err, &failure) {
+		fe.Code = failure.ErrorCode()
+		fe.Message = failure.ErrorMessage()
+	}
+	return fe
+}
+
+// streamError classifies an error after the connection was upgraded
+func streamError(err error) *ForwardError {
+	class := FailureOther
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		class = FailureReset
+	}
+	return &ForwardError{Class: class, Err: err}
+}
@@ -0,0 +1,126 @@
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/ishanjain/ngrok-forward-proxy/internal/mux"
+	"github.com/ishanjain/ngrok-forward-proxy/internal/pb_agent"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	refused := errors.New("connection refused")
+
+	tests := []struct {
+		name      string
+		err       error
+		wantClass string
+		wantSetup bool
+	}{
+		{"dial", dialError("a:443", refused), FailureDial, true},
+		{"dial timeout", dialError("a:443", &net.OpError{Op: "dial", Err: timeoutError{}}), FailureDialTimeout, true},
+		{"handshake", handshakeError("a:443", errors.New("bad certificate")), FailureTLS, true},
+		{"upgrade", upgradeError(errors.New("EOF")), FailureUpgrade, true},
+		{"wrapped", fmt.Errorf("forwarding: %w", dialError("a:443", refused)), FailureDial, true},
+		{"joined dial errors", errors.Join(dialError("a:443", refused), handshakeError("b:443", refused)), FailureDial, true},
+		{"unwrapped setup error", setupError(errors.New("failed to parse endpoint URI")), FailureSetup, true},
+		{"setup keeps dial class", setupError(dialError("a:443", refused)), FailureDial, true},
+		{"setup of a stream error", setupError(streamError(refused)), FailureSetup, true},
+		{"reset", streamError(fmt.Errorf("read: %w", syscall.ECONNRESET)), FailureReset, false},
+		{"broken pipe", streamError(fmt.Errorf("write: %w", syscall.EPIPE)), FailureReset, false},
+		{"stream", streamError(errors.New("unexpected EOF")), FailureOther, false},
+		{"unclassified", errors.New("something"), FailureOther, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fe := Classify(tt.err)
+			if fe.Class != tt.wantClass || fe.Setup() != tt.wantSetup {
+				t.Errorf("Classify() = %s (setup %v), want %s (setup %v)", fe.Class, fe.Setup(), tt.wantClass, tt.wantSetup)
+			}
+			if fe.Error() == "" {
+				t.Error("empty error message")
+			}
+		})
+	}
+}
+
+func TestUpgradeErrorKeepsIngressError(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		var req pb_agent.ConnRequest
+		if err := mux.ReadProxyMessage(server, &req); err != nil {
+			return
+		}
+		mux.WriteProxyMessage(server, &pb_agent.ConnResponse{
+			ErrorCode:    "ERR_NGROK_3004",
+			ErrorMessage: "endpoint not bound",
+		})
+	}()
+
+	_, err := mux.UpgradeToBindingConnection(logr.Discard(), client, "app.example.com", 443)
+	if err == nil {
+		t.Fatal("upgrade succeeded")
+	}
+
+	fe := Classify(upgradeError(err))
+	if fe.Class != FailureUpgrade || !fe.Setup() {
+		t.Errorf("class = %s (setup %v), want a setup upgrade failure", fe.Class, fe.Setup())
+	}
+	if fe.Code != "ERR_NGROK_3004" || fe.Message != "endpoint not bound" {
+		t.Errorf("code %q, message %q; want the ingress's", fe.Code, fe.Message)
+	}
+
+	var failure *mux.BindingUpgradeFailure
+	if !errors.As(fe, &failure) {
+		t.Error("BindingUpgradeFailure not in the error chain")
+	}
+}
+
+func TestForwardConnectionSetupErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		uri       string
+		ingresses []string
+		wantClass string
+	}{
+		{"unparsable endpoint URI", "http://[::1", []string{"127.0.0.1:1"}, FailureSetup},
+		{"no ingress endpoints", "https://app.example.com", nil, FailureDial},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestForwarder(t, selfSignedCert(t, "client"))
+			f.ingresses = newTestIngressSet(tt.ingresses...)
+
+			local, peer := net.Pipe()
+			defer peer.Close()
+
+			stats, err := f.ForwardConnection(local, BoundEndpoint{Name: "ep", URI: tt.uri, Port: 443})
+			var fe *ForwardError
+			if !errors.As(err, &fe) {
+				t.Fatalf("err = %v, want a *ForwardError", err)
+			}
+			if fe.Class != tt.wantClass || !fe.Setup() {
+				t.Errorf("class = %s (setup %v), want %s as a setup failure", fe.Class, fe.Setup(), tt.wantClass)
+			}
+			if stats.CloseReason != tt.wantClass {
+				t.Errorf("close reason = %q, want %q", stats.CloseReason, tt.wantClass)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package forwarder
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Forwarded header modes (EndpointOptions.ForwardedHeaders)
+const (
+	ForwardedAppend  = "append"  // add the local client to any existing values
+	ForwardedReplace = "replace" // drop incoming values and set our own
+	ForwardedSkip    = "skip"    // leave the request untouched
+)
+
+// forwardedInfo adds X-Forwarded-For/-Proto/-Host and RFC 7239 Forwarded
+// headers describing the local client to each request
+type forwardedInfo struct {
+	mode     string
+	clientIP string
+}
+
+func newForwardedInfo(mode string, remote net.Addr) forwardedInfo {
+	if mode == "" {
+		mode = ForwardedAppend
+	}
+
+	clientIP := ""
+	if remote != nil {
+		clientIP = remote.String()
+		if host, _, err := net.SplitHostPort(clientIP); err == nil {
+			clientIP = host
+		}
+	}
+
+	return forwardedInfo{mode: mode, clientIP: clientIP}
+}
+
+// apply sets the forwarding headers on req. It must run before the Host
+// header is rewritten, since X-Forwarded-Host carries the client's Host.
+func (f forwardedInfo) apply(req *http.Request) {
+	if f.mode == ForwardedSkip || f.clientIP == "" {
+		return
+	}
+
+	// The local listener only speaks plain HTTP
+	const proto = "http"
+
+	if f.mode == ForwardedReplace {
+		for _, h := range []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "Forwarded"} {
+			req.Header.Del(h)
+		}
+	}
+
+	if prior := req.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+		req.Header.Set("X-Forwarded-For", strings.Join(prior, ", ")+", "+f.clientIP)
+	} else {
+		req.Header.Set("X-Forwarded-For", f.clientIP)
+	}
+
+	// Proto and Host describe the original request, so earlier hops win
+	if req.Header.Get("X-Forwarded-Proto") == "" {
+		req.Header.Set("X-Forwarded-Proto", proto)
+	}
+	if req.Header.Get("X-Forwarded-Host") == "" && req.Host != "" {
+		req.Header.Set("X-Forwarded-Host", req.Host)
+	}
+
+	element := "for=" + forwardedNode(f.clientIP)
+	if req.Host != "" {
+		element += ";host=" + quoteForwarded(req.Host)
+	}
+	element += ";proto=" + proto
+
+	if prior := req.Header.Values("Forwarded"); len(prior) > 0 {
+		req.Header.Set("Forwarded", strings.Join(prior, ", ")+", "+element)
+	} else {
+		req.Header.Set("Forwarded", element)
+	}
+}
+
+// forwardedNode formats an IP as an RFC 7239 node; IPv6 addresses are
+// bracketed and quoted
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+// quoteForwarded quotes a value unless it is a valid RFC 7239 token
+func quoteForwarded(v string) string {
+	for _, c := range v {
+		if !isTokenChar(c) {
+			return `"` + strings.ReplaceAll(strings.ReplaceAll(v, `\`, `\\`), `"`, `\"`) + `"`
+		}
+	}
+	return v
+}
+
+func isTokenChar(c rune) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
@@ -0,0 +1,154 @@
+package forwarder
+
+import (
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestForwardedApply(t *testing.T) {
+	client := tcpAddr("192.0.2.10", 51234)
+
+	tests := []struct {
+		name   string
+		mode   string
+		remote net.Addr
+		host   string
+		header http.Header
+		want   http.Header
+	}{
+		{
+			name:   "fresh request",
+			mode:   ForwardedAppend,
+			remote: client,
+			host:   "app.local",
+			header: http.Header{},
+			want: http.Header{
+				"X-Forwarded-For":   {"192.0.2.10"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Host":  {"app.local"},
+				"Forwarded":         {"for=192.0.2.10;host=app.local;proto=http"},
+			},
+		},
+		{
+			name:   "empty mode appends",
+			mode:   "",
+			remote: client,
+			host:   "app.local",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.1"}},
+			want: http.Header{
+				"X-Forwarded-For":   {"203.0.113.1, 192.0.2.10"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Host":  {"app.local"},
+				"Forwarded":         {"for=192.0.2.10;host=app.local;proto=http"},
+			},
+		},
+		{
+			name:   "append keeps earlier hops",
+			mode:   ForwardedAppend,
+			remote: client,
+			host:   "app.local",
+			header: http.Header{
+				"X-Forwarded-For":   {"203.0.113.1", "198.51.100.7"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"public.example.com"},
+				"Forwarded":         {"for=203.0.113.1;proto=https"},
+			},
+			want: http.Header{
+				"X-Forwarded-For":   {"203.0.113.1, 198.51.100.7, 192.0.2.10"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"public.example.com"},
+				"Forwarded":         {"for=203.0.113.1;proto=https, for=192.0.2.10;host=app.local;proto=http"},
+			},
+		},
+		{
+			name:   "replace drops client-supplied values",
+			mode:   ForwardedReplace,
+			remote: client,
+			host:   "app.local",
+			header: http.Header{
+				"X-Forwarded-For":   {"10.0.0.1"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"spoofed.example.com"},
+				"Forwarded":         {"for=10.0.0.1"},
+				"Accept":            {"*/*"},
+			},
+			want: http.Header{
+				"X-Forwarded-For":   {"192.0.2.10"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Host":  {"app.local"},
+				"Forwarded":         {"for=192.0.2.10;host=app.local;proto=http"},
+				"Accept":            {"*/*"},
+			},
+		},
+		{
+			name:   "skip leaves the request untouched",
+			mode:   ForwardedSkip,
+			remote: client,
+			host:   "app.local",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.1"}},
+			want:   http.Header{"X-Forwarded-For": {"10.0.0.1"}},
+		},
+		{
+			name:   "ipv6 client and host with port",
+			mode:   ForwardedAppend,
+			remote: tcpAddr("2001:db8::1", 40000),
+			host:   "app.local:8080",
+			header: http.Header{},
+			want: http.Header{
+				"X-Forwarded-For":   {"2001:db8::1"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Host":  {"app.local:8080"},
+				"Forwarded":         {`for="[2001:db8::1]";host="app.local:8080";proto=http`},
+			},
+		},
+		{
+			name:   "no host",
+			mode:   ForwardedAppend,
+			remote: client,
+			header: http.Header{},
+			want: http.Header{
+				"X-Forwarded-For":   {"192.0.2.10"},
+				"X-Forwarded-Proto": {"http"},
+				"Forwarded":         {"for=192.0.2.10;proto=http"},
+			},
+		},
+		{
+			name:   "unknown client",
+			mode:   ForwardedAppend,
+			remote: nil,
+			host:   "app.local",
+			header: http.Header{},
+			want:   http.Header{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{Host: tt.host, Header: tt.header}
+			newForwardedInfo(tt.mode, tt.remote).apply(req)
+			if !reflect.DeepEqual(req.Header, tt.want) {
+				t.Errorf("headers = %v, want %v", req.Header, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteForwarded(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"app.local", "app.local"},
+		{"app.local:8080", `"app.local:8080"`},
+		{"[2001:db8::1]", `"[2001:db8::1]"`},
+		{`a"b\c`, `"a\"b\\c"`},
+	}
+
+	for _, tt := range tests {
+		if got := quoteForwarded(tt.value); got != tt.want {
+			t.Errorf("quoteForwarded(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
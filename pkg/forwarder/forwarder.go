@@ -1,16 +1,19 @@
 package forwarder
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"net/url"
-	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/ishanjain/ngrok-forward-proxy/internal/mux"
+	"github.com/ishanjain/ngrok-forward-proxy/internal/pb_agent"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/metrics"
 )
 
 // Config holds the configuration for the forwarder
@@ -19,15 +22,40 @@ type Config struct {
 	// Default: kubernetes-binding-ingress.ngrok.io:443
 	IngressEndpoint string
 
+	// IngressEndpoints are additional ingress endpoints to fail over to.
+	// Healthy endpoints are dialed in order of probed latency.
+	IngressEndpoints []string
+
+	// ProbeInterval is how often ingress endpoints are health checked.
+	// Default: 30s
+	ProbeInterval time.Duration
+
 	// TLSCert is the client certificate for mTLS authentication
 	TLSCert tls.Certificate
 
-	// RootCAs is an optional custom CA pool for TLS verification
-	RootCAs *tls.Config
+	// TLSVerify is TLSVerifyStrict, TLSVerifyCA or TLSVerifyInsecure.
+	// Default: TLSVerifyStrict
+	TLSVerify string
+
+	// CABundle is a PEM file or directory of CAs trusted for the ingress
+	// in addition to the system roots. Default: /etc/ssl/certs/ngrok/ if present
+	CABundle string
+
+	// Pins are optional sha256/<base64> SPKI pins; the ingress chain must
+	// contain one of them
+	Pins []string
 
 	// DialTimeout is the timeout for establishing connections
 	DialTimeout time.Duration
 
+	// PoolSize is how many idle, handshaked ingress connections to keep
+	// ready. 0 disables the pool.
+	PoolSize int
+
+	// PoolMaxIdle is how long a pooled connection may sit idle before it
+	// is replaced. Default: 30s
+	PoolMaxIdle time.Duration
+
 	// Logger for structured logging
 	Logger logr.Logger
 }
@@ -39,13 +67,73 @@ type BoundEndpoint struct {
 	Port         int
 	LocalPort    int
 	LocalAddress string
+	Options      EndpointOptions
+}
+
+// EndpointOptions holds per-endpoint forwarding behavior
+type EndpointOptions struct {
+	// ForwardedHeaders is ForwardedAppend, ForwardedReplace or ForwardedSkip
+	// (HTTP endpoints only). Empty means append.
+	ForwardedHeaders string
+
+	// ProxyProtocol is ProxyProtocolV1 or ProxyProtocolV2 to send a PROXY
+	// protocol header ahead of the payload (TCP endpoints only). Empty disables it.
+	ProxyProtocol string
+
+	// IdleTimeout closes a connection with no traffic in either direction
+	// for this long. Zero disables it.
+	IdleTimeout time.Duration
+
+	// MaxLifetime closes a connection this long after it was forwarded,
+	// regardless of traffic. Zero disables it.
+	MaxLifetime time.Duration
+}
+
+// ConnStats describes one forwarded connection
+type ConnStats struct {
+	Start    time.Time
+	Duration time.Duration
+
+	BytesIn  int64 // received from the local client
+	BytesOut int64 // received from the ingress and sent to the client
+
+	// CloseReason is CloseNormal, CloseIdleTimeout, CloseMaxLifetime, or
+	// the failure class if forwarding failed
+	CloseReason string
 }
 
+// Close reasons of a forwarded connection that didn't fail
+const (
+	CloseNormal      = "closed"       // both sides finished
+	CloseIdleTimeout = "idle_timeout" // no traffic for the endpoint's idle timeout
+	CloseMaxLifetime = "max_lifetime" // the endpoint's max lifetime was reached
+)
+
 // Forwarder handles forwarding traffic from local connections to ngrok bound endpoints
 type Forwarder struct {
 	config    Config
 	tlsDialer *tls.Dialer
 	logger    logr.Logger
+
+	// cert is the current client certificate, swappable at runtime
+	cert atomic.Pointer[tls.Certificate]
+
+	// sessions is the TLS session cache for cert. Resumed sessions skip
+	// the client certificate, so each certificate gets a fresh cache.
+	sessions atomic.Value // tls.ClientSessionCache
+
+	// pool holds pre-warmed ingress connections (nil if disabled)
+	pool *connPool
+
+	// ingresses orders the ingress endpoints by health and latency
+	ingresses *ingressSet
+
+	// verifier checks the ingress certificate
+	verifier *verifier
+
+	// Ingress handshake and binding upgrade latency
+	handshakeLatency *metrics.Histogram
+	upgradeLatency   *metrics.Histogram
 }
 
 // New creates a new Forwarder instance
@@ -58,158 +146,338 @@ func New(config Config) (*Forwarder, error) {
 		config.DialTimeout = 3 * time.Minute
 	}
 
-	// Load system root CAs
-	rootCAs, err := x509.SystemCertPool()
+	verifier, err := newVerifier(config.TLSVerify, config.CABundle, config.Pins, config.Logger)
 	if err != nil {
-		// Fall back to empty pool if system CAs can't be loaded
-		rootCAs = x509.NewCertPool()
+		return nil, err
 	}
 
-	// Load custom ngrok CAs from /etc/ssl/certs/ngrok/ (same as operator)
-	if err := loadNgrokCerts(rootCAs); err != nil {
-		// Log but don't fail - just means no custom certs available
-		config.Logger.V(1).Info("No custom ngrok certs loaded", "error", err)
+	f := &Forwarder{
+		config:           config,
+		logger:           config.Logger,
+		verifier:         verifier,
+		handshakeLatency: metrics.NewHistogram(metrics.LatencyBuckets),
+		upgradeLatency:   metrics.NewHistogram(metrics.LatencyBuckets),
 	}
+	f.SetCertificate(config.TLSCert)
 
+	// Resolve the client certificate per handshake so renewals apply to
+	// new connections without touching established ones
 	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{config.TLSCert},
-		RootCAs:      rootCAs,
-	}
-
-	// Override with custom RootCAs if provided
-	if config.RootCAs != nil && config.RootCAs.RootCAs != nil {
-		tlsConfig.RootCAs = config.RootCAs.RootCAs
+		GetClientCertificate: f.getClientCertificate,
+		// Verification is done by the verifier per dial: it refuses the
+		// connection on failure unless ca or insecure mode is opted into
+		InsecureSkipVerify: true,
 	}
 
-	tlsDialer := &tls.Dialer{
+	f.tlsDialer = &tls.Dialer{
 		NetDialer: &net.Dialer{
 			Timeout: config.DialTimeout,
 		},
 		Config: tlsConfig,
 	}
 
-	return &Forwarder{
-		config:    config,
-		tlsDialer: tlsDialer,
-		logger:    config.Logger,
-	}, nil
+	addresses := append([]string{config.IngressEndpoint}, config.IngressEndpoints...)
+	f.ingresses = newIngressSet(addresses, config.ProbeInterval, f.probe, f.logger)
+
+	if config.PoolSize > 0 {
+		f.pool = newConnPool(config.PoolSize, config.PoolMaxIdle, f.dial, f.logger)
+		f.logger.Info("Ingress connection pool enabled",
+			"size", config.PoolSize,
+			"max_idle", f.pool.maxIdle.String())
+	}
+
+	return f, nil
+}
+
+// Close stops ingress probing and the connection pool, closing its idle connections
+func (f *Forwarder) Close() {
+	f.ingresses.close()
+	if f.pool != nil {
+		f.pool.close()
+	}
+}
+
+// AddIngressEndpoint adds an ingress endpoint to fail over to, e.g. the one
+// named by the operator binding
+func (f *Forwarder) AddIngressEndpoint(address string) {
+	if f.ingresses.add(address) {
+		f.logger.Info("Added ingress endpoint", "address", address)
+	}
+}
+
+// PreferIngressEndpoint makes address the first ingress dialed while it is
+// healthy, e.g. the one the operator was registered with
+func (f *Forwarder) PreferIngressEndpoint(address string) {
+	if f.ingresses.prefer(address) {
+		f.logger.Info("Preferring ingress endpoint", "address", address)
+	}
+}
+
+// TLSVerifyMode returns the ingress verification mode in use
+func (f *Forwarder) TLSVerifyMode() string {
+	return f.verifier.mode
+}
+
+// PinCount returns how many SPKI pins the ingress is checked against
+func (f *Forwarder) PinCount() int {
+	return len(f.verifier.pins)
+}
+
+// IngressStates returns the health of every ingress endpoint
+func (f *Forwarder) IngressStates() []IngressState {
+	return f.ingresses.states()
+}
+
+// PoolStats returns ingress connection pool counters
+func (f *Forwarder) PoolStats() PoolStats {
+	if f.pool == nil {
+		return PoolStats{}
+	}
+	return f.pool.stats()
+}
+
+// WriteMetrics writes the ingress handshake and upgrade latency histograms
+func (f *Forwarder) WriteMetrics(w *metrics.Writer) {
+	w.Family("ngrokd_ingress_handshake_duration_seconds", "histogram", "Time to connect and complete the mTLS handshake with an ingress endpoint.")
+	w.Histogram("ngrokd_ingress_handshake_duration_seconds", f.handshakeLatency)
+
+	w.Family("ngrokd_ingress_upgrade_duration_seconds", "histogram", "Time for the ingress to answer a binding upgrade.")
+	w.Histogram("ngrokd_ingress_upgrade_duration_seconds", f.upgradeLatency)
+}
+
+// SetCertificate replaces the client certificate used for new connections
+func (f *Forwarder) SetCertificate(cert tls.Certificate) {
+	old := f.cert.Swap(&cert)
+
+	// Sessions and pooled connections carry the previous certificate's
+	// identity; resuming one would skip presenting the new certificate
+	f.sessions.Store(tls.NewLRUClientSessionCache(64))
+	if old != nil && f.pool != nil {
+		f.pool.flush()
+	}
+}
+
+// Certificate returns the client certificate currently in use
+func (f *Forwarder) Certificate() tls.Certificate {
+	return *f.cert.Load()
+}
+
+func (f *Forwarder) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return f.cert.Load(), nil
 }
 
-// ForwardConnection forwards a single connection to the specified bound endpoint
-func (f *Forwarder) ForwardConnection(localConn net.Conn, endpoint BoundEndpoint) error {
+// ForwardConnection forwards a single connection to the specified bound
+// endpoint and returns its traffic. Errors carry a *ForwardError; see Classify.
+func (f *Forwarder) ForwardConnection(localConn net.Conn, endpoint BoundEndpoint) (stats ConnStats, err error) {
 	defer localConn.Close()
 
+	start := time.Now()
+	var t *tunnel
+	defer func() {
+		if t != nil {
+			stats = t.stats()
+		}
+		stats.Start = start
+		stats.Duration = time.Since(start)
+		if stats.CloseReason == "" {
+			stats.CloseReason = closeReason(err)
+		}
+	}()
+
 	// Silently forward - verbose logging only
 	f.logger.V(1).Info("forwarding connection",
 		"endpoint", endpoint.Name,
 		"uri", endpoint.URI,
 		"port", endpoint.Port)
 
-	// Step 1: Establish mTLS connection to ngrok ingress
-	f.logger.V(1).Info("dialing ingress endpoint", "address", f.config.IngressEndpoint)
-	
-	// Extract hostname for SNI
-	hostname, _, _ := net.SplitHostPort(f.config.IngressEndpoint)
-	
-	// Clone TLS config and set ServerName for proper SNI
-	tlsConfig := f.tlsDialer.Config.Clone()
-	if hostname != "" {
-		tlsConfig.ServerName = hostname
+	// Steps 1-3: Establish an mTLS connection to ngrok ingress and upgrade it.
+	// Failures here are setup failures; anything after is a stream error.
+	ngrokConn, host, resp, err := f.connect(endpoint, time.Time{}, false)
+	if err != nil {
+		return stats, err
 	}
-	
-	// Note: ngrok's server uses an intermediate CA not in system trust stores
-	// We try to load custom CAs from /etc/ssl/certs/ngrok/ (like the operator does)
-	// If that fails, we fall back to InsecureSkipVerify
-	// This is safe because mTLS client cert authentication is still enforced
-	if tlsConfig.RootCAs == nil || !hasNgrokCerts() {
-		tlsConfig.InsecureSkipVerify = true
-		f.logger.V(1).Info("Using InsecureSkipVerify (no custom ngrok CAs found at /etc/ssl/certs/ngrok/)")
+	defer ngrokConn.Close()
+
+	t = newTunnel(localConn, ngrokConn, endpoint.Options.IdleTimeout, endpoint.Options.MaxLifetime)
+	defer t.close()
+
+	// Step 4: Protocol-aware forwarding
+	if resp.Proto == "http" || resp.Proto == "https" {
+		// HTTP-aware proxy: rewrite Host header
+		err = rewriteHTTPHost(t, host, endpoint.Options.ForwardedHeaders)
 	} else {
-		f.logger.V(1).Info("Using custom ngrok CAs for server verification")
+		// Tell the backend who the local client is before any payload
+		if endpoint.Options.ProxyProtocol != "" {
+			if err := writeProxyHeader(ngrokConn, endpoint.Options.ProxyProtocol, localConn.RemoteAddr(), localConn.LocalAddr()); err != nil {
+				return stats, streamError(fmt.Errorf("failed to write PROXY protocol header: %w", err))
+			}
+		}
+		
+		// Raw TCP proxy for non-HTTP protocols
+		err = t.pipe(localConn, ngrokConn)
 	}
-	
-	// Create temporary dialer with updated config
-	dialer := &tls.Dialer{
-		NetDialer: f.tlsDialer.NetDialer,
-		Config:    tlsConfig,
+	if reason := t.expiredReason(); reason != "" {
+		// Timeouts are expected, not forwarding errors
+		f.logger.V(1).Info("connection timed out", "endpoint", endpoint.Name, "reason", reason)
+		return stats, nil
 	}
-	
-	ngrokConn, err := dialer.Dial("tcp", f.config.IngressEndpoint)
 	if err != nil {
-		return fmt.Errorf("failed to dial ingress endpoint %s: %w", f.config.IngressEndpoint, err)
+		f.logger.V(1).Info("connection closed with error", "error", err)
+		return stats, streamError(err)
 	}
-	defer ngrokConn.Close()
 
-	f.logger.V(1).Info("mTLS connection established", "endpoint", f.config.IngressEndpoint)
+	f.logger.V(1).Info("connection closed successfully")
+	return stats, nil
+}
+
+// closeReason returns the close reason of a connection that ended with err
+func closeReason(err error) string {
+	if err == nil {
+		return CloseNormal
+	}
+	return Classify(err).Class
+}
 
-	// Step 2: Parse endpoint URI to extract host
+// connect establishes an mTLS connection to ngrok ingress, pre-warmed if
+// possible, and upgrades it for endpoint. It returns the upgraded
+// connection and the endpoint's host. Every error is a setup-class
+// *ForwardError. A non-zero deadline bounds the
+// upgrade. Probes always dial fresh and aren't recorded in the pool
+// counters or latency histograms, which describe forwarded connections.
+func (f *Forwarder) connect(endpoint BoundEndpoint, deadline time.Time, probe bool) (net.Conn, string, *pb_agent.ConnResponse, error) {
 	host, err := extractHost(endpoint.URI)
 	if err != nil {
-		return fmt.Errorf("failed to parse endpoint URI: %w", err)
+		return nil, "", nil, setupError(fmt.Errorf("failed to parse endpoint URI: %w", err))
+	}
+
+	var ngrokConn net.Conn
+	var pooled bool
+	if probe {
+		ngrokConn, err = f.ingresses.dial(f.handshake)
+	} else {
+		ngrokConn, pooled, err = f.getConn()
+	}
+	if err != nil {
+		return nil, "", nil, setupError(err)
 	}
 
-	f.logger.V(1).Info("upgrading connection", "host", host, "port", endpoint.Port)
-	f.logger.Info("🔍 DEBUG: Upgrading to ngrok", "host", host, "port", endpoint.Port, "uri", endpoint.URI)
+	f.logger.V(1).Info("upgrading connection", "host", host, "port", endpoint.Port, "uri", endpoint.URI)
+
+	ngrokConn.SetDeadline(deadline)
+	resp, err := f.upgrade(ngrokConn, host, endpoint.Port, !probe)
+	var upgradeErr *mux.BindingUpgradeFailure
+	if err != nil && pooled && !errors.As(err, &upgradeErr) {
+		// The ingress closed the idle connection - retry on a fresh one
+		f.logger.V(1).Info("pooled connection unusable, dialing fresh", "error", err)
+		ngrokConn.Close()
 
-	// Step 3: Upgrade connection with binding protocol
-	resp, err := mux.UpgradeToBindingConnection(f.logger, ngrokConn, host, endpoint.Port)
+		ngrokConn, err = f.dial()
+		if err != nil {
+			return nil, "", nil, setupError(err)
+		}
+		ngrokConn.SetDeadline(deadline)
+		resp, err = f.upgrade(ngrokConn, host, endpoint.Port, true)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to upgrade connection: %w", err)
+		ngrokConn.Close()
+		return nil, "", nil, upgradeError(err)
 	}
 
 	f.logger.V(1).Info("connection upgraded",
 		"endpointID", resp.EndpointID,
 		"proto", resp.Proto)
+	ngrokConn.SetDeadline(time.Time{})
+	return ngrokConn, host, resp, nil
+}
 
-	// Step 4: Protocol-aware forwarding
-	if resp.Proto == "http" || resp.Proto == "https" {
-		// HTTP-aware proxy: rewrite Host header
-		err = rewriteHTTPHost(localConn, ngrokConn, host)
-	} else {
-		// Raw TCP proxy for non-HTTP protocols
-		err = rawProxy(localConn, ngrokConn)
+// upgrade performs the binding upgrade, recording how long the ingress
+// took if record is set
+func (f *Forwarder) upgrade(conn net.Conn, host string, port int, record bool) (*pb_agent.ConnResponse, error) {
+	start := time.Now()
+	resp, err := mux.UpgradeToBindingConnection(f.logger, conn, host, port)
+	if err == nil && record {
+		f.upgradeLatency.ObserveDuration(time.Since(start))
 	}
-	if err != nil {
-		f.logger.V(1).Info("connection closed with error", "error", err)
-	} else {
-		f.logger.V(1).Info("connection closed successfully")
+	return resp, err
+}
+
+// getConn returns a pooled ingress connection, or dials a new one
+func (f *Forwarder) getConn() (conn net.Conn, pooled bool, err error) {
+	if f.pool != nil {
+		if conn, ok := f.pool.get(); ok {
+			f.logger.V(1).Info("using pre-warmed ingress connection")
+			return conn, true, nil
+		}
 	}
 
-	return err
+	conn, err = f.dial()
+	return conn, false, err
 }
 
-// hasNgrokCerts checks if custom ngrok certs directory exists
-func hasNgrokCerts() bool {
-	_, err := os.Stat("/etc/ssl/certs/ngrok/")
-	return err == nil
+// dial establishes an mTLS connection to the best available ingress endpoint
+func (f *Forwarder) dial() (net.Conn, error) {
+	return f.ingresses.dial(f.dialAddress)
 }
 
-// loadNgrokCerts loads custom ngrok CA certificates from /etc/ssl/certs/ngrok/
-func loadNgrokCerts(pool *x509.CertPool) error {
-	certsPath := "/etc/ssl/certs/ngrok/"
-	
-	entries, err := os.ReadDir(certsPath)
+// probe measures how long an mTLS handshake with an ingress endpoint takes
+func (f *Forwarder) probe(address string) (time.Duration, error) {
+	start := time.Now()
+	conn, err := f.handshake(address)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	latency := time.Since(start)
+	conn.Close()
+	return latency, nil
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		certPath := certsPath + entry.Name()
-		certPEM, err := os.ReadFile(certPath)
-		if err != nil {
-			continue
-		}
+// dialAddress establishes an mTLS connection to one ingress endpoint for
+// forwarding, recording how long it took
+func (f *Forwarder) dialAddress(address string) (net.Conn, error) {
+	start := time.Now()
+	conn, err := f.handshake(address)
+	if err != nil {
+		return nil, err
+	}
+	f.handshakeLatency.ObserveDuration(time.Since(start))
+	return conn, nil
+}
 
-		if ok := pool.AppendCertsFromPEM(certPEM); ok {
-			// Successfully loaded cert
-		}
+// handshake establishes an mTLS connection to one ingress endpoint
+func (f *Forwarder) handshake(address string) (net.Conn, error) {
+	f.logger.V(1).Info("dialing ingress endpoint", "address", address)
+	
+	// Extract hostname for SNI
+	hostname, _, _ := net.SplitHostPort(address)
+	
+	// Clone TLS config and set ServerName for proper SNI and verification
+	tlsConfig := f.tlsDialer.Config.Clone()
+	// Resume sessions so fresh dials skip the full handshake
+	tlsConfig.ClientSessionCache = f.sessions.Load().(tls.ClientSessionCache)
+	if hostname != "" {
+		tlsConfig.ServerName = hostname
+	}
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		return f.verifier.verifyConnection(hostname, cs)
+	}
+	
+	ctx, cancel := context.WithTimeout(context.Background(), f.config.DialTimeout)
+	defer cancel()
+	
+	// Connect and handshake separately so failures can be told apart
+	rawConn, err := f.tlsDialer.NetDialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, dialError(address, err)
+	}
+	
+	conn := tls.Client(rawConn, tlsConfig)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		return nil, handshakeError(address, err)
 	}
 
-	return nil
+	f.logger.V(1).Info("mTLS connection established", "endpoint", address)
+	return conn, nil
 }
 
 // extractHost extracts the hostname from an endpoint URI (without port)
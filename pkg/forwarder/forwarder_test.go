@@ -0,0 +1,202 @@
+package forwarder
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/metrics"
+)
+
+// selfSignedCert returns a throwaway certificate for commonName
+func selfSignedCert(tb testing.TB, commonName string) tls.Certificate {
+	tb.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newTestForwarder returns a forwarder that dials without verifying the
+// ingress and without probing or pooling
+func newTestForwarder(t *testing.T, cert tls.Certificate) *Forwarder {
+	t.Helper()
+
+	v, err := newVerifier(TLSVerifyInsecure, "", nil, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &Forwarder{
+		config:           Config{DialTimeout: 5 * time.Second},
+		logger:           logr.Discard(),
+		verifier:         v,
+		handshakeLatency: metrics.NewHistogram(metrics.LatencyBuckets),
+		upgradeLatency:   metrics.NewHistogram(metrics.LatencyBuckets),
+	}
+	f.SetCertificate(cert)
+	f.tlsDialer = &tls.Dialer{
+		NetDialer: &net.Dialer{},
+		Config: &tls.Config{
+			GetClientCertificate: f.getClientCertificate,
+			InsecureSkipVerify:   true,
+		},
+	}
+	return f
+}
+
+// handshake describes a client as seen by the mTLS test server
+type handshake struct {
+	commonName string
+	resumed    bool
+}
+
+// startMTLSServer starts a server that requires a client certificate and
+// reports every handshake. It writes a byte after the handshake so the
+// client reads its session ticket.
+func startMTLSServer(t *testing.T) (string, <-chan handshake) {
+	t.Helper()
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{selfSignedCert(t, "ingress")},
+		ClientAuth:   tls.RequireAnyClientCert,
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	handshakes := make(chan handshake, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if err := tlsConn.Handshake(); err != nil {
+				conn.Close()
+				continue
+			}
+			cs := tlsConn.ConnectionState()
+			handshakes <- handshake{commonName: cs.PeerCertificates[0].Subject.CommonName, resumed: cs.DidResume}
+			conn.Write([]byte{0})
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), handshakes
+}
+
+func TestSetCertificateDiscardsSessions(t *testing.T) {
+	addr, handshakes := startMTLSServer(t)
+	f := newTestForwarder(t, selfSignedCert(t, "old"))
+
+	dial := func() handshake {
+		t.Helper()
+		conn, err := f.dialAddress(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Read(make([]byte, 1))
+
+		select {
+		case h := <-handshakes:
+			return h
+		case <-time.After(5 * time.Second):
+			t.Fatal("server saw no handshake")
+			return handshake{}
+		}
+	}
+
+	if h := dial(); h.commonName != "old" || h.resumed {
+		t.Fatalf("first dial = %+v, want a full handshake as old", h)
+	}
+	if h := dial(); !h.resumed {
+		t.Fatalf("second dial = %+v, want a resumed session", h)
+	}
+
+	f.SetCertificate(selfSignedCert(t, "new"))
+	if h := dial(); h.commonName != "new" || h.resumed {
+		t.Errorf("dial after SetCertificate = %+v, want a full handshake as new", h)
+	}
+}
+
+// handshakeCount returns the number of handshakes in the forwarder's
+// handshake latency histogram
+func handshakeCount(t *testing.T, f *Forwarder) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	f.WriteMetrics(metrics.NewWriter(&buf))
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if count, ok := strings.CutPrefix(line, "ngrokd_ingress_handshake_duration_seconds_count "); ok {
+			return count
+		}
+	}
+	t.Fatalf("no handshake count in:\n%s", buf.String())
+	return ""
+}
+
+func TestProbesSkipPoolAndMetrics(t *testing.T) {
+	addr, _ := startMTLSServer(t)
+	f := newTestForwarder(t, selfSignedCert(t, "client"))
+	f.ingresses = newIngressSet([]string{addr}, time.Hour, f.probe, f.logger)
+	t.Cleanup(f.ingresses.close)
+
+	pooled := &fakeConn{id: 1}
+	f.pool = &connPool{
+		size:    1,
+		maxIdle: time.Minute,
+		wake:    make(chan struct{}, 1),
+		idle:    []idleConn{{conn: pooled, created: time.Now()}},
+	}
+
+	if _, err := f.probe(addr); err != nil {
+		t.Fatal(err)
+	}
+
+	// The test server closes after the handshake, so the upgrade fails
+	endpoint := BoundEndpoint{URI: "https://app.example.com", Port: 443}
+	if _, _, _, err := f.connect(endpoint, time.Now().Add(5*time.Second), true); err == nil {
+		t.Fatal("upgrade against the test server succeeded")
+	}
+
+	if stats := f.PoolStats(); stats.Idle != 1 || stats.Hits != 0 || stats.Misses != 0 || pooled.closed.Load() {
+		t.Errorf("pool stats = %+v after probes, want the pooled connection untouched", stats)
+	}
+	if got := handshakeCount(t, f); got != "0" {
+		t.Errorf("handshakes recorded after probes = %s, want 0", got)
+	}
+
+	conn, err := f.dialAddress(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if got := handshakeCount(t, f); got != "1" {
+		t.Errorf("handshakes recorded after a forwarding dial = %s, want 1", got)
+	}
+}
@@ -2,61 +2,369 @@ package forwarder
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync/atomic"
 )
 
-// rewriteHTTPHost rewrites the Host header in an HTTP request
-func rewriteHTTPHost(localConn, ngrokConn net.Conn, targetHost string) error {
-	// Read the HTTP request
-	reader := bufio.NewReader(localConn)
-	req, err := http.ReadRequest(reader)
+// maxPipelined bounds how many requests may be in flight on one connection
+const maxPipelined = 64
+
+var (
+	// errSwitched ends the request/response loops after a 101 Switching
+	// Protocols so the connection can become a raw tunnel
+	errSwitched = errors.New("switched protocols")
+
+	// errClientDone means the client stopped sending and every request
+	// has been answered
+	errClientDone = errors.New("client done")
+)
+
+// pendingRequest is a request forwarded to ngrok whose response hasn't
+// been relayed yet
+type pendingRequest struct {
+	method string
+
+	// switched receives whether an upgrade request was accepted with a
+	// 101; nil for ordinary requests
+	switched chan bool
+}
+
+// exchange pairs requests on a connection with their responses
+type exchange struct {
+	// pending is closed by the request side once no more requests follow
+	pending chan *pendingRequest
+
+	// inflight counts requests whose final response hasn't been relayed
+	inflight atomic.Int32
+
+	done chan struct{}
+}
+
+// rewriteHTTPHost proxies an HTTP/1.x connection, rewriting the Host header
+// of every request. Chunked bodies and Expect: 100-continue are streamed
+// through; after a 101 Switching Protocols (e.g. WebSocket) the connection
+// becomes a raw tunnel. A client that half-closes still gets its responses.
+func rewriteHTTPHost(t *tunnel, targetHost, forwardedMode string) error {
+	// Record what the first parse consumes so non-HTTP traffic can still be replayed
+	recorder := &recordingReader{r: t.track(t.local), recording: true}
+	requests := bufio.NewReader(recorder)
+
+	req, err := http.ReadRequest(requests)
 	if err != nil {
 		// Not HTTP or malformed - fall back to raw proxy
-		return rawProxy(localConn, ngrokConn)
+		if _, err := t.remote.Write(recorder.buf.Bytes()); err != nil {
+			return err
+		}
+		return t.pipe(t.local, t.remote)
 	}
+	recorder.stop()
 
-	// Rewrite Host header
-	req.Host = targetHost
-	req.Header.Set("Host", targetHost)
-
-	// Write modified request to ngrok
-	if err := req.Write(ngrokConn); err != nil {
-		return err
+	ex := &exchange{
+		pending: make(chan *pendingRequest, maxPipelined),
+		done:    make(chan struct{}),
 	}
+	defer close(ex.done)
 
-	// Now do bidirectional copy for the rest
-	errChan := make(chan error, 2)
+	reqDone := make(chan error, 1)
+	respDone := make(chan error, 1)
 
-	// Copy responses: ngrok → local
+	// Requests: local → ngrok
 	go func() {
-		_, err := io.Copy(localConn, ngrokConn)
-		errChan <- err
+		fwd := newForwardedInfo(forwardedMode, t.local.RemoteAddr())
+		err := proxyRequests(req, requests, t.remote, targetHost, fwd, ex)
+
+		close(ex.pending)
+		if err == io.EOF && ex.inflight.Load() == 0 {
+			err = errClientDone
+		}
+		reqDone <- err
 	}()
 
-	// Copy remaining request data (if any): local → ngrok
+	// Responses: ngrok → local
+	responses := bufio.NewReader(t.track(t.remote))
 	go func() {
-		_, err := io.Copy(ngrokConn, reader)
-		errChan <- err
+		respDone <- proxyResponses(responses, t.local, ex)
 	}()
 
-	return <-errChan
+	select {
+	case err := <-respDone:
+		if err != errSwitched {
+			// The backend ended the connection
+			return err
+		}
+		if err := <-reqDone; err != errSwitched {
+			return err
+		}
+
+	case err := <-reqDone:
+		switch err {
+		case errSwitched:
+			if err := <-respDone; err != errSwitched {
+				return err
+			}
+		case errClientDone:
+			return nil
+		case io.EOF:
+			// Client half-closed - pass it on and wait for the outstanding responses
+			closeWrite(t.remote)
+			return <-respDone
+		case nil:
+			return <-respDone
+		default:
+			return err
+		}
+	}
+
+	// Upgraded - everything from here on is opaque
+	return t.pipe(requests, responses)
 }
 
-// rawProxy does simple bidirectional copy (for non-HTTP or when HTTP parsing fails)
-func rawProxy(localConn, ngrokConn net.Conn) error {
-	errChan := make(chan error, 2)
+// proxyRequests forwards requests starting with first until the client
+// closes the connection (io.EOF), asks to close it (nil), or upgrades it
+// (errSwitched).
+func proxyRequests(first *http.Request, reader *bufio.Reader, ngrokConn net.Conn, targetHost string, fwd forwardedInfo, ex *exchange) error {
+	w := bufio.NewWriter(ngrokConn)
+	req := first
 
-	go func() {
-		_, err := io.Copy(ngrokConn, localConn)
-		errChan <- err
-	}()
+	for {
+		p := &pendingRequest{method: req.Method}
+		if isUpgradeRequest(req) {
+			p.switched = make(chan bool, 1)
+		}
 
-	go func() {
-		_, err := io.Copy(localConn, ngrokConn)
-		errChan <- err
-	}()
+		ex.inflight.Add(1)
+		select {
+		case ex.pending <- p:
+		case <-ex.done:
+			return nil
+		}
+
+		fwd.apply(req)
+
+		if err := writeRequest(w, ngrokConn, req, targetHost); err != nil {
+			return err
+		}
+
+		if p.switched != nil {
+			select {
+			case ok := <-p.switched:
+				if ok {
+					return errSwitched
+				}
+			case <-ex.done:
+				return nil
+			}
+		}
+
+		if req.Close {
+			return nil
+		}
+
+		var err error
+		req, err = http.ReadRequest(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return io.EOF
+			}
+			return fmt.Errorf("failed to read HTTP request: %w", err)
+		}
+	}
+}
+
+// writeRequest writes a request with its Host rewritten. The head is
+// flushed before the body so Expect: 100-continue clients aren't blocked,
+// and chunked bodies are re-chunked as they arrive.
+func writeRequest(w *bufio.Writer, conn net.Conn, req *http.Request, targetHost string) error {
+	chunked := len(req.TransferEncoding) > 0 && req.TransferEncoding[0] == "chunked"
+
+	req.Header.Del("Host")
+
+	fmt.Fprintf(w, "%s %s HTTP/%d.%d\r\n", req.Method, req.RequestURI, req.ProtoMajor, req.ProtoMinor)
+	fmt.Fprintf(w, "Host: %s\r\n", targetHost)
+	if chunked {
+		w.WriteString("Transfer-Encoding: chunked\r\n")
+	}
+	if len(req.Trailer) > 0 {
+		keys := make([]string, 0, len(req.Trailer))
+		for k := range req.Trailer {
+			keys = append(keys, k)
+		}
+		fmt.Fprintf(w, "Trailer: %s\r\n", strings.Join(keys, ", "))
+	}
+	if err := req.Header.Write(w); err != nil {
+		return err
+	}
+	w.WriteString("\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	defer req.Body.Close()
+
+	if !chunked {
+		_, err := copyBuffered(conn, req.Body, largeBufferSize, nil)
+		return err
+	}
+
+	cw := httputil.NewChunkedWriter(w)
+	if _, err := copyBuffered(flushWriter{cw, w}, req.Body, smallBufferSize, nil); err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	if err := req.Trailer.Write(w); err != nil {
+		return err
+	}
+	w.WriteString("\r\n")
+	return w.Flush()
+}
+
+// proxyResponses relays responses to the client in request order. Interim
+// 1xx responses are passed through; a 101 returns errSwitched. It returns
+// nil when the backend closes the connection or the client is done and
+// every request has been answered.
+func proxyResponses(reader *bufio.Reader, localConn net.Conn, ex *exchange) error {
+	var current *pendingRequest
+
+	for {
+		if current == nil {
+			select {
+			case p, ok := <-ex.pending:
+				if !ok {
+					return nil
+				}
+				current = p
+			default:
+			}
+		}
+
+		if _, err := reader.Peek(1); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if current == nil {
+			select {
+			case p, ok := <-ex.pending:
+				if !ok {
+					return fmt.Errorf("unexpected data from backend after last response")
+				}
+				current = p
+			case <-ex.done:
+				return nil
+			}
+		}
+
+		resp, err := http.ReadResponse(reader, &http.Request{Method: current.method})
+		if err != nil {
+			return fmt.Errorf("failed to read HTTP response: %w", err)
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusSwitchingProtocols:
+			if current.switched == nil {
+				return fmt.Errorf("backend switched protocols without an upgrade request")
+			}
+			if err := writeResponseHead(localConn, resp); err != nil {
+				return err
+			}
+			current.switched <- true
+			return errSwitched
+
+		case resp.StatusCode >= 100 && resp.StatusCode < 200:
+			// Interim response (e.g. 100 Continue) - the final one follows
+			if err := writeResponseHead(localConn, resp); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := resp.Write(localConn); err != nil {
+			return err
+		}
+
+		if current.switched != nil {
+			current.switched <- false
+		}
+		current = nil
+		ex.inflight.Add(-1)
+
+		if resp.Close {
+			return nil
+		}
+	}
+}
+
+// writeResponseHead writes the status line and headers of a bodiless response
+func writeResponseHead(w io.Writer, resp *http.Response) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, resp.Status)
+	if err := resp.Header.Write(bw); err != nil {
+		return err
+	}
+	bw.WriteString("\r\n")
+	return bw.Flush()
+}
+
+// isUpgradeRequest reports whether the request asks to switch protocols
+func isUpgradeRequest(req *http.Request) bool {
+	if req.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flushWriter flushes a buffered writer after every write so streamed
+// bodies aren't held back
+type flushWriter struct {
+	w io.Writer
+	f *bufio.Writer
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, fw.f.Flush()
+}
+
+// recordingReader keeps a copy of everything read until stopped
+type recordingReader struct {
+	r         io.Reader
+	buf       bytes.Buffer
+	recording bool
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if rr.recording && n > 0 {
+		rr.buf.Write(p[:n])
+	}
+	return n, err
+}
 
-	return <-errChan
+func (rr *recordingReader) stop() {
+	rr.recording = false
+	rr.buf = bytes.Buffer{}
 }
@@ -0,0 +1,351 @@
+package forwarder
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testTargetHost = "app.internal"
+
+// httpProxy is a connection through rewriteHTTPHost: the client end, the
+// backend end and the proxy's result
+type httpProxy struct {
+	client  net.Conn
+	backend net.Conn
+
+	// clientR and backendR buffer reads from client and backend
+	clientR  *bufio.Reader
+	backendR *bufio.Reader
+
+	done <-chan error
+}
+
+// startHTTPProxy proxies a loopback client connection to a loopback
+// backend connection, rewriting the Host to testTargetHost
+func startHTTPProxy(t *testing.T) *httpProxy {
+	t.Helper()
+
+	client, local := tcpPair(t)
+	remote, backend := tcpPair(t)
+	deadline := time.Now().Add(5 * time.Second)
+	for _, c := range []net.Conn{client, local, remote, backend} {
+		c.SetDeadline(deadline)
+		t.Cleanup(func() { c.Close() })
+	}
+
+	tun := newTunnel(local, remote, 0, 0)
+	done := make(chan error, 1)
+	go func() {
+		done <- rewriteHTTPHost(tun, testTargetHost, ForwardedSkip)
+		tun.close()
+	}()
+
+	return &httpProxy{
+		client:   client,
+		backend:  backend,
+		clientR:  bufio.NewReader(client),
+		backendR: bufio.NewReader(backend),
+		done:     done,
+	}
+}
+
+func (p *httpProxy) send(t *testing.T, c net.Conn, data string) {
+	t.Helper()
+	if _, err := io.WriteString(c, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readRequest reads a request at the backend and checks its Host was rewritten
+func (p *httpProxy) readRequest(t *testing.T) *http.Request {
+	t.Helper()
+	req, err := http.ReadRequest(p.backendR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Host != testTargetHost {
+		t.Errorf("%s %s: Host = %q, want %q", req.Method, req.RequestURI, req.Host, testTargetHost)
+	}
+	return req
+}
+
+// readResponse reads a response to a method request at the client,
+// including its body
+func (p *httpProxy) readResponse(t *testing.T, method string) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.ReadResponse(p.clientR, &http.Request{Method: method})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+// wait returns the proxy's result
+func (p *httpProxy) wait(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-p.done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxy didn't finish")
+		return nil
+	}
+}
+
+func TestHTTPProxyRewritesEveryKeepAliveRequest(t *testing.T) {
+	p := startHTTPProxy(t)
+
+	// Pipelined, so the later requests arrive in the same read as the first
+	p.send(t, p.client, "GET /a HTTP/1.1\r\nHost: public.example.com\r\n\r\n"+
+		"GET /b HTTP/1.1\r\nHost: public.example.com\r\n\r\n")
+	for _, path := range []string{"/a", "/b"} {
+		if req := p.readRequest(t); req.RequestURI != path {
+			t.Errorf("request = %s, want %s", req.RequestURI, path)
+		}
+	}
+	p.send(t, p.backend, "HTTP/1.1 200 OK\r\nContent-Length: 1\r\n\r\na"+
+		"HTTP/1.1 200 OK\r\nContent-Length: 1\r\n\r\nb")
+
+	// A third request once the first two are answered
+	for _, want := range []string{"a", "b"} {
+		if _, body := p.readResponse(t, "GET"); body != want {
+			t.Errorf("body = %q, want %q", body, want)
+		}
+	}
+	p.send(t, p.client, "GET /c HTTP/1.1\r\nHost: other.example.com\r\n\r\n")
+	if req := p.readRequest(t); req.RequestURI != "/c" {
+		t.Errorf("request = %s, want /c", req.RequestURI)
+	}
+	p.send(t, p.backend, "HTTP/1.1 200 OK\r\nContent-Length: 1\r\n\r\nc")
+	if _, body := p.readResponse(t, "GET"); body != "c" {
+		t.Errorf("body = %q, want c", body)
+	}
+}
+
+func TestHTTPProxyChunkedBodiesWithTrailers(t *testing.T) {
+	p := startHTTPProxy(t)
+
+	p.send(t, p.client, "POST /upload HTTP/1.1\r\nHost: public.example.com\r\n"+
+		"Transfer-Encoding: chunked\r\nTrailer: X-Checksum\r\n\r\n"+
+		"5\r\nhello\r\n6\r\n world\r\n0\r\nX-Checksum: c0ffee\r\n\r\n")
+
+	req := p.readRequest(t)
+	if len(req.TransferEncoding) == 0 || req.TransferEncoding[0] != "chunked" {
+		t.Errorf("transfer encoding = %v, want chunked", req.TransferEncoding)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello world" {
+		t.Errorf("request body = %q, want %q", body, "hello world")
+	}
+	if got := req.Trailer.Get("X-Checksum"); got != "c0ffee" {
+		t.Errorf("request trailer = %q, want c0ffee", got)
+	}
+
+	p.send(t, p.backend, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Status\r\n\r\n"+
+		"3\r\nabc\r\n0\r\nX-Status: done\r\n\r\n")
+	resp, respBody := p.readResponse(t, "POST")
+	if respBody != "abc" {
+		t.Errorf("response body = %q, want abc", respBody)
+	}
+	if got := resp.Trailer.Get("X-Status"); got != "done" {
+		t.Errorf("response trailer = %q, want done", got)
+	}
+}
+
+func TestHTTPProxyExpectContinue(t *testing.T) {
+	p := startHTTPProxy(t)
+
+	// The head must reach the backend before the client sends the body
+	p.send(t, p.client, "PUT /file HTTP/1.1\r\nHost: public.example.com\r\n"+
+		"Content-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	req := p.readRequest(t)
+	if got := req.Header.Get("Expect"); got != "100-continue" {
+		t.Errorf("Expect = %q, want 100-continue", got)
+	}
+
+	p.send(t, p.backend, "HTTP/1.1 100 Continue\r\n\r\n")
+	line, err := p.clientR.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "HTTP/1.1 100 Continue\r\n" {
+		t.Fatalf("interim response = %q, want 100 Continue", line)
+	}
+	if blank, _ := p.clientR.ReadString('\n'); blank != "\r\n" {
+		t.Fatalf("interim response continued with %q", blank)
+	}
+
+	p.send(t, p.client, "hello")
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello" {
+		t.Errorf("body = %q, want hello", body)
+	}
+
+	p.send(t, p.backend, "HTTP/1.1 201 Created\r\nContent-Length: 0\r\n\r\n")
+	if resp, _ := p.readResponse(t, "PUT"); resp.StatusCode != http.StatusCreated {
+		t.Errorf("final status = %d, want 201", resp.StatusCode)
+	}
+}
+
+func TestHTTPProxyUpgradeSwitchesToRaw(t *testing.T) {
+	p := startHTTPProxy(t)
+
+	p.send(t, p.client, "GET /ws HTTP/1.1\r\nHost: public.example.com\r\n"+
+		"Connection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+	p.readRequest(t)
+	p.send(t, p.backend, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+
+	resp, err := http.ReadResponse(p.clientR, &http.Request{Method: "GET"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+
+	// Neither of these would parse as HTTP
+	p.send(t, p.client, "\x81\x05ping!")
+	got := make([]byte, 7)
+	if _, err := io.ReadFull(p.backendR, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "\x81\x05ping!" {
+		t.Errorf("backend read %q", got)
+	}
+
+	p.send(t, p.backend, "\x81\x05pong!")
+	if _, err := io.ReadFull(p.clientR, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "\x81\x05pong!" {
+		t.Errorf("client read %q", got)
+	}
+
+	p.client.Close()
+	p.backend.Close()
+	p.wait(t)
+}
+
+func TestHTTPProxyBodilessResponses(t *testing.T) {
+	p := startHTTPProxy(t)
+
+	p.send(t, p.client, "HEAD / HTTP/1.1\r\nHost: public.example.com\r\n\r\n"+
+		"DELETE /item HTTP/1.1\r\nHost: public.example.com\r\n\r\n"+
+		"GET /cached HTTP/1.1\r\nHost: public.example.com\r\nIf-None-Match: \"v1\"\r\n\r\n"+
+		"GET /last HTTP/1.1\r\nHost: public.example.com\r\n\r\n")
+	for i := 0; i < 4; i++ {
+		p.readRequest(t)
+	}
+
+	// The HEAD and 304 responses advertise a length but carry no body; if
+	// the proxy waited for one, the last response would never arrive
+	p.send(t, p.backend, "HTTP/1.1 200 OK\r\nContent-Length: 42\r\n\r\n"+
+		"HTTP/1.1 204 No Content\r\n\r\n"+
+		"HTTP/1.1 304 Not Modified\r\nETag: \"v1\"\r\nContent-Length: 42\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nlast")
+
+	tests := []struct {
+		method string
+		status int
+		body   string
+	}{
+		{"HEAD", http.StatusOK, ""},
+		{"DELETE", http.StatusNoContent, ""},
+		{"GET", http.StatusNotModified, ""},
+		{"GET", http.StatusOK, "last"},
+	}
+	for _, tt := range tests {
+		resp, body := p.readResponse(t, tt.method)
+		if resp.StatusCode != tt.status || body != tt.body {
+			t.Errorf("%s response = %d %q, want %d %q", tt.method, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+}
+
+func TestHTTPProxyFallsBackToRawForNonHTTP(t *testing.T) {
+	p := startHTTPProxy(t)
+
+	hello := "SSH-2.0-OpenSSH_9.6\r\n"
+	p.send(t, p.client, hello)
+	got := make([]byte, len(hello))
+	if _, err := io.ReadFull(p.backendR, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != hello {
+		t.Errorf("backend read %q, want the client's bytes replayed", got)
+	}
+
+	p.send(t, p.client, "more")
+	got = make([]byte, 4)
+	if _, err := io.ReadFull(p.backendR, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "more" {
+		t.Errorf("backend read %q, want more", got)
+	}
+
+	p.send(t, p.backend, "SSH-2.0-server\r\n")
+	if line, err := p.clientR.ReadString('\n'); err != nil || line != "SSH-2.0-server\r\n" {
+		t.Errorf("client read %q, %v", line, err)
+	}
+}
+
+func TestHTTPProxyHalfCloseAfterLastRequest(t *testing.T) {
+	p := startHTTPProxy(t)
+
+	p.send(t, p.client, "GET / HTTP/1.1\r\nHost: public.example.com\r\n\r\n")
+	if err := p.client.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	p.readRequest(t)
+
+	// The client's half-close reaches the backend before it answers
+	if _, err := p.backendR.ReadByte(); err != io.EOF {
+		t.Fatalf("backend read after request = %v, want EOF", err)
+	}
+	p.send(t, p.backend, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nfinal")
+	p.backend.Close()
+
+	if _, body := p.readResponse(t, "GET"); body != "final" {
+		t.Errorf("body = %q, want final", body)
+	}
+	if rest, err := io.ReadAll(p.clientR); err != nil || len(rest) != 0 {
+		t.Errorf("after the response client read %q, %v; want EOF", rest, err)
+	}
+	if err := p.wait(t); err != nil {
+		t.Errorf("proxy returned %v", err)
+	}
+}
+
+func TestIsUpgradeRequest(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		want   bool
+	}{
+		{http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}}, true},
+		{http.Header{"Connection": {"keep-alive, upgrade"}, "Upgrade": {"h2c"}}, true},
+		{http.Header{"Connection": {"keep-alive"}, "Upgrade": {"websocket"}}, false},
+		{http.Header{"Connection": {"Upgrade"}}, false},
+	}
+
+	for _, tt := range tests {
+		req := &http.Request{Header: tt.header}
+		if got := isUpgradeRequest(req); got != tt.want {
+			t.Errorf("isUpgradeRequest(%v) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	defaultProbeInterval = 30 * time.Second
+
+	// failuresUntilUnhealthy is how many failed dials or probes in a row
+	// take an ingress out of rotation
+	failuresUntilUnhealthy = 2
+)
+
+// IngressState reports the health of one ingress endpoint
+type IngressState struct {
+	Address   string        `json:"address"`
+	Healthy   bool          `json:"healthy"`
+	Probed    bool          `json:"probed"`
+	Preferred bool          `json:"preferred"`
+	Latency   time.Duration `json:"latency"`
+	LastProbe time.Time     `json:"last_probe,omitempty"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// ingressEndpoint is the tracked state of one ingress address
+type ingressEndpoint struct {
+	address   string
+	probed    bool
+	failures  int
+	latency   time.Duration
+	lastProbe time.Time
+	lastError string
+}
+
+func (e *ingressEndpoint) healthy() bool {
+	return e.failures < failuresUntilUnhealthy
+}
+
+// ingressSet tracks the configured ingress endpoints, probes them in the
+// background and orders them for dialing
+type ingressSet struct {
+	probe         func(address string) (time.Duration, error)
+	probeInterval time.Duration
+	logger        logr.Logger
+
+	mu        sync.RWMutex
+	endpoints []*ingressEndpoint
+
+	// preferred is dialed first while healthy, whatever its latency
+	preferred string
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newIngressSet(addresses []string, probeInterval time.Duration, probe func(string) (time.Duration, error), logger logr.Logger) *ingressSet {
+	if probeInterval <= 0 {
+		probeInterval = defaultProbeInterval
+	}
+
+	s := &ingressSet{
+		probe:         probe,
+		probeInterval: probeInterval,
+		logger:        logger,
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, address := range addresses {
+		s.add(address)
+	}
+
+	go s.run()
+	return s
+}
+
+// add starts tracking an address; it reports false if it was already known
+func (s *ingressSet) add(address string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addLocked(address)
+}
+
+// prefer tracks an address if needed and ranks it first while it is healthy.
+// It reports false if the address was already preferred.
+func (s *ingressSet) prefer(address string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addLocked(address)
+	if s.preferred == address {
+		return false
+	}
+	s.preferred = address
+	return true
+}
+
+func (s *ingressSet) addLocked(address string) bool {
+	for _, e := range s.endpoints {
+		if e.address == address {
+			return false
+		}
+	}
+	s.endpoints = append(s.endpoints, &ingressEndpoint{address: address})
+
+	// Probe the newcomer right away
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// candidates returns addresses in dial order: the preferred endpoint if
+// healthy, then healthy probed endpoints by latency, then not yet probed
+// ones, then unhealthy ones as a last resort
+func (s *ingressSet) candidates() []string {
+	s.mu.RLock()
+	endpoints := append([]*ingressEndpoint(nil), s.endpoints...)
+	rank := make(map[*ingressEndpoint]int, len(endpoints))
+	latency := make(map[*ingressEndpoint]time.Duration, len(endpoints))
+	for _, e := range endpoints {
+		switch {
+		case !e.healthy():
+			rank[e] = 2
+		case e.address == s.preferred:
+			rank[e] = -1
+		case !e.probed:
+			rank[e] = 1
+		}
+		latency[e] = e.latency
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		if rank[a] != rank[b] {
+			return rank[a] < rank[b]
+		}
+		if rank[a] == 0 {
+			return latency[a] < latency[b]
+		}
+		return false
+	})
+
+	addresses := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		addresses[i] = e.address
+	}
+	return addresses
+}
+
+// report records the outcome of a dial or probe to address
+func (s *ingressSet) report(address string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.endpoints {
+		if e.address != address {
+			continue
+		}
+
+		wasHealthy := e.healthy()
+		if err != nil {
+			e.failures++
+			e.lastError = err.Error()
+		} else {
+			e.failures = 0
+			e.lastError = ""
+			if e.probed {
+				// Smooth so near-equal endpoints don't swap on every probe
+				e.latency = (3*e.latency + latency) / 4
+			} else {
+				e.latency = latency
+			}
+			e.probed = true
+		}
+
+		switch {
+		case wasHealthy && !e.healthy():
+			s.logger.Info("⚠️  Ingress endpoint unhealthy", "address", address, "error", err)
+		case !wasHealthy && e.healthy():
+			s.logger.Info("✓ Ingress endpoint healthy again", "address", address, "latency", latency.String())
+		}
+		return
+	}
+}
+
+// states returns a snapshot of every endpoint in configured order
+func (s *ingressSet) states() []IngressState {
+	preferred := ""
+	if candidates := s.candidates(); len(candidates) > 0 {
+		preferred = candidates[0]
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	states := make([]IngressState, 0, len(s.endpoints))
+	for _, e := range s.endpoints {
+		states = append(states, IngressState{
+			Address:   e.address,
+			Healthy:   e.healthy(),
+			Probed:    e.probed,
+			Preferred: e.address == preferred,
+			Latency:   e.latency,
+			LastProbe: e.lastProbe,
+			LastError: e.lastError,
+		})
+	}
+	return states
+}
+
+// dial tries candidates in order until one connects
+func (s *ingressSet) dial(dial func(address string) (net.Conn, error)) (net.Conn, error) {
+	var errs []error
+	for _, address := range s.candidates() {
+		start := time.Now()
+		conn, err := dial(address)
+		if err == nil {
+			s.report(address, time.Since(start), nil)
+			return conn, nil
+		}
+
+		s.report(address, 0, err)
+		errs = append(errs, err)
+		s.logger.V(1).Info("ingress dial failed, trying next", "address", address, "error", err)
+	}
+
+	if len(errs) == 0 {
+		return nil, &ForwardError{Class: FailureDial, Err: fmt.Errorf("no ingress endpoints configured")}
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (s *ingressSet) close() {
+	close(s.stop)
+	<-s.done
+}
+
+// run probes every endpoint on the probe interval
+func (s *ingressSet) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		s.probeAll()
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *ingressSet) probeAll() {
+	s.mu.RLock()
+	addresses := make([]string, len(s.endpoints))
+	for i, e := range s.endpoints {
+		addresses[i] = e.address
+	}
+	s.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, address := range addresses {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+
+			latency, err := s.probe(address)
+			s.report(address, latency, err)
+
+			s.mu.Lock()
+			for _, e := range s.endpoints {
+				if e.address == address {
+					e.lastProbe = time.Now()
+				}
+			}
+			s.mu.Unlock()
+		}(address)
+	}
+	wg.Wait()
+}
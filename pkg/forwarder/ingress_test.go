@@ -0,0 +1,211 @@
+package forwarder
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// newTestIngressSet tracks addresses without starting the probe loop
+func newTestIngressSet(addresses ...string) *ingressSet {
+	s := &ingressSet{
+		logger: logr.Discard(),
+		wake:   make(chan struct{}, 1),
+	}
+	for _, address := range addresses {
+		s.add(address)
+	}
+	return s
+}
+
+func TestIngressPreferred(t *testing.T) {
+	s := newTestIngressSet("fast:443", "slow:443")
+	s.report("fast:443", 10*time.Millisecond, nil)
+	s.report("slow:443", 90*time.Millisecond, nil)
+
+	if !s.prefer("slow:443") {
+		t.Error("prefer() = false for a new preference")
+	}
+	if s.prefer("slow:443") {
+		t.Error("prefer() = true for the current preference")
+	}
+	if got, want := s.candidates(), []string{"slow:443", "fast:443"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("healthy preferred: candidates() = %v, want %v", got, want)
+	}
+
+	// An unhealthy preferred endpoint loses its place
+	for i := 0; i < failuresUntilUnhealthy; i++ {
+		s.report("slow:443", 0, errors.New("refused"))
+	}
+	if got, want := s.candidates(), []string{"fast:443", "slow:443"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unhealthy preferred: candidates() = %v, want %v", got, want)
+	}
+
+	// Preferring an unknown address starts tracking it
+	s.prefer("registered:443")
+	if got, want := s.candidates(), []string{"registered:443", "fast:443", "slow:443"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("new preferred: candidates() = %v, want %v", got, want)
+	}
+}
+
+func TestIngressCandidates(t *testing.T) {
+	refused := errors.New("connection refused")
+
+	// report is one dial or probe outcome
+	type report struct {
+		address string
+		latency time.Duration
+		err     error
+	}
+
+	tests := []struct {
+		name    string
+		add     []string
+		reports []report
+		want    []string
+	}{
+		{
+			name: "unprobed keep configured order",
+			add:  []string{"a:443", "b:443", "c:443"},
+			want: []string{"a:443", "b:443", "c:443"},
+		},
+		{
+			name: "duplicates are tracked once",
+			add:  []string{"a:443", "b:443", "a:443"},
+			want: []string{"a:443", "b:443"},
+		},
+		{
+			name: "healthy by latency before unprobed",
+			add:  []string{"a:443", "b:443", "c:443"},
+			reports: []report{
+				{"c:443", 30 * time.Millisecond, nil},
+				{"b:443", 10 * time.Millisecond, nil},
+			},
+			want: []string{"b:443", "c:443", "a:443"},
+		},
+		{
+			name: "one failure keeps an endpoint healthy",
+			add:  []string{"a:443", "b:443"},
+			reports: []report{
+				{"a:443", 10 * time.Millisecond, nil},
+				{"b:443", 20 * time.Millisecond, nil},
+				{"a:443", 0, refused},
+			},
+			want: []string{"a:443", "b:443"},
+		},
+		{
+			name: "unhealthy after consecutive failures, behind unprobed",
+			add:  []string{"a:443", "b:443", "c:443"},
+			reports: []report{
+				{"a:443", 10 * time.Millisecond, nil},
+				{"b:443", 20 * time.Millisecond, nil},
+				{"a:443", 0, refused},
+				{"a:443", 0, refused},
+			},
+			want: []string{"b:443", "c:443", "a:443"},
+		},
+		{
+			name: "failures must be consecutive",
+			add:  []string{"a:443", "b:443"},
+			reports: []report{
+				{"a:443", 10 * time.Millisecond, nil},
+				{"b:443", 20 * time.Millisecond, nil},
+				{"a:443", 0, refused},
+				{"a:443", 10 * time.Millisecond, nil},
+				{"a:443", 0, refused},
+			},
+			want: []string{"a:443", "b:443"},
+		},
+		{
+			name: "success brings an endpoint back",
+			add:  []string{"a:443", "b:443"},
+			reports: []report{
+				{"a:443", 10 * time.Millisecond, nil},
+				{"b:443", 20 * time.Millisecond, nil},
+				{"a:443", 0, refused},
+				{"a:443", 0, refused},
+				{"a:443", 10 * time.Millisecond, nil},
+			},
+			want: []string{"a:443", "b:443"},
+		},
+		{
+			name: "never reached endpoints go last in configured order",
+			add:  []string{"a:443", "b:443", "c:443"},
+			reports: []report{
+				{"a:443", 0, refused},
+				{"a:443", 0, refused},
+				{"b:443", 0, refused},
+				{"b:443", 0, refused},
+			},
+			want: []string{"c:443", "a:443", "b:443"},
+		},
+		{
+			name: "latency is smoothed",
+			add:  []string{"a:443", "b:443"},
+			reports: []report{
+				{"a:443", 10 * time.Millisecond, nil},
+				{"b:443", 20 * time.Millisecond, nil},
+				// One slow probe moves a to 17.5ms, still ahead of b
+				{"a:443", 40 * time.Millisecond, nil},
+			},
+			want: []string{"a:443", "b:443"},
+		},
+		{
+			name: "reports for unknown addresses are ignored",
+			add:  []string{"a:443"},
+			reports: []report{
+				{"x:443", 0, refused},
+				{"x:443", 0, refused},
+			},
+			want: []string{"a:443"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestIngressSet(tt.add...)
+			for _, r := range tt.reports {
+				s.report(r.address, r.latency, r.err)
+			}
+
+			if got := s.candidates(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("candidates() = %v, want %v", got, tt.want)
+			}
+
+			// states reports the first candidate as preferred
+			for _, state := range s.states() {
+				if state.Preferred != (state.Address == tt.want[0]) {
+					t.Errorf("%s preferred = %v, first candidate is %s", state.Address, state.Preferred, tt.want[0])
+				}
+			}
+		})
+	}
+}
+
+func TestIngressAdd(t *testing.T) {
+	s := newTestIngressSet("a:443")
+	<-s.wake
+
+	if s.add("a:443") {
+		t.Error("add() = true for a known address")
+	}
+	select {
+	case <-s.wake:
+		t.Error("add() woke the probe loop for a known address")
+	default:
+	}
+
+	if !s.add("b:443") {
+		t.Error("add() = false for a new address")
+	}
+
+	// A newcomer wakes the probe loop
+	select {
+	case <-s.wake:
+	default:
+		t.Error("add() didn't wake the probe loop")
+	}
+}
@@ -0,0 +1,238 @@
+package forwarder
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	defaultPoolMaxIdle = 30 * time.Second
+
+	// poolRetryInterval is the wait after a failed dial before refilling again
+	poolRetryInterval = 5 * time.Second
+)
+
+// PoolStats reports ingress connection pool usage
+type PoolStats struct {
+	Enabled bool  `json:"enabled"`
+	Size    int   `json:"size"`
+	Idle    int   `json:"idle"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// idleConn is a handshaked connection waiting in the pool
+type idleConn struct {
+	conn    net.Conn
+	created time.Time
+	gen     uint64 // pool generation the connection was dialed in
+}
+
+// connPool keeps a number of idle, already-handshaked mTLS connections to
+// the ingress so new local connections skip the dial and handshake
+type connPool struct {
+	size    int
+	maxIdle time.Duration
+	dial    func() (net.Conn, error)
+	logger  logr.Logger
+
+	mu   sync.Mutex
+	idle []idleConn
+
+	// gen is bumped by flush; connections dialed in an earlier
+	// generation are discarded
+	gen uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newConnPool(size int, maxIdle time.Duration, dial func() (net.Conn, error), logger logr.Logger) *connPool {
+	if maxIdle <= 0 {
+		maxIdle = defaultPoolMaxIdle
+	}
+
+	p := &connPool{
+		size:    size,
+		maxIdle: maxIdle,
+		dial:    dial,
+		logger:  logger,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go p.maintain()
+	return p
+}
+
+// get returns an idle connection, or ok=false if none is available
+func (p *connPool) get() (conn net.Conn, ok bool) {
+	p.mu.Lock()
+	for len(p.idle) > 0 {
+		// Newest first - least likely to have been closed by the ingress
+		ic := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if ic.gen != p.gen || time.Since(ic.created) > p.maxIdle {
+			ic.conn.Close()
+			continue
+		}
+
+		conn = ic.conn
+		break
+	}
+	p.mu.Unlock()
+
+	p.refill()
+
+	if conn == nil {
+		p.misses.Add(1)
+		return nil, false
+	}
+	p.hits.Add(1)
+	return conn, true
+}
+
+// flush closes all idle connections, e.g. after the client certificate
+// changed. Dials still in flight are discarded when they finish.
+func (p *connPool) flush() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.gen++
+	p.mu.Unlock()
+
+	for _, ic := range idle {
+		ic.conn.Close()
+	}
+
+	p.refill()
+}
+
+// close stops refilling and closes all idle connections
+func (p *connPool) close() {
+	close(p.stop)
+	<-p.done
+
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	for _, ic := range idle {
+		ic.conn.Close()
+	}
+}
+
+func (p *connPool) stats() PoolStats {
+	p.mu.Lock()
+	idle := len(p.idle)
+	p.mu.Unlock()
+
+	return PoolStats{
+		Enabled: true,
+		Size:    p.size,
+		Idle:    idle,
+		Hits:    p.hits.Load(),
+		Misses:  p.misses.Load(),
+	}
+}
+
+// refill asks the maintenance loop to top the pool up
+func (p *connPool) refill() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// maintain keeps the pool filled and evicts connections past their max idle age
+func (p *connPool) maintain() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.maxIdle / 2)
+	defer ticker.Stop()
+
+	p.fill()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.evictExpired()
+		case <-p.wake:
+		}
+		p.fill()
+	}
+}
+
+// fill dials until the pool is full, pausing after a failed dial
+func (p *connPool) fill() {
+	for {
+		p.mu.Lock()
+		missing := p.size - len(p.idle)
+		gen := p.gen
+		p.mu.Unlock()
+		if missing <= 0 {
+			return
+		}
+
+		conn, err := p.dial()
+		if err != nil {
+			p.logger.V(1).Info("Failed to pre-warm ingress connection", "error", err)
+			select {
+			case <-p.stop:
+			case <-time.After(poolRetryInterval):
+			}
+			return
+		}
+
+		select {
+		case <-p.stop:
+			conn.Close()
+			return
+		default:
+		}
+
+		p.mu.Lock()
+		stale := gen != p.gen
+		if !stale {
+			p.idle = append(p.idle, idleConn{conn: conn, created: time.Now(), gen: gen})
+		}
+		p.mu.Unlock()
+
+		if stale {
+			// Dialed with the certificate or ingress from before a flush
+			conn.Close()
+		}
+	}
+}
+
+func (p *connPool) evictExpired() {
+	p.mu.Lock()
+	kept := p.idle[:0]
+	var expired []net.Conn
+	for _, ic := range p.idle {
+		if time.Since(ic.created) > p.maxIdle {
+			expired = append(expired, ic.conn)
+			continue
+		}
+		kept = append(kept, ic)
+	}
+	p.idle = kept
+	p.mu.Unlock()
+
+	for _, c := range expired {
+		c.Close()
+	}
+}
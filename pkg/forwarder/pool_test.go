@@ -0,0 +1,125 @@
+package forwarder
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// fakeConn is a connection that records whether it was closed
+type fakeConn struct {
+	net.Conn
+	id     int
+	closed atomic.Bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+// waitIdle waits until the pool holds n idle connections
+func waitIdle(t *testing.T, p *connPool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.stats().Idle != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool has %d idle connections, want %d", p.stats().Idle, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolGetAndFlush(t *testing.T) {
+	var dials atomic.Int32
+	p := newConnPool(2, time.Minute, func() (net.Conn, error) {
+		return &fakeConn{id: int(dials.Add(1))}, nil
+	}, logr.Discard())
+	defer p.close()
+
+	waitIdle(t, p, 2)
+	first, ok := p.get()
+	if !ok || first.(*fakeConn).id != 2 {
+		t.Fatalf("get = %v, %v; want the newest connection", first, ok)
+	}
+	waitIdle(t, p, 2)
+
+	p.mu.Lock()
+	flushed := []*fakeConn{p.idle[0].conn.(*fakeConn), p.idle[1].conn.(*fakeConn)}
+	p.mu.Unlock()
+
+	p.flush()
+	for _, c := range flushed {
+		if !c.closed.Load() {
+			t.Errorf("connection %d not closed by flush", c.id)
+		}
+	}
+	waitIdle(t, p, 2)
+
+	if conn, ok := p.get(); !ok || conn.(*fakeConn).closed.Load() {
+		t.Errorf("get after flush = %v, %v; want a fresh connection", conn, ok)
+	}
+	if stats := p.stats(); stats.Hits != 2 || stats.Misses != 0 {
+		t.Errorf("hits/misses = %d/%d, want 2/0", stats.Hits, stats.Misses)
+	}
+}
+
+func TestPoolFlushDiscardsInFlightDial(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var dialed []*fakeConn
+	var dials atomic.Int32
+
+	p := newConnPool(1, time.Minute, func() (net.Conn, error) {
+		n := dials.Add(1)
+		c := &fakeConn{id: int(n)}
+		if n == 1 {
+			started <- struct{}{}
+			<-release
+		}
+		dialed = append(dialed, c)
+		return c, nil
+	}, logr.Discard())
+	defer p.close()
+
+	// Flush while the first dial is still handshaking with the old certificate
+	<-started
+	p.flush()
+	close(release)
+
+	waitIdle(t, p, 1)
+	conn, ok := p.get()
+	if !ok {
+		t.Fatal("pool is empty after refill")
+	}
+	if id := conn.(*fakeConn).id; id == 1 {
+		t.Fatal("got the connection dialed before the flush")
+	}
+	if !dialed[0].closed.Load() {
+		t.Error("stale connection wasn't closed")
+	}
+}
+
+func TestPoolGetSkipsExpiredAndStale(t *testing.T) {
+	p := &connPool{maxIdle: time.Minute, wake: make(chan struct{}, 1)}
+	expired := &fakeConn{id: 1}
+	stale := &fakeConn{id: 2}
+	p.gen = 1
+	p.idle = []idleConn{
+		{conn: expired, created: time.Now().Add(-time.Hour), gen: 1},
+		{conn: stale, created: time.Now(), gen: 0},
+	}
+
+	if conn, ok := p.get(); ok {
+		t.Fatalf("get = %v, want a miss", conn)
+	}
+	if !expired.closed.Load() || !stale.closed.Load() {
+		t.Error("expired or stale connection wasn't closed")
+	}
+	if stats := p.stats(); stats.Misses != 1 || stats.Idle != 0 {
+		t.Errorf("stats = %+v, want one miss and nothing idle", stats)
+	}
+}
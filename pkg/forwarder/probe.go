@@ -0,0 +1,96 @@
+package forwarder
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPProbe is the request a synthetic probe sends to HTTP endpoints
+type HTTPProbe struct {
+	Method string // Default: GET
+	Path   string
+
+	// ExpectStatus lists the accepted status codes. Empty accepts any
+	// status below 500.
+	ExpectStatus []int
+}
+
+// ProbeResult is the outcome of one synthetic probe
+type ProbeResult struct {
+	// Latency is the time to an upgraded connection, or for HTTP probes
+	// to the response headers
+	Latency time.Duration
+
+	// StatusCode is the HTTP probe's response status (0 if none was sent)
+	StatusCode int
+
+	// Err is nil if the probe passed. Failures to connect carry a
+	// *ForwardError; see Classify.
+	Err error
+}
+
+// ProbeEndpoint checks a bound endpoint the way a local client would: it
+// dials the ingress and performs the binding upgrade through the same path
+// as ForwardConnection. If req is set and the endpoint is HTTP, it then
+// sends the request and checks the response status. Probes dial a fresh
+// connection rather than take one from the pool.
+func (f *Forwarder) ProbeEndpoint(endpoint BoundEndpoint, req *HTTPProbe, timeout time.Duration) ProbeResult {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	conn, host, resp, err := f.connect(endpoint, deadline, true)
+	if err != nil {
+		return ProbeResult{Latency: time.Since(start), Err: err}
+	}
+	defer conn.Close()
+
+	if req == nil || req.Path == "" || (resp.Proto != "http" && resp.Proto != "https") {
+		return ProbeResult{Latency: time.Since(start)}
+	}
+
+	conn.SetDeadline(deadline)
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	probeReq := &http.Request{
+		Method:     method,
+		RequestURI: req.Path,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"User-Agent": {"ngrokd-prober"},
+			"Connection": {"close"},
+		},
+	}
+	if err := writeRequest(bufio.NewWriter(conn), conn, probeReq, host); err != nil {
+		return ProbeResult{Latency: time.Since(start), Err: streamError(fmt.Errorf("failed to send probe request: %w", err))}
+	}
+
+	httpResp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: method})
+	latency := time.Since(start)
+	if err != nil {
+		return ProbeResult{Latency: latency, Err: streamError(fmt.Errorf("failed to read probe response: %w", err))}
+	}
+	httpResp.Body.Close()
+
+	result := ProbeResult{Latency: latency, StatusCode: httpResp.StatusCode}
+	if !req.accepts(httpResp.StatusCode) {
+		result.Err = fmt.Errorf("unexpected status %s", httpResp.Status)
+	}
+	return result
+}
+
+func (p *HTTPProbe) accepts(status int) bool {
+	if len(p.ExpectStatus) == 0 {
+		return status < 500
+	}
+	for _, s := range p.ExpectStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
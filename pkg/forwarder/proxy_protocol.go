@@ -0,0 +1,105 @@
+package forwarder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// PROXY protocol versions (EndpointOptions.ProxyProtocol)
+const (
+	ProxyProtocolV1 = "v1"
+	ProxyProtocolV2 = "v2"
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header
+var proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// writeProxyHeader writes a PROXY protocol header describing a connection
+// from src to dst. Non-TCP addresses produce an UNKNOWN (v1) or LOCAL (v2)
+// header.
+func writeProxyHeader(w io.Writer, version string, src, dst net.Addr) error {
+	var header []byte
+	switch version {
+	case ProxyProtocolV1:
+		header = proxyHeaderV1(src, dst)
+	case ProxyProtocolV2:
+		header = proxyHeaderV2(src, dst)
+	default:
+		return fmt.Errorf("unsupported PROXY protocol version %q", version)
+	}
+
+	_, err := w.Write(header)
+	return err
+}
+
+// proxyAddrs returns the TCP endpoints of a connection with both IPs in
+// the same family, or ok=false if they can't be represented
+func proxyAddrs(src, dst net.Addr) (srcAddr, dstAddr *net.TCPAddr, v4 bool, ok bool) {
+	s, sok := src.(*net.TCPAddr)
+	d, dok := dst.(*net.TCPAddr)
+	if !sok || !dok || s.IP == nil || d.IP == nil {
+		return nil, nil, false, false
+	}
+
+	v4 = s.IP.To4() != nil && d.IP.To4() != nil
+	return s, d, v4, true
+}
+
+func proxyHeaderV1(src, dst net.Addr) []byte {
+	s, d, v4, ok := proxyAddrs(src, dst)
+	if !ok {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+
+	if v4 {
+		return []byte(fmt.Sprintf("PROXY TCP4 %s %s %d %d\r\n", s.IP.To4(), d.IP.To4(), s.Port, d.Port))
+	}
+	// Mixed families are sent as IPv6, with IPv4 addresses mapped
+	return []byte(fmt.Sprintf("PROXY TCP6 %s %s %d %d\r\n", ipv6String(s.IP), ipv6String(d.IP), s.Port, d.Port))
+}
+
+func proxyHeaderV2(src, dst net.Addr) []byte {
+	var buf bytes.Buffer
+	buf.Write(proxyV2Signature)
+
+	s, d, v4, ok := proxyAddrs(src, dst)
+	if !ok {
+		// Version 2, LOCAL command, unspecified family, no addresses
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return buf.Bytes()
+	}
+
+	var addrs []byte
+	if v4 {
+		addrs = append(addrs, s.IP.To4()...)
+		addrs = append(addrs, d.IP.To4()...)
+	} else {
+		addrs = append(addrs, s.IP.To16()...)
+		addrs = append(addrs, d.IP.To16()...)
+	}
+	addrs = binary.BigEndian.AppendUint16(addrs, uint16(s.Port))
+	addrs = binary.BigEndian.AppendUint16(addrs, uint16(d.Port))
+
+	// Version 2, PROXY command
+	buf.WriteByte(0x21)
+	if v4 {
+		buf.WriteByte(0x11) // TCP over IPv4
+	} else {
+		buf.WriteByte(0x21) // TCP over IPv6
+	}
+	binary.Write(&buf, binary.BigEndian, uint16(len(addrs)))
+	buf.Write(addrs)
+
+	return buf.Bytes()
+}
+
+// ipv6String formats an IP in IPv6 notation, mapping IPv4 addresses
+func ipv6String(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
@@ -0,0 +1,114 @@
+package forwarder
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func tcpAddr(ip string, port int) *net.TCPAddr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+}
+
+func TestProxyHeaderV1(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst net.Addr
+		want     string
+	}{
+		{"ipv4", tcpAddr("192.0.2.10", 51234), tcpAddr("10.107.0.5", 5432), "PROXY TCP4 192.0.2.10 10.107.0.5 51234 5432\r\n"},
+		{"ipv6", tcpAddr("2001:db8::1", 40000), tcpAddr("2001:db8::2", 443), "PROXY TCP6 2001:db8::1 2001:db8::2 40000 443\r\n"},
+		{"mixed families", tcpAddr("192.0.2.10", 1), tcpAddr("2001:db8::2", 2), "PROXY TCP6 ::ffff:192.0.2.10 2001:db8::2 1 2\r\n"},
+		{"unix socket", &net.UnixAddr{Name: "/tmp/s", Net: "unix"}, tcpAddr("10.0.0.1", 80), "PROXY UNKNOWN\r\n"},
+		{"missing IP", &net.TCPAddr{Port: 1}, tcpAddr("10.0.0.1", 80), "PROXY UNKNOWN\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeProxyHeader(&buf, ProxyProtocolV1, tt.src, tt.dst); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("header = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyHeaderV2(t *testing.T) {
+	header := func(parts ...[]byte) []byte {
+		return append(append([]byte(nil), proxyV2Signature...), bytes.Join(parts, nil)...)
+	}
+
+	tests := []struct {
+		name     string
+		src, dst net.Addr
+		want     []byte
+	}{
+		{
+			name: "ipv4",
+			src:  tcpAddr("192.0.2.10", 51234),
+			dst:  tcpAddr("10.107.0.5", 5432),
+			want: header(
+				[]byte{0x21, 0x11, 0x00, 12},
+				[]byte{192, 0, 2, 10},
+				[]byte{10, 107, 0, 5},
+				[]byte{0xC8, 0x22}, // 51234
+				[]byte{0x15, 0x38}, // 5432
+			),
+		},
+		{
+			name: "ipv6",
+			src:  tcpAddr("2001:db8::1", 443),
+			dst:  tcpAddr("2001:db8::2", 8080),
+			want: header(
+				[]byte{0x21, 0x21, 0x00, 36},
+				net.ParseIP("2001:db8::1"),
+				net.ParseIP("2001:db8::2"),
+				[]byte{0x01, 0xBB}, // 443
+				[]byte{0x1F, 0x90}, // 8080
+			),
+		},
+		{
+			name: "mixed families",
+			src:  tcpAddr("192.0.2.10", 1),
+			dst:  tcpAddr("2001:db8::2", 2),
+			want: header(
+				[]byte{0x21, 0x21, 0x00, 36},
+				net.ParseIP("::ffff:192.0.2.10"),
+				net.ParseIP("2001:db8::2"),
+				[]byte{0x00, 0x01},
+				[]byte{0x00, 0x02},
+			),
+		},
+		{
+			name: "unix socket",
+			src:  &net.UnixAddr{Name: "/tmp/s", Net: "unix"},
+			dst:  tcpAddr("10.0.0.1", 80),
+			want: header([]byte{0x20, 0x00, 0x00, 0x00}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeProxyHeader(&buf, ProxyProtocolV2, tt.src, tt.dst); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("header =\n% x\nwant\n% x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyHeaderUnsupportedVersion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeProxyHeader(&buf, "v3", tcpAddr("10.0.0.1", 1), tcpAddr("10.0.0.2", 2)); err == nil {
+		t.Error("expected an error for v3")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes for an unsupported version", buf.Len())
+	}
+}
@@ -0,0 +1,233 @@
+package forwarder
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tunnel ties a local connection to its ingress connection. It copies
+// both directions with half-close and closes both connections once the
+// idle timeout or max lifetime expires.
+type tunnel struct {
+	local  net.Conn
+	remote net.Conn
+
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+
+	// lastActivity is the unix time in nanoseconds of the last read
+	lastActivity atomic.Int64
+
+	// expired is why the watchdog closed the tunnel, if it did
+	expired atomic.Pointer[expiry]
+
+	// bytesIn and bytesOut count bytes read from the local client and
+	// from the ingress
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// newTunnel starts tracking a connection pair. Zero timeouts are disabled.
+func newTunnel(local, remote net.Conn, idleTimeout, maxLifetime time.Duration) *tunnel {
+	t := &tunnel{
+		local:       local,
+		remote:      remote,
+		idleTimeout: idleTimeout,
+		maxLifetime: maxLifetime,
+		done:        make(chan struct{}),
+	}
+	t.touch()
+
+	if idleTimeout > 0 || maxLifetime > 0 {
+		go t.watch()
+	}
+	return t
+}
+
+// close closes both connections and stops the watchdog
+func (t *tunnel) close() {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.local.Close()
+		t.remote.Close()
+	})
+}
+
+// expiry records why the watchdog closed the tunnel
+type expiry struct {
+	reason string // CloseIdleTimeout or CloseMaxLifetime
+	detail string
+}
+
+// expiredReason describes why the tunnel timed out, or is "" if it didn't
+func (t *tunnel) expiredReason() string {
+	if e := t.expired.Load(); e != nil {
+		return e.detail
+	}
+	return ""
+}
+
+func (t *tunnel) touch() {
+	t.lastActivity.Store(time.Now().UnixNano())
+}
+
+// track wraps one of the tunnel's connections so reads count as activity
+// and traffic
+func (t *tunnel) track(c net.Conn) io.Reader {
+	return &activityReader{r: c, t: t, bytes: t.counter(c)}
+}
+
+// counter returns the byte counter for reads from c, or nil if c isn't
+// one of the tunnel's connections
+func (t *tunnel) counter(c io.Reader) *atomic.Int64 {
+	switch c {
+	case t.local:
+		return &t.bytesIn
+	case t.remote:
+		return &t.bytesOut
+	}
+	return nil
+}
+
+// stats returns the traffic counted so far, and the close reason if the
+// watchdog closed the tunnel
+func (t *tunnel) stats() ConnStats {
+	stats := ConnStats{
+		BytesIn:  t.bytesIn.Load(),
+		BytesOut: t.bytesOut.Load(),
+	}
+	if e := t.expired.Load(); e != nil {
+		stats.CloseReason = e.reason
+	}
+	return stats
+}
+
+// pipe copies localR to the remote and remoteR to the local connection
+// until both directions are done. When one side stops sending, the other
+// is half-closed so data can keep flowing back. The readers may carry
+// data already buffered from their connection.
+func (t *tunnel) pipe(localR, remoteR io.Reader) error {
+	errChan := make(chan error, 2)
+
+	go func() {
+		errChan <- t.copyHalf(t.remote, localR)
+	}()
+
+	go func() {
+		errChan <- t.copyHalf(t.local, remoteR)
+	}()
+
+	var firstErr error
+	for i := 0; i < 2; i++ {
+		if err := <-errChan; err != nil && firstErr == nil {
+			firstErr = err
+			// Unblock the other direction
+			t.close()
+		}
+	}
+	return firstErr
+}
+
+// copyHalf copies src to dst, then signals end of stream to dst. Reads
+// from the connections themselves are counted here; any other reader
+// comes from track and is counted there.
+func (t *tunnel) copyHalf(dst net.Conn, src io.Reader) error {
+	n, err := copyBuffered(dst, src, t.bufferSize(dst), t.touch)
+	if counter := t.counter(src); counter != nil {
+		counter.Add(n)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !closeWrite(dst) {
+		// Without half-close the peer would never see the end of stream
+		t.close()
+	}
+	return nil
+}
+
+// bufferSize picks the copy buffer size class for writes to dst
+func (t *tunnel) bufferSize(dst net.Conn) int {
+	if dst == t.remote {
+		// Reading from the local socket
+		return largeBufferSize
+	}
+	// Reading from the ingress, at most one TLS record at a time
+	return smallBufferSize
+}
+
+// watch closes the tunnel when it has been idle for too long or has
+// reached its max lifetime
+func (t *tunnel) watch() {
+	var lifetime <-chan time.Time
+	if t.maxLifetime > 0 {
+		timer := time.NewTimer(t.maxLifetime)
+		defer timer.Stop()
+		lifetime = timer.C
+	}
+
+	var idle *time.Timer
+	var idleC <-chan time.Time
+	if t.idleTimeout > 0 {
+		idle = time.NewTimer(t.idleTimeout)
+		defer idle.Stop()
+		idleC = idle.C
+	}
+
+	for {
+		select {
+		case <-t.done:
+			return
+
+		case <-lifetime:
+			t.expire(CloseMaxLifetime, fmt.Sprintf("max lifetime of %s reached", t.maxLifetime))
+			return
+
+		case <-idleC:
+			idleFor := time.Since(time.Unix(0, t.lastActivity.Load()))
+			if idleFor >= t.idleTimeout {
+				t.expire(CloseIdleTimeout, fmt.Sprintf("idle for %s", t.idleTimeout))
+				return
+			}
+			idle.Reset(t.idleTimeout - idleFor)
+		}
+	}
+}
+
+func (t *tunnel) expire(reason, detail string) {
+	t.expired.Store(&expiry{reason: reason, detail: detail})
+	t.close()
+}
+
+// closeWrite half-closes c if it supports it (*net.TCPConn, *tls.Conn)
+func closeWrite(c net.Conn) bool {
+	cw, ok := c.(interface{ CloseWrite() error })
+	if !ok {
+		return false
+	}
+	return cw.CloseWrite() == nil
+}
+
+// activityReader records reads on its tunnel
+type activityReader struct {
+	r     io.Reader
+	t     *tunnel
+	bytes *atomic.Int64
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.t.touch()
+		a.bytes.Add(int64(n))
+	}
+	return n, err
+}
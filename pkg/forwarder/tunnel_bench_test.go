@@ -0,0 +1,174 @@
+package forwarder
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// startEchoServer starts a server that echoes every connection back,
+// over TLS if config is set
+func startEchoServer(b *testing.B, config *tls.Config) string {
+	b.Helper()
+
+	var ln net.Listener
+	var err error
+	if config != nil {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", config)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// echoTLSConfig returns a server config with a throwaway self-signed certificate
+func echoTLSConfig(b *testing.B) *tls.Config {
+	b.Helper()
+	return &tls.Config{Certificates: []tls.Certificate{selfSignedCert(b, "echo")}}
+}
+
+// tcpPair returns both ends of a loopback TCP connection
+func tcpPair(tb testing.TB) (client, server net.Conn) {
+	tb.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+
+	client, err = net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return client, <-accepted
+}
+
+// dialTunnel connects a local client through a tunnel to the echo server
+func dialTunnel(b *testing.B, addr string, tlsConfig *tls.Config, idleTimeout time.Duration) (client net.Conn, done <-chan error) {
+	b.Helper()
+
+	var remote net.Conn
+	var err error
+	if tlsConfig != nil {
+		remote, err = tls.Dial("tcp", addr, tlsConfig)
+	} else {
+		remote, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	client, local := tcpPair(b)
+	t := newTunnel(local, remote, idleTimeout, 0)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- t.pipe(local, remote)
+		t.close()
+	}()
+	return client, errc
+}
+
+func benchmarkThroughput(b *testing.B, serverConfig, clientConfig *tls.Config, idleTimeout time.Duration) {
+	addr := startEchoServer(b, serverConfig)
+	client, done := dialTunnel(b, addr, clientConfig, idleTimeout)
+	defer client.Close()
+
+	chunk := make([]byte, 64<<10)
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			if _, err := client.Write(chunk); err != nil {
+				return
+			}
+		}
+		client.(*net.TCPConn).CloseWrite()
+	}()
+
+	n, err := io.Copy(io.Discard, client)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if n != int64(b.N*len(chunk)) {
+		b.Fatalf("echoed %d bytes, want %d", n, b.N*len(chunk))
+	}
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkTunnelThroughputTLS streams through a tunnel to a TLS echo
+// server, like traffic to the ingress
+func BenchmarkTunnelThroughputTLS(b *testing.B) {
+	benchmarkThroughput(b, echoTLSConfig(b), &tls.Config{InsecureSkipVerify: true}, time.Minute)
+}
+
+// BenchmarkTunnelThroughputTCP streams to a plain TCP echo server, to
+// measure the copy loop without TLS overhead
+func BenchmarkTunnelThroughputTCP(b *testing.B) {
+	benchmarkThroughput(b, nil, nil, 0)
+}
+
+// BenchmarkTunnelConnection measures a short connection: handshake, one
+// small round trip and half-close in both directions
+func BenchmarkTunnelConnection(b *testing.B) {
+	addr := startEchoServer(b, echoTLSConfig(b))
+	clientConfig := &tls.Config{
+		InsecureSkipVerify: true,
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+
+	msg := make([]byte, 1<<10)
+	reply := make([]byte, len(msg))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		client, done := dialTunnel(b, addr, clientConfig, time.Minute)
+
+		if _, err := client.Write(msg); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.ReadFull(client, reply); err != nil {
+			b.Fatal(err)
+		}
+		client.(*net.TCPConn).CloseWrite()
+		if _, err := io.Copy(io.Discard, client); err != nil {
+			b.Fatal(err)
+		}
+		if err := <-done; err != nil {
+			b.Fatal(err)
+		}
+		client.Close()
+	}
+}
@@ -0,0 +1,183 @@
+package forwarder
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTunnel pipes a loopback client connection to a loopback backend
+// connection through a tunnel with the given timeouts
+func startTunnel(t *testing.T, idleTimeout, maxLifetime time.Duration) (client, backend net.Conn, tun *tunnel, done <-chan error) {
+	t.Helper()
+
+	client, local := tcpPair(t)
+	remote, backend := tcpPair(t)
+	deadline := time.Now().Add(10 * time.Second)
+	for _, c := range []net.Conn{client, local, remote, backend} {
+		c.SetDeadline(deadline)
+		t.Cleanup(func() { c.Close() })
+	}
+
+	tun = newTunnel(local, remote, idleTimeout, maxLifetime)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- tun.pipe(local, remote)
+		tun.close()
+	}()
+	return client, backend, tun, errc
+}
+
+// keepBusy sends a byte from client to backend every interval until stop
+// is closed
+func keepBusy(client, backend net.Conn, interval time.Duration, stop <-chan struct{}) {
+	go io.Copy(io.Discard, backend)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+			if _, err := client.Write([]byte{0}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestTunnelHalfClose(t *testing.T) {
+	client, backend, tun, done := startTunnel(t, time.Minute, 0)
+
+	request := []byte("request")
+	response := bytes.Repeat([]byte("response"), 32<<10)
+
+	if _, err := client.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backend only answers once it has seen the end of the request
+	got, err := io.ReadAll(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, request) {
+		t.Errorf("backend read %q, want %q", got, request)
+	}
+	if _, err := backend.Write(response); err != nil {
+		t.Fatal(err)
+	}
+	backend.Close()
+
+	got, err = io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, response) {
+		t.Errorf("client read %d bytes, want %d", len(got), len(response))
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("pipe = %v", err)
+	}
+	stats := tun.stats()
+	if stats.BytesIn != int64(len(request)) || stats.BytesOut != int64(len(response)) {
+		t.Errorf("stats = %+v, want %d bytes in and %d out", stats, len(request), len(response))
+	}
+	if stats.CloseReason != "" || tun.expiredReason() != "" {
+		t.Errorf("close reason = %q, want none from the tunnel", stats.CloseReason)
+	}
+}
+
+func TestTunnelIdleTimeout(t *testing.T) {
+	const idle = 200 * time.Millisecond
+	client, backend, tun, done := startTunnel(t, idle, 0)
+
+	// Traffic for several idle periods keeps pushing the timeout back
+	stop := make(chan struct{})
+	go keepBusy(client, backend, idle/4, stop)
+	time.Sleep(4 * idle)
+	select {
+	case err := <-done:
+		t.Fatalf("tunnel closed while active: %v (%s)", err, tun.expiredReason())
+	default:
+	}
+
+	close(stop)
+	quiet := time.Now()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle tunnel wasn't closed")
+	}
+	if elapsed := time.Since(quiet); elapsed < idle-idle/4 {
+		t.Errorf("closed %s after the last write, before the %s idle timeout", elapsed, idle)
+	}
+
+	if reason := tun.stats().CloseReason; reason != CloseIdleTimeout {
+		t.Errorf("close reason = %q, want %q", reason, CloseIdleTimeout)
+	}
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Error("client connection still open")
+	}
+}
+
+func TestTunnelTouchPostponesIdleTimeout(t *testing.T) {
+	const idle = 100 * time.Millisecond
+	local, _ := net.Pipe()
+	remote, _ := net.Pipe()
+	tun := newTunnel(local, remote, idle, 0)
+	defer tun.close()
+
+	for i := 0; i < 10; i++ {
+		time.Sleep(idle / 4)
+		tun.touch()
+	}
+	if reason := tun.expiredReason(); reason != "" {
+		t.Fatalf("expired despite activity: %s", reason)
+	}
+
+	select {
+	case <-tun.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle tunnel wasn't closed")
+	}
+	if reason := tun.stats().CloseReason; reason != CloseIdleTimeout {
+		t.Errorf("close reason = %q, want %q", reason, CloseIdleTimeout)
+	}
+}
+
+func TestTunnelMaxLifetime(t *testing.T) {
+	const lifetime = 300 * time.Millisecond
+	client, backend, tun, done := startTunnel(t, time.Minute, lifetime)
+	start := time.Now()
+
+	// Activity doesn't extend the lifetime
+	stop := make(chan struct{})
+	defer close(stop)
+	go keepBusy(client, backend, 10*time.Millisecond, stop)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tunnel outlived its max lifetime")
+	}
+	if elapsed := time.Since(start); elapsed < lifetime {
+		t.Errorf("closed after %s, before the %s max lifetime", elapsed, lifetime)
+	}
+
+	stats := tun.stats()
+	if stats.CloseReason != CloseMaxLifetime {
+		t.Errorf("close reason = %q, want %q", stats.CloseReason, CloseMaxLifetime)
+	}
+	if stats.BytesIn == 0 {
+		t.Error("no traffic counted before the tunnel expired")
+	}
+	if reason := tun.expiredReason(); !strings.Contains(reason, "max lifetime") {
+		t.Errorf("expired reason = %q", reason)
+	}
+}
@@ -0,0 +1,247 @@
+package forwarder
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+// Ingress TLS verification modes (Config.TLSVerify)
+const (
+	TLSVerifyStrict   = "strict"   // refuse connections that fail verification
+	TLSVerifyCA       = "ca"       // verify, but only warn on failure
+	TLSVerifyInsecure = "insecure" // don't verify the ingress at all
+)
+
+// defaultCABundlePath holds extra ingress CAs, as mounted for the ngrok
+// operator. A var so tests can point it elsewhere.
+var defaultCABundlePath = "/etc/ssl/certs/ngrok/"
+
+// pinPrefix starts every SPKI pin: sha256/<base64 digest>
+const pinPrefix = "sha256/"
+
+// verifier checks the ingress certificate chain and SPKI pins
+type verifier struct {
+	mode   string
+	roots  *x509.CertPool
+	pins   map[string]bool
+	logger logr.Logger
+
+	// warned holds failures already logged in ca mode, so each is logged
+	// once. It's reset when it reaches maxWarned.
+	warnedMu sync.Mutex
+	warned   map[string]bool
+}
+
+// maxWarned bounds the ca mode failures remembered for deduplication
+const maxWarned = 256
+
+func newVerifier(mode, caBundle string, pins []string, logger logr.Logger) (*verifier, error) {
+	if mode == "" {
+		mode = TLSVerifyStrict
+	}
+	switch mode {
+	case TLSVerifyStrict, TLSVerifyCA, TLSVerifyInsecure:
+	default:
+		return nil, fmt.Errorf("unknown TLS verify mode %q", mode)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		// Fall back to empty pool if system CAs can't be loaded
+		roots = x509.NewCertPool()
+	}
+
+	if caBundle != "" {
+		if err := loadCABundle(roots, caBundle); err != nil {
+			return nil, fmt.Errorf("failed to load ingress CA bundle: %w", err)
+		}
+	} else if err := loadCABundle(roots, defaultCABundlePath); err != nil {
+		if mode == TLSVerifyStrict {
+			return nil, missingCABundleError(err)
+		}
+		logger.V(1).Info("No custom ngrok certs loaded", "error", err)
+	}
+
+	v := &verifier{
+		mode:   mode,
+		roots:  roots,
+		pins:   make(map[string]bool, len(pins)),
+		logger: logger,
+		warned: make(map[string]bool),
+	}
+	for _, pin := range pins {
+		if err := ValidatePin(pin); err != nil {
+			return nil, err
+		}
+		v.pins[pin] = true
+	}
+
+	switch mode {
+	case TLSVerifyInsecure:
+		logger.Info("⚠️  Ingress TLS verification is disabled (tls_verify: insecure)")
+	case TLSVerifyCA:
+		logger.Info("⚠️  Ingress TLS verification failures are only logged (tls_verify: ca)")
+	}
+	return v, nil
+}
+
+// ValidateCABundle checks that strict verification has an ngrok CA to
+// verify the ingress against: caBundle, or the bundle at
+// /etc/ssl/certs/ngrok/. Without one strict mode would refuse every
+// connection, which installs from before strict became the default hit on
+// upgrade.
+func ValidateCABundle(mode, caBundle string) error {
+	if (mode != "" && mode != TLSVerifyStrict) || caBundle != "" {
+		return nil
+	}
+	if err := loadCABundle(x509.NewCertPool(), defaultCABundlePath); err != nil {
+		return missingCABundleError(err)
+	}
+	return nil
+}
+
+func missingCABundleError(err error) error {
+	return fmt.Errorf("ingress TLS verification is strict but no ngrok CA bundle was found at %s (%v): "+
+		"set ingress.ca_bundle to the ngrok ingress CA, or set ingress.tls_verify to ca to only log verification failures",
+		defaultCABundlePath, err)
+}
+
+// verifyConnection backs tls.Config.VerifyConnection for a dial to
+// serverName. Go's own verification is skipped so ca mode can downgrade
+// failures to warnings.
+func (v *verifier) verifyConnection(serverName string, cs tls.ConnectionState) error {
+	if v.mode == TLSVerifyInsecure {
+		return nil
+	}
+
+	err := v.check(serverName, cs)
+	if err == nil {
+		return nil
+	}
+	if v.mode == TLSVerifyStrict {
+		return err
+	}
+
+	if v.firstWarning(serverName + ": " + err.Error()) {
+		v.logger.Info("⚠️  Ingress certificate failed verification, connecting anyway (tls_verify: ca)",
+			"server", serverName, "error", err)
+	}
+	return nil
+}
+
+// firstWarning reports whether key hasn't been logged yet and records it
+func (v *verifier) firstWarning(key string) bool {
+	v.warnedMu.Lock()
+	defer v.warnedMu.Unlock()
+
+	if v.warned[key] {
+		return false
+	}
+	if len(v.warned) >= maxWarned {
+		clear(v.warned)
+	}
+	v.warned[key] = true
+	return true
+}
+
+// check verifies the chain against the trusted roots for serverName (a
+// hostname or IP) and, if pins are set, that the chain contains a pinned key
+func (v *verifier) check(serverName string, cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("ingress presented no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	chains, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         v.roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return fmt.Errorf("ingress certificate verification failed: %w", err)
+	}
+
+	if len(v.pins) == 0 {
+		return nil
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if v.pins[spkiPin(cert)] {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("ingress certificate chain matches none of the %d pinned keys (leaf is %s)",
+		len(v.pins), spkiPin(cs.PeerCertificates[0]))
+}
+
+// spkiPin returns the sha256/<base64> pin of a certificate's public key
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ValidatePin checks that pin has the form sha256/<base64 SHA-256 digest>
+func ValidatePin(pin string) error {
+	digest, ok := strings.CutPrefix(pin, pinPrefix)
+	if !ok {
+		return fmt.Errorf("invalid pin %q: must start with %q", pin, pinPrefix)
+	}
+	raw, err := base64.StdEncoding.DecodeString(digest)
+	if err != nil || len(raw) != sha256.Size {
+		return fmt.Errorf("invalid pin %q: must be a base64 SHA-256 digest", pin)
+	}
+	return nil
+}
+
+// loadCABundle adds the PEM certificates in path, a file or a directory
+// of files, to pool
+func loadCABundle(pool *x509.CertPool, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	loaded := 0
+	for _, file := range files {
+		certPEM, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if pool.AppendCertsFromPEM(certPEM) {
+			loaded++
+		}
+	}
+	if loaded == 0 {
+		return fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package forwarder
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+// writeCABundle writes cert to a PEM file and returns its path
+func writeCABundle(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+// withDefaultCABundle points defaultCABundlePath at path for the test
+func withDefaultCABundle(t *testing.T, path string) {
+	t.Helper()
+
+	old := defaultCABundlePath
+	defaultCABundlePath = path
+	t.Cleanup(func() { defaultCABundlePath = old })
+}
+
+func TestNewVerifierDefaultMode(t *testing.T) {
+	cert := selfSignedCert(t, "ca")
+	bundle := writeCABundle(t, cert)
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	pin := spkiPin(leaf)
+
+	// As mounted for the operator
+	withDefaultCABundle(t, bundle)
+
+	tests := []struct {
+		name     string
+		mode     string
+		caBundle string
+		pins     []string
+		want     string
+	}{
+		{"nothing configured", "", "", nil, TLSVerifyStrict},
+		{"bundle", "", bundle, nil, TLSVerifyStrict},
+		{"pins", "", "", []string{pin}, TLSVerifyStrict},
+		{"explicit ca with pins", TLSVerifyCA, "", []string{pin}, TLSVerifyCA},
+		{"explicit insecure", TLSVerifyInsecure, bundle, nil, TLSVerifyInsecure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := newVerifier(tt.mode, tt.caBundle, tt.pins, logr.Discard())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.mode != tt.want {
+				t.Errorf("mode = %s, want %s", v.mode, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewVerifierStrictNeedsCABundle(t *testing.T) {
+	bundle := writeCABundle(t, selfSignedCert(t, "ca"))
+	withDefaultCABundle(t, filepath.Join(t.TempDir(), "missing"))
+
+	tests := []struct {
+		name     string
+		mode     string
+		caBundle string
+		wantErr  bool
+	}{
+		{"default mode", "", "", true},
+		{"strict", TLSVerifyStrict, "", true},
+		{"strict with bundle", TLSVerifyStrict, bundle, false},
+		{"ca", TLSVerifyCA, "", false},
+		{"insecure", TLSVerifyInsecure, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newVerifier(tt.mode, tt.caBundle, nil, logr.Discard())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newVerifier() = %v, want error %v", err, tt.wantErr)
+			}
+			// The error names the settings that fix it
+			if err != nil && (!strings.Contains(err.Error(), "ingress.ca_bundle") || !strings.Contains(err.Error(), "ingress.tls_verify")) {
+				t.Errorf("error %q doesn't name ingress.ca_bundle and ingress.tls_verify", err)
+			}
+		})
+	}
+}
+
+func TestVerifyConnection(t *testing.T) {
+	withDefaultCABundle(t, writeCABundle(t, selfSignedCert(t, "ca")))
+
+	cert := selfSignedCert(t, "ingress")
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+
+	// The self-signed certificate isn't trusted, so verification fails
+	tests := []struct {
+		mode    string
+		wantErr bool
+	}{
+		{TLSVerifyStrict, true},
+		{TLSVerifyCA, false},
+		{TLSVerifyInsecure, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			v, err := newVerifier(tt.mode, "", nil, logr.Discard())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.verifyConnection("ingress", cs); (err != nil) != tt.wantErr {
+				t.Errorf("verifyConnection = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFirstWarningIsBounded(t *testing.T) {
+	v, err := newVerifier(TLSVerifyCA, "", nil, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !v.firstWarning("a") || v.firstWarning("a") {
+		t.Fatal("a repeated failure should be logged only once")
+	}
+	for i := 0; i < 4*maxWarned; i++ {
+		v.firstWarning(fmt.Sprint(i))
+	}
+	if len(v.warned) > maxWarned {
+		t.Errorf("remembered %d failures, want at most %d", len(v.warned), maxWarned)
+	}
+}
@@ -0,0 +1,136 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// CheckFunc reports whether a check passes, with a short explanation
+type CheckFunc func() (ok bool, message string)
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// CheckReport is the body of /health and /ready
+type CheckReport struct {
+	Status string        `json:"status"` // "ok" or "failing"
+	Checks []CheckResult `json:"checks"`
+}
+
+// OK reports whether every check passed
+func (r CheckReport) OK() bool {
+	return r.Status == "ok"
+}
+
+type namedCheck struct {
+	name string
+	fn   CheckFunc
+}
+
+// AddReadinessCheck adds a check that must pass for /ready to succeed
+func (s *Server) AddReadinessCheck(name string, fn CheckFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readiness = append(s.readiness, namedCheck{name, fn})
+}
+
+// AddLivenessCheck adds a check that must pass for /health to succeed
+func (s *Server) AddLivenessCheck(name string, fn CheckFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.liveness = append(s.liveness, namedCheck{name, fn})
+}
+
+// Heartbeat returns a heartbeat for a background loop, checked for liveness
+// under name. Calling it again with the same name returns the same heartbeat.
+func (s *Server) Heartbeat(name string) *Heartbeat {
+	s.mu.Lock()
+	if hb, exists := s.heartbeats[name]; exists {
+		s.mu.Unlock()
+		return hb
+	}
+	hb := &Heartbeat{}
+	s.heartbeats[name] = hb
+	s.mu.Unlock()
+
+	s.AddLivenessCheck(name, hb.check)
+	return hb
+}
+
+// Readiness runs the readiness checks
+func (s *Server) Readiness() CheckReport {
+	s.mu.RLock()
+	checks := append([]namedCheck(nil), s.readiness...)
+	s.mu.RUnlock()
+	return runChecks(checks)
+}
+
+// Liveness runs the liveness checks
+func (s *Server) Liveness() CheckReport {
+	s.mu.RLock()
+	checks := append([]namedCheck(nil), s.liveness...)
+	s.mu.RUnlock()
+	return runChecks(checks)
+}
+
+// runChecks runs checks in order without holding the server lock, since
+// they call back into the daemon
+func runChecks(checks []namedCheck) CheckReport {
+	report := CheckReport{Status: "ok", Checks: make([]CheckResult, 0, len(checks))}
+	for _, c := range checks {
+		ok, message := c.fn()
+		if !ok {
+			report.Status = "failing"
+		}
+		report.Checks = append(report.Checks, CheckResult{Name: c.name, OK: ok, Message: message})
+	}
+	return report
+}
+
+func writeReport(w http.ResponseWriter, report CheckReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if !report.OK() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Heartbeat lets a background loop prove it is still making progress
+type Heartbeat struct {
+	// deadline is the unix time in nanoseconds the next beat is due by
+	deadline atomic.Int64
+	last     atomic.Int64
+}
+
+// Beat records that the loop ran and expects the next beat within d
+func (h *Heartbeat) Beat(d time.Duration) {
+	now := time.Now()
+	h.last.Store(now.UnixNano())
+	h.deadline.Store(now.Add(d).UnixNano())
+}
+
+// Stop marks the loop as finished, so it no longer fails liveness
+func (h *Heartbeat) Stop() {
+	h.deadline.Store(0)
+}
+
+func (h *Heartbeat) check() (bool, string) {
+	deadline := h.deadline.Load()
+	if deadline == 0 {
+		return true, "not running"
+	}
+
+	last := time.Unix(0, h.last.Load())
+	if overdue := time.Since(time.Unix(0, deadline)); overdue > 0 {
+		return false, fmt.Sprintf("stalled: last beat %s ago, overdue by %s",
+			time.Since(last).Round(time.Second), overdue.Round(time.Second))
+	}
+	return true, fmt.Sprintf("last beat %s ago", time.Since(last).Round(time.Second))
+}
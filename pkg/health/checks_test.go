@@ -0,0 +1,162 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func newTestServer() *Server {
+	return NewServer(Config{Logger: logr.Discard()})
+}
+
+func passing(message string) CheckFunc {
+	return func() (bool, string) { return true, message }
+}
+
+func failing(message string) CheckFunc {
+	return func() (bool, string) { return false, message }
+}
+
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     map[string]CheckFunc
+		order      []string
+		wantStatus string
+		wantCode   int
+	}{
+		{
+			name:       "no checks",
+			wantStatus: "ok",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "all passing",
+			checks:     map[string]CheckFunc{"registered": passing("yes"), "polled": passing("")},
+			order:      []string{"registered", "polled"},
+			wantStatus: "ok",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "one failing",
+			checks:     map[string]CheckFunc{"registered": passing("yes"), "ingress": failing("unreachable"), "listeners": passing("")},
+			order:      []string{"registered", "ingress", "listeners"},
+			wantStatus: "failing",
+			wantCode:   http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			for _, name := range tt.order {
+				s.AddReadinessCheck(name, tt.checks[name])
+			}
+
+			report := s.Readiness()
+			if report.Status != tt.wantStatus || report.OK() != (tt.wantStatus == "ok") {
+				t.Errorf("status = %q, OK() = %v, want %q", report.Status, report.OK(), tt.wantStatus)
+			}
+
+			// Every check is reported, in the order it was added
+			if len(report.Checks) != len(tt.order) {
+				t.Fatalf("got %d checks, want %d", len(report.Checks), len(tt.order))
+			}
+			for i, result := range report.Checks {
+				ok, message := tt.checks[tt.order[i]]()
+				if result.Name != tt.order[i] || result.OK != ok || result.Message != message {
+					t.Errorf("check %d = %+v, want %s ok=%v message=%q", i, result, tt.order[i], ok, message)
+				}
+			}
+
+			// Readiness checks don't affect liveness
+			if !s.Liveness().OK() {
+				t.Error("liveness failing with only readiness checks")
+			}
+
+			rec := httptest.NewRecorder()
+			s.handleReady(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("/ready code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			var body CheckReport
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Status != tt.wantStatus || len(body.Checks) != len(tt.order) {
+				t.Errorf("/ready body = %+v", body)
+			}
+		})
+	}
+}
+
+func TestLivenessHeartbeats(t *testing.T) {
+	s := newTestServer()
+
+	poll := s.Heartbeat("poll_loop")
+	if s.Heartbeat("poll_loop") != poll {
+		t.Error("Heartbeat() returned a new heartbeat for a known name")
+	}
+	accept := s.Heartbeat("accept_loop")
+
+	// Loops that haven't started don't fail liveness
+	report := s.Liveness()
+	if !report.OK() || len(report.Checks) != 2 {
+		t.Fatalf("before any beat: %+v", report)
+	}
+	if report.Checks[0].Message != "not running" {
+		t.Errorf("message = %q, want not running", report.Checks[0].Message)
+	}
+
+	poll.Beat(time.Minute)
+	accept.Beat(time.Minute)
+	if report := s.Liveness(); !report.OK() {
+		t.Errorf("with fresh beats: %+v", report)
+	}
+
+	// A loop past its deadline is stalled
+	accept.Beat(-time.Second)
+	report = s.Liveness()
+	if report.OK() {
+		t.Fatalf("with an overdue beat: %+v", report)
+	}
+	if !report.Checks[0].OK || report.Checks[1].OK || !strings.HasPrefix(report.Checks[1].Message, "stalled") {
+		t.Errorf("checks = %+v, want only accept_loop stalled", report.Checks)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/health code = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// A stopped loop no longer fails liveness
+	accept.Stop()
+	if report := s.Liveness(); !report.OK() {
+		t.Errorf("after Stop: %+v", report)
+	}
+}
+
+func TestHeartbeatExpires(t *testing.T) {
+	var hb Heartbeat
+	hb.Beat(50 * time.Millisecond)
+	if ok, message := hb.check(); !ok {
+		t.Fatalf("right after Beat: %s", message)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if ok, _ := hb.check(); ok {
+		t.Error("check passed after the deadline")
+	}
+
+	hb.Beat(time.Minute)
+	if ok, message := hb.check(); !ok {
+		t.Errorf("after a new Beat: %s", message)
+	}
+}
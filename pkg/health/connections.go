@@ -0,0 +1,98 @@
+package health
+
+import (
+	"sort"
+	"time"
+)
+
+// recentConnections is how many finished connections are kept
+const recentConnections = 256
+
+// ConnectionRecord describes a finished forwarded connection
+type ConnectionRecord struct {
+	Endpoint    string        `json:"endpoint"`
+	TargetURI   string        `json:"target_uri"`
+	ClientAddr  string        `json:"client_addr"`
+	Start       time.Time     `json:"start"`
+	Duration    time.Duration `json:"duration"`
+	BytesIn     int64         `json:"bytes_in"`
+	BytesOut    int64         `json:"bytes_out"`
+	CloseReason string        `json:"close_reason"`
+}
+
+// connectionRing holds the most recent connection records, overwriting
+// the oldest once full
+type connectionRing struct {
+	records []ConnectionRecord
+	next    int
+}
+
+func newConnectionRing(size int) *connectionRing {
+	return &connectionRing{records: make([]ConnectionRecord, 0, size)}
+}
+
+func (r *connectionRing) add(record ConnectionRecord) {
+	if len(r.records) < cap(r.records) {
+		r.records = append(r.records, record)
+		return
+	}
+	r.records[r.next] = record
+	r.next = (r.next + 1) % len(r.records)
+}
+
+// list returns the records, newest first
+func (r *connectionRing) list() []ConnectionRecord {
+	result := make([]ConnectionRecord, 0, len(r.records))
+	for i := len(r.records) - 1; i >= 0; i-- {
+		result = append(result, r.records[(r.next+i)%len(r.records)])
+	}
+	return result
+}
+
+// RecordTraffic records a finished connection: its traffic and duration
+// are added to the endpoint's totals and it joins the recent connections
+func (s *Server) RecordTraffic(name, clientAddr string, start time.Time, duration time.Duration, bytesIn, bytesOut int64, closeReason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ep, exists := s.endpoints[name]
+	if !exists {
+		return
+	}
+
+	ep.BytesIn += bytesIn
+	ep.BytesOut += bytesOut
+	ep.ConnectionSeconds += duration.Seconds()
+
+	s.recent.add(ConnectionRecord{
+		Endpoint:    name,
+		TargetURI:   ep.TargetURI,
+		ClientAddr:  clientAddr,
+		Start:       start,
+		Duration:    duration,
+		BytesIn:     bytesIn,
+		BytesOut:    bytesOut,
+		CloseReason: closeReason,
+	})
+}
+
+// RecentConnections returns the most recently finished connections,
+// newest first
+func (s *Server) RecentConnections() []ConnectionRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.recent.list()
+}
+
+// Endpoints returns the status of every endpoint, sorted by name
+func (s *Server) Endpoints() []EndpointStatus {
+	s.mu.RLock()
+	endpoints := make([]EndpointStatus, 0, len(s.endpoints))
+	for _, ep := range s.endpoints {
+		endpoints = append(endpoints, *ep)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Name < endpoints[j].Name })
+	return endpoints
+}
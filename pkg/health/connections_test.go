@@ -0,0 +1,74 @@
+package health
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestConnectionRing(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		added int
+		want  []string // ClientAddr of each record, newest first
+	}{
+		{"empty", 3, 0, []string{}},
+		{"partly full", 3, 2, []string{"c1", "c0"}},
+		{"exactly full", 3, 3, []string{"c2", "c1", "c0"}},
+		{"wrapped once", 3, 4, []string{"c3", "c2", "c1"}},
+		{"wrapped to start", 3, 6, []string{"c5", "c4", "c3"}},
+		{"wrapped many times", 3, 11, []string{"c10", "c9", "c8"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newConnectionRing(tt.size)
+			for i := 0; i < tt.added; i++ {
+				r.add(ConnectionRecord{ClientAddr: fmt.Sprintf("c%d", i)})
+			}
+
+			list := r.list()
+			got := make([]string, len(list))
+			for i, record := range list {
+				got[i] = record.ClientAddr
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("list() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordTraffic(t *testing.T) {
+	s := newTestServer()
+	s.RegisterEndpoint("ep", "10.107.0.1:443", "https://a.ngrok.app")
+
+	start := time.Now()
+	for i := 0; i < recentConnections+5; i++ {
+		s.RecordTraffic("ep", fmt.Sprintf("c%d", i), start, time.Second, 10, 100, "client_closed")
+	}
+	// Unknown endpoints are neither counted nor listed
+	s.RecordTraffic("gone", "x", start, time.Second, 1, 1, "")
+
+	ep, ok := s.Endpoint("ep")
+	if !ok {
+		t.Fatal("endpoint not tracked")
+	}
+	n := int64(recentConnections + 5)
+	if ep.BytesIn != 10*n || ep.BytesOut != 100*n || ep.ConnectionSeconds != float64(n) {
+		t.Errorf("totals = %d in, %d out, %vs; want %d, %d, %ds", ep.BytesIn, ep.BytesOut, ep.ConnectionSeconds, 10*n, 100*n, n)
+	}
+
+	recent := s.RecentConnections()
+	if len(recent) != recentConnections {
+		t.Fatalf("%d recent connections, want %d", len(recent), recentConnections)
+	}
+	newest, oldest := recent[0], recent[len(recent)-1]
+	if newest.ClientAddr != fmt.Sprintf("c%d", n-1) || oldest.ClientAddr != "c5" {
+		t.Errorf("recent runs %s to %s, want c%d to c5", newest.ClientAddr, oldest.ClientAddr, n-1)
+	}
+	if newest.Endpoint != "ep" || newest.TargetURI != "https://a.ngrok.app" || newest.CloseReason != "client_closed" {
+		t.Errorf("newest record = %+v", newest)
+	}
+}
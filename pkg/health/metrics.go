@@ -0,0 +1,112 @@
+package health
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/forwarder"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/metrics"
+)
+
+// handleMetrics handles /metrics requests in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	mw := metrics.NewWriter(&buf)
+
+	endpoints := s.Endpoints()
+
+	s.mu.RLock()
+	extra := s.metrics
+	s.mu.RUnlock()
+
+	mw.Family("ngrokd_start_time_seconds", "gauge", "Unix time the daemon started.")
+	mw.Sample("ngrokd_start_time_seconds", float64(s.startTime.Unix()))
+
+	writeEndpointMetrics(mw, endpoints)
+
+	if extra != nil {
+		extra(mw)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// writeEndpointMetrics writes the per-endpoint families, labeled by
+// endpoint ID and URL
+func writeEndpointMetrics(mw *metrics.Writer, endpoints []EndpointStatus) {
+	labels := func(ep EndpointStatus) []string {
+		return []string{"endpoint", ep.Name, "url", ep.TargetURI}
+	}
+
+	mw.Family("ngrokd_endpoint_connections_active", "gauge", "Connections currently being forwarded.")
+	for _, ep := range endpoints {
+		mw.Sample("ngrokd_endpoint_connections_active", float64(ep.Connections), labels(ep)...)
+	}
+
+	mw.Family("ngrokd_endpoint_connections_total", "counter", "Connections accepted.")
+	for _, ep := range endpoints {
+		mw.Sample("ngrokd_endpoint_connections_total", float64(ep.TotalConnections), labels(ep)...)
+	}
+
+	mw.Family("ngrokd_endpoint_bytes_in_total", "counter", "Bytes received from local clients, counted when connections close.")
+	for _, ep := range endpoints {
+		mw.Sample("ngrokd_endpoint_bytes_in_total", float64(ep.BytesIn), labels(ep)...)
+	}
+
+	mw.Family("ngrokd_endpoint_bytes_out_total", "counter", "Bytes sent to local clients, counted when connections close.")
+	for _, ep := range endpoints {
+		mw.Sample("ngrokd_endpoint_bytes_out_total", float64(ep.BytesOut), labels(ep)...)
+	}
+
+	mw.Family("ngrokd_endpoint_connection_seconds_total", "counter", "Summed duration of finished connections.")
+	for _, ep := range endpoints {
+		mw.Sample("ngrokd_endpoint_connection_seconds_total", ep.ConnectionSeconds, labels(ep)...)
+	}
+
+	mw.Family("ngrokd_endpoint_errors_total", "counter", "Forwarding errors by where the connection failed.")
+	for _, ep := range endpoints {
+		for _, class := range []struct {
+			name  string
+			count int64
+		}{
+			{forwarder.FailureUpgrade, ep.Failures.Upgrade},
+			{forwarder.FailureTLS, ep.Failures.TLS},
+			{forwarder.FailureDialTimeout, ep.Failures.DialTimeout},
+			{forwarder.FailureDial, ep.Failures.Dial},
+			{forwarder.FailureSetup, ep.Failures.Setup},
+			{forwarder.FailureReset, ep.Failures.Reset},
+			{forwarder.FailureOther, ep.Failures.Other},
+		} {
+			mw.Sample("ngrokd_endpoint_errors_total", float64(class.count), append(labels(ep), "class", class.name)...)
+		}
+	}
+
+	mw.Family("ngrokd_endpoint_degraded", "gauge", "1 if recent connections to the endpoint fail before being upgraded.")
+	for _, ep := range endpoints {
+		degraded := 0.0
+		if ep.Degraded {
+			degraded = 1
+		}
+		mw.Sample("ngrokd_endpoint_degraded", degraded, labels(ep)...)
+	}
+
+	mw.Family("ngrokd_endpoint_probe_success", "gauge", "1 if the latest synthetic probe of the endpoint passed.")
+	for _, ep := range endpoints {
+		if ep.Probe == nil {
+			continue
+		}
+		success := 0.0
+		if ep.Probe.OK {
+			success = 1
+		}
+		mw.Sample("ngrokd_endpoint_probe_success", success, labels(ep)...)
+	}
+
+	mw.Family("ngrokd_endpoint_probe_duration_seconds", "gauge", "Duration of the latest synthetic probe of the endpoint.")
+	for _, ep := range endpoints {
+		if ep.Probe != nil {
+			mw.Sample("ngrokd_endpoint_probe_duration_seconds", ep.Probe.Latency.Seconds(), labels(ep)...)
+		}
+	}
+}
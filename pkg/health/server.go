@@ -2,13 +2,19 @@ package health
 
 import (
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/forwarder"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/metrics"
 )
 
 // Status represents the agent's operational status
@@ -18,6 +24,19 @@ type Status struct {
 	Uptime    string                   `json:"uptime"`
 	Endpoints map[string]EndpointStatus `json:"endpoints"`
 	StartTime time.Time                `json:"start_time"`
+	IngressPool PoolStats              `json:"ingress_pool"`
+
+	// RecentConnections are the last finished connections, newest first
+	RecentConnections []ConnectionRecord `json:"recent_connections"`
+}
+
+// PoolStats reports usage of the pre-warmed ingress connection pool
+type PoolStats struct {
+	Enabled bool  `json:"enabled"`
+	Size    int   `json:"size"`
+	Idle    int   `json:"idle"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
 }
 
 // EndpointStatus represents the status of a single endpoint
@@ -30,25 +49,97 @@ type EndpointStatus struct {
 	TotalConnections int64    `json:"total_connections"`
 	LastActivity    time.Time `json:"last_activity,omitempty"`
 	Errors          int64     `json:"errors"`
+	BytesIn         int64     `json:"bytes_in"`
+	BytesOut        int64     `json:"bytes_out"`
+
+	// ConnectionSeconds is the summed duration of finished connections
+	ConnectionSeconds float64 `json:"connection_seconds"`
+
+	// Failures counts errors by where forwarding failed
+	Failures FailureCounts `json:"failures"`
+
+	// ConsecutiveFailures counts connections in a row that failed before
+	// they were upgraded; Degraded is set once it reaches degradedAfter
+	ConsecutiveFailures int  `json:"consecutive_failures"`
+	Degraded            bool `json:"degraded"`
+
+	LastErrorClass string    `json:"last_error_class,omitempty"`
+	LastErrorCode  string    `json:"last_error_code,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	LastErrorTime  time.Time `json:"last_error_time,omitempty"`
+
+	// Probe is the latest synthetic probe, if the prober is enabled
+	Probe *ProbeStatus `json:"probe,omitempty"`
+}
+
+// ProbeStatus is the outcome of a synthetic probe of an endpoint
+type ProbeStatus struct {
+	OK         bool          `json:"ok"`
+	Time       time.Time     `json:"time"`
+	Latency    time.Duration `json:"latency"`
+	StatusCode int           `json:"status_code,omitempty"`
+
+	ErrorClass string `json:"error_class,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	// ConsecutiveFailures counts failed probes in a row
+	ConsecutiveFailures int `json:"consecutive_failures"`
+}
+
+// FailureCounts counts forwarding errors per failure class
+type FailureCounts struct {
+	Upgrade     int64 `json:"upgrade"`
+	TLS         int64 `json:"tls"`
+	DialTimeout int64 `json:"dial_timeout"`
+	Dial        int64 `json:"dial"`
+	Setup       int64 `json:"setup"`
+	Reset       int64 `json:"reset"`
+	Other       int64 `json:"other"`
 }
 
+// degradedAfter is how many connections in a row must fail to be upgraded
+// before an endpoint is reported as degraded
+const degradedAfter = 3
+
 // Server provides health check and status endpoints
 type Server struct {
 	addr      string
 	server    *http.Server
 	logger    logr.Logger
 	startTime time.Time
-
-	mu        sync.RWMutex
-	endpoints map[string]*EndpointStatus
-	ready     bool
+	config    Config
+
+	// listener is set once Start has bound the address
+	listener net.Listener
+
+	// cert is the TLS server certificate, if TLS is enabled
+	cert *tls.Certificate
+
+	mu         sync.RWMutex
+	endpoints  map[string]*EndpointStatus
+	readiness  []namedCheck
+	liveness   []namedCheck
+	heartbeats map[string]*Heartbeat
+	recent     *connectionRing
+	poolStats  func() PoolStats
+	metrics   func(*metrics.Writer)
 }
 
 // Config holds the health server configuration
 type Config struct {
 	Address string
 	Port    int
-	Logger  logr.Logger
+
+	// TLSCert and TLSKey are PEM files; when set the server speaks HTTPS
+	TLSCert string
+	TLSKey  string
+
+	// BearerToken, if set, is required on /status and /metrics. Probe
+	// endpoints stay open so orchestrators can reach them.
+	BearerToken string
+
+	Logger logr.Logger
 }
 
 // NewServer creates a new health check server
@@ -64,10 +155,12 @@ func NewServer(config Config) *Server {
 
 	s := &Server{
 		addr:      addr,
+		config:    config,
 		logger:    config.Logger,
 		startTime: time.Now(),
-		endpoints: make(map[string]*EndpointStatus),
-		ready:     false,
+		endpoints:  make(map[string]*EndpointStatus),
+		heartbeats: make(map[string]*Heartbeat),
+		recent:     newConnectionRing(recentConnections),
 	}
 
 	mux := http.NewServeMux()
@@ -75,7 +168,8 @@ func NewServer(config Config) *Server {
 	mux.HandleFunc("/healthz", s.handleHealth)
 	mux.HandleFunc("/ready", s.handleReady)
 	mux.HandleFunc("/readyz", s.handleReady)
-	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/status", s.authorized(s.handleStatus))
+	mux.HandleFunc("/metrics", s.authorized(s.handleMetrics))
 
 	s.server = &http.Server{
 		Addr:    addr,
@@ -85,12 +179,40 @@ func NewServer(config Config) *Server {
 	return s
 }
 
-// Start starts the health check server
+// Start binds the health server's address and starts serving. It fails
+// if the address is in use or the TLS certificate can't be loaded.
 func (s *Server) Start() error {
-	s.logger.Info("Starting health check server", "address", s.addr)
+	if s.config.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(s.config.TLSCert, s.config.TLSKey)
+		if err != nil {
+			return fmt.Errorf("failed to load health server certificate: %w", err)
+		}
+		s.cert = &cert
+		s.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+
+	s.logger.Info("Starting health check server",
+		"address", ln.Addr().String(),
+		"tls", s.cert != nil,
+		"auth", s.config.BearerToken != "")
 
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if s.cert != nil {
+			err = s.server.ServeTLS(ln, "", "")
+		} else {
+			err = s.server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.logger.Error(err, "Health server error")
 		}
 	}()
@@ -98,17 +220,77 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// URL returns the base URL local clients reach the server on, or "" if
+// it isn't running. Wildcard addresses are replaced with loopback.
+func (s *Server) URL() string {
+	s.mu.RLock()
+	ln := s.listener
+	s.mu.RUnlock()
+
+	if ln == nil {
+		return ""
+	}
+
+	addr := ln.Addr().(*net.TCPAddr)
+	ip := addr.IP
+	if ip.IsUnspecified() {
+		// A wildcard listener reports "::" even when 0.0.0.0 was configured
+		ip = net.IPv4(127, 0, 0, 1)
+		if configured := net.ParseIP(s.config.Address); configured != nil && configured.To4() == nil {
+			ip = net.IPv6loopback
+		}
+	}
+
+	scheme := "http"
+	if s.cert != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(ip.String(), fmt.Sprint(addr.Port)))
+}
+
+// CertificatePEM returns the TLS server certificate, or "" without TLS
+func (s *Server) CertificatePEM() string {
+	if s.cert == nil || len(s.cert.Certificate) == 0 {
+		return ""
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.cert.Certificate[0]}))
+}
+
+// authorized requires the configured bearer token, if any, on next
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	if s.config.BearerToken == "" {
+		return next
+	}
+
+	want := []byte("Bearer " + s.config.BearerToken)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ngrokd"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
 // Stop stops the health check server
 func (s *Server) Stop(ctx context.Context) error {
 	s.logger.Info("Stopping health check server")
 	return s.server.Shutdown(ctx)
 }
 
-// SetReady marks the agent as ready
-func (s *Server) SetReady(ready bool) {
+// SetPoolStatsFunc sets the source of ingress pool counters for /status
+func (s *Server) SetPoolStatsFunc(fn func() PoolStats) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.ready = ready
+	s.poolStats = fn
+}
+
+// SetMetricsFunc sets a source of additional metrics for /metrics
+func (s *Server) SetMetricsFunc(fn func(*metrics.Writer)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = fn
 }
 
 // RegisterEndpoint registers an endpoint for status tracking
@@ -154,62 +336,137 @@ func (s *Server) RecordConnectionClose(name string) {
 	}
 }
 
-// RecordError records an error for an endpoint
-func (s *Server) RecordError(name string) {
+// RecordUpgrade records a connection that was upgraded and forwarded,
+// clearing the endpoint's run of failures
+func (s *Server) RecordUpgrade(name string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if ep, exists := s.endpoints[name]; exists {
-		ep.Errors++
+		ep.ConsecutiveFailures = 0
+		ep.Degraded = false
 	}
 }
 
-// handleHealth handles /health and /healthz requests
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// RecordError records an error for an endpoint. class is the forwarder
+// failure class; code and message describe the error, with ngrok's error
+// code for refused upgrades. setup marks failures before the upgrade.
+func (s *Server) RecordError(name, class, code, message string, setup bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ep, exists := s.endpoints[name]
+	if !exists {
+		return
+	}
+
+	ep.Errors++
+	switch class {
+	case forwarder.FailureUpgrade:
+		ep.Failures.Upgrade++
+	case forwarder.FailureTLS:
+		ep.Failures.TLS++
+	case forwarder.FailureDialTimeout:
+		ep.Failures.DialTimeout++
+	case forwarder.FailureDial:
+		ep.Failures.Dial++
+	case forwarder.FailureSetup:
+		ep.Failures.Setup++
+	case forwarder.FailureReset:
+		ep.Failures.Reset++
+	default:
+		ep.Failures.Other++
+	}
 
-	// Agent is healthy if at least one active endpoint exists
-	healthy := false
-	for _, ep := range s.endpoints {
-		if ep.Active {
-			healthy = true
-			break
+	if setup {
+		ep.ConsecutiveFailures++
+		if !ep.Degraded && ep.ConsecutiveFailures >= degradedAfter {
+			ep.Degraded = true
+			s.logger.Info("⚠️  Endpoint degraded, connections are failing",
+				"endpoint", name,
+				"failures", ep.ConsecutiveFailures,
+				"class", class,
+				"code", code,
+				"error", message)
 		}
 	}
 
-	if healthy {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "healthy\n")
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		fmt.Fprintf(w, "unhealthy\n")
+	ep.LastErrorClass = class
+	ep.LastErrorCode = code
+	ep.LastError = message
+	ep.LastErrorTime = time.Now()
+}
+
+// RecordProbe records a synthetic probe of an endpoint. Time and
+// ConsecutiveFailures are filled in.
+func (s *Server) RecordProbe(name string, probe ProbeStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ep, exists := s.endpoints[name]
+	if !exists {
+		return
 	}
+
+	probe.Time = time.Now()
+	previous := ep.Probe
+	if !probe.OK {
+		probe.ConsecutiveFailures = 1
+		if previous != nil {
+			probe.ConsecutiveFailures = previous.ConsecutiveFailures + 1
+		}
+	}
+
+	switch {
+	case !probe.OK && (previous == nil || previous.OK):
+		s.logger.Info("❌ Endpoint probe failed",
+			"endpoint", name,
+			"class", probe.ErrorClass,
+			"code", probe.ErrorCode,
+			"error", probe.Error)
+	case probe.OK && previous != nil && !previous.OK:
+		s.logger.Info("✅ Endpoint probe recovered",
+			"endpoint", name,
+			"failures", previous.ConsecutiveFailures)
+	}
+
+	ep.Probe = &probe
 }
 
-// handleReady handles /ready and /readyz requests
-func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+// Endpoint returns the status of one endpoint
+func (s *Server) Endpoint(name string) (EndpointStatus, bool) {
 	s.mu.RLock()
-	ready := s.ready
-	s.mu.RUnlock()
+	defer s.mu.RUnlock()
 
-	if ready {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "ready\n")
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		fmt.Fprintf(w, "not ready\n")
+	ep, exists := s.endpoints[name]
+	if !exists {
+		return EndpointStatus{}, false
 	}
+	return *ep, true
+}
+
+// handleHealth handles /health and /healthz requests. The daemon is live
+// while none of its background loops has stalled.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, s.Liveness())
+}
+
+// handleReady handles /ready and /readyz requests
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, s.Readiness())
 }
 
 // handleStatus handles /status requests
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	healthy := s.Liveness().OK()
+	ready := s.Readiness().OK()
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	status := Status{
-		Healthy:   len(s.endpoints) > 0,
-		Ready:     s.ready,
+		Healthy:   healthy,
+		Ready:     ready,
 		Uptime:    time.Since(s.startTime).String(),
 		StartTime: s.startTime,
 		Endpoints: make(map[string]EndpointStatus),
@@ -219,6 +476,12 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		status.Endpoints[name] = *ep
 	}
 
+	if s.poolStats != nil {
+		status.IngressPool = s.poolStats()
+	}
+
+	status.RecentConnections = s.recent.list()
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
 }
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"testing"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/forwarder"
+)
+
+func TestRecordErrorCountsByClass(t *testing.T) {
+	s := newTestServer()
+	s.RegisterEndpoint("ep", "10.107.0.1:443", "https://a.ngrok.app")
+
+	for _, class := range []string{
+		forwarder.FailureUpgrade, forwarder.FailureTLS, forwarder.FailureDialTimeout,
+		forwarder.FailureDial, forwarder.FailureSetup, forwarder.FailureReset,
+		forwarder.FailureOther, "unknown",
+	} {
+		s.RecordError("ep", class, "", class+" failed", false)
+	}
+
+	ep, _ := s.Endpoint("ep")
+	want := FailureCounts{Upgrade: 1, TLS: 1, DialTimeout: 1, Dial: 1, Setup: 1, Reset: 1, Other: 2}
+	if ep.Failures != want {
+		t.Errorf("failures = %+v, want %+v", ep.Failures, want)
+	}
+	if ep.Errors != 8 || ep.LastErrorClass != "unknown" || ep.LastError != "unknown failed" {
+		t.Errorf("errors = %d, last = %s %q", ep.Errors, ep.LastErrorClass, ep.LastError)
+	}
+}
+
+func TestDegraded(t *testing.T) {
+	// result is how one connection ended: an upgrade, or an error
+	type result struct {
+		class string // "" for an upgraded connection
+		setup bool
+	}
+	upgraded := result{}
+	refused := result{forwarder.FailureUpgrade, true}
+	setup := result{forwarder.FailureSetup, true}
+	reset := result{forwarder.FailureReset, false}
+
+	tests := []struct {
+		name         string
+		results      []result
+		wantFailures int
+		wantDegraded bool
+	}{
+		{"below threshold", []result{refused, refused}, 2, false},
+		{"at threshold", []result{refused, refused, refused}, 3, true},
+		{"unwrapped setup errors count", []result{setup, setup, setup}, 3, true},
+		{"stream errors don't count", []result{reset, reset, reset}, 0, false},
+		{"upgrade clears", []result{refused, refused, refused, upgraded}, 0, false},
+		{"run restarts after an upgrade", []result{refused, refused, upgraded, refused, refused}, 2, false},
+		{"stays degraded", []result{refused, refused, refused, refused}, 4, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.RegisterEndpoint("ep", "10.107.0.1:443", "https://a.ngrok.app")
+
+			for _, r := range tt.results {
+				if r.class == "" {
+					s.RecordUpgrade("ep")
+					continue
+				}
+				if !r.setup {
+					// Upgraded, then failed mid-stream
+					s.RecordUpgrade("ep")
+				}
+				s.RecordError("ep", r.class, "ERR_NGROK_3004", "failed", r.setup)
+			}
+
+			ep, _ := s.Endpoint("ep")
+			if ep.ConsecutiveFailures != tt.wantFailures || ep.Degraded != tt.wantDegraded {
+				t.Errorf("consecutive failures %d, degraded %v; want %d, %v",
+					ep.ConsecutiveFailures, ep.Degraded, tt.wantFailures, tt.wantDegraded)
+			}
+		})
+	}
+}
@@ -128,6 +128,48 @@ func (a *Allocator) AllocateIPForPort(hostname string, port int) (string, error)
 	return "", fmt.Errorf("no available IPs in subnet")
 }
 
+// PreviewIPForPort returns the IP AllocateIPForPort would assign without
+// reserving it. A new IP may differ from the one eventually allocated if
+// other hostnames are allocated first.
+func (a *Allocator) PreviewIPForPort(hostname string, port int) (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
+	if ip, exists := a.allocated[hostname]; exists {
+		return ip, nil
+	}
+	
+	// Lowest IP with the port free, so previews are stable across calls
+	var shared net.IP
+	for ipStr, ports := range a.portsByIP {
+		if ports[port] {
+			continue
+		}
+		if ip := net.ParseIP(ipStr); ip != nil && (shared == nil || compareIP(ip, shared) < 0) {
+			shared = ip
+		}
+	}
+	if shared != nil {
+		return shared.String(), nil
+	}
+	
+	ip := make(net.IP, len(a.nextIP))
+	copy(ip, a.nextIP)
+	for {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			ip4 = ip
+		}
+		if !a.subnet.Contains(ip4) {
+			return "", fmt.Errorf("exhausted IP range in subnet %s", a.subnet.String())
+		}
+		if !a.isIPAllocated(ip.String()) {
+			return ip.String(), nil
+		}
+		incrementIP(ip)
+	}
+}
+
 // incrementIP increments an IP address by 1
 func incrementIP(ip net.IP) {
 	for i := len(ip) - 1; i >= 0; i-- {
@@ -192,6 +234,22 @@ func (a *Allocator) ReleaseIP(hostname string) {
 	a.logger.Info("Released hostname from IP", "hostname", hostname, "ip", ip)
 }
 
+// ReleasePort frees a port on the hostname's IP while keeping the
+// hostname -> IP allocation
+func (a *Allocator) ReleasePort(hostname string, port int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	
+	ip, exists := a.allocated[hostname]
+	if !exists {
+		return
+	}
+	
+	if ports, ok := a.portsByIP[ip]; ok {
+		delete(ports, port)
+	}
+}
+
 // LoadPersistentMappings loads hostname->IP mappings from disk
 func (a *Allocator) LoadPersistentMappings(path string) error {
 	data, err := os.ReadFile(path)
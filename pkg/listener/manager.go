@@ -5,16 +5,21 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/ishanjain/ngrok-forward-proxy/pkg/forwarder"
 )
 
-// StatusCallback is called when connection events occur
+// StatusCallback is called when connection events occur. RecordTraffic
+// reports each forwarded connection once it has ended.
 type StatusCallback interface {
 	RecordConnection(endpointName string)
 	RecordConnectionClose(endpointName string)
-	RecordError(endpointName string)
+	RecordUpgrade(endpointName string)
+	RecordTraffic(endpointName, clientAddr string, start time.Time, duration time.Duration, bytesIn, bytesOut int64, closeReason string)
+	RecordError(endpointName, class, code, message string, setup bool)
 }
 
 // Manager manages local TCP listeners for bound endpoints
@@ -25,20 +30,44 @@ type Manager struct {
 
 	mu        sync.RWMutex
 	listeners map[string]*activeListener // key: endpoint name
+
+	// In-flight forwarded connections, tracked for draining on shutdown
+	connMu   sync.Mutex
+	conns    map[net.Conn]struct{}
+	inflight sync.WaitGroup
+	draining bool
 }
 
 type activeListener struct {
 	endpoint forwarder.BoundEndpoint
 	listener net.Listener
 	cancel   context.CancelFunc
+
+	// options are the forwarding settings for newly accepted connections;
+	// they override endpoint.Options so they can change in place
+	options atomic.Pointer[forwarder.EndpointOptions]
+
+	// failingSince is the unix time in nanoseconds Accept started failing
+	// without a success since, or 0
+	failingSince atomic.Int64
+
+	// done is closed when the accept loop returns
+	done chan struct{}
 }
 
+// Accept error backoff, as in net/http
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
 // New creates a new listener Manager
 func New(fwd *forwarder.Forwarder, logger logr.Logger) *Manager {
 	return &Manager{
 		forwarder:      fwd,
 		logger:         logger,
 		listeners:      make(map[string]*activeListener),
+		conns:          make(map[net.Conn]struct{}),
 		statusCallback: nil,
 	}
 }
@@ -83,7 +112,9 @@ func (m *Manager) StartListener(ctx context.Context, endpoint forwarder.BoundEnd
 		endpoint: endpoint,
 		listener: listener,
 		cancel:   cancel,
+		done:     make(chan struct{}),
 	}
+	active.options.Store(&endpoint.Options)
 
 	m.listeners[endpoint.Name] = active
 
@@ -114,10 +145,36 @@ func (m *Manager) StopListener(endpointName string) error {
 	return nil
 }
 
+// UpdateOptions changes the forwarding settings of a running listener.
+// Connections accepted from now on use them; open connections keep the
+// settings they were accepted with.
+func (m *Manager) UpdateOptions(endpointName string, options forwarder.EndpointOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	active, exists := m.listeners[endpointName]
+	if !exists {
+		return fmt.Errorf("no listener found for endpoint %s", endpointName)
+	}
+
+	active.options.Store(&options)
+	m.logger.Info("updated listener options", "endpoint", endpointName)
+	return nil
+}
+
+// current returns the endpoint with its latest forwarding settings
+func (a *activeListener) current() forwarder.BoundEndpoint {
+	endpoint := a.endpoint
+	endpoint.Options = *a.options.Load()
+	return endpoint
+}
+
 // acceptConnections accepts and forwards connections in a loop
 func (m *Manager) acceptConnections(ctx context.Context, active *activeListener) {
+	defer close(active.done)
 	m.logger.Info("accept loop started", "endpoint", active.endpoint.Name, "address", active.listener.Addr().String())
 	
+	var delay time.Duration
 	for {
 		// Check if context was cancelled before accepting
 		if ctx.Err() != nil {
@@ -137,21 +194,44 @@ func (m *Manager) acceptConnections(ctx context.Context, active *activeListener)
 
 			m.logger.Error(err, "failed to accept connection",
 				"endpoint", active.endpoint.Name)
+			
+			// Back off so persistent errors (e.g. out of file descriptors) don't spin
+			active.failingSince.CompareAndSwap(0, time.Now().UnixNano())
+			if delay == 0 {
+				delay = minAcceptDelay
+			} else if delay *= 2; delay > maxAcceptDelay {
+				delay = maxAcceptDelay
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
 			continue
 		}
+		active.failingSince.Store(0)
+		delay = 0
 
 		// Log HTTP requests nicely
 		m.logger.Info("→",
 			"from", conn.RemoteAddr().String(),
 			"to", active.endpoint.URI)
 
+		// Shutting down - refuse connections that raced the listener close
+		if !m.trackConn(conn) {
+			conn.Close()
+			return
+		}
+
 		// Record connection
 		if m.statusCallback != nil {
 			m.statusCallback.RecordConnection(active.endpoint.Name)
 		}
 
-		// Forward connection in background
+		// Forward connection in background with the settings in effect now
+		endpoint := active.current()
 		go func(c net.Conn) {
+			defer m.untrackConn(c)
 			defer c.Close()
 			defer func() {
 				if m.statusCallback != nil {
@@ -159,17 +239,90 @@ func (m *Manager) acceptConnections(ctx context.Context, active *activeListener)
 				}
 			}()
 
-			if err := m.forwarder.ForwardConnection(c, active.endpoint); err != nil {
+			stats, err := m.forwarder.ForwardConnection(c, endpoint)
+			if err != nil {
 				m.logger.Error(err, "failed to forward connection",
 					"endpoint", active.endpoint.Name)
-				if m.statusCallback != nil {
-					m.statusCallback.RecordError(active.endpoint.Name)
-				}
 			}
+			if m.statusCallback != nil {
+				m.statusCallback.RecordTraffic(active.endpoint.Name, c.RemoteAddr().String(),
+					stats.Start, stats.Duration, stats.BytesIn, stats.BytesOut, stats.CloseReason)
+			}
+			m.recordResult(active.endpoint.Name, err)
 		}(conn)
 	}
 }
 
+// recordResult reports how a forwarded connection ended to the status callback
+func (m *Manager) recordResult(name string, err error) {
+	if m.statusCallback == nil {
+		return
+	}
+	if err == nil {
+		m.statusCallback.RecordUpgrade(name)
+		return
+	}
+
+	failure := forwarder.Classify(err)
+	if !failure.Setup() {
+		// Upgraded fine, then failed mid-stream
+		m.statusCallback.RecordUpgrade(name)
+	}
+
+	message := failure.Message
+	if message == "" {
+		message = err.Error()
+	}
+	m.statusCallback.RecordError(name, failure.Class, failure.Code, message, failure.Setup())
+}
+
+// trackConn registers an in-flight connection so Shutdown can drain it.
+// Returns false if the manager is already shutting down.
+func (m *Manager) trackConn(c net.Conn) bool {
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+
+	if m.draining {
+		return false
+	}
+	m.inflight.Add(1)
+	m.conns[c] = struct{}{}
+	return true
+}
+
+// untrackConn marks an in-flight connection as finished
+func (m *Manager) untrackConn(c net.Conn) {
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+
+	delete(m.conns, c)
+	m.inflight.Done()
+}
+
+// StalledListeners returns the endpoints whose accept loop has exited or
+// has failed to accept for longer than after, with the reason
+func (m *Manager) StalledListeners(after time.Duration) map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stalled := make(map[string]string)
+	for name, active := range m.listeners {
+		select {
+		case <-active.done:
+			stalled[name] = "accept loop exited"
+			continue
+		default:
+		}
+
+		if since := active.failingSince.Load(); since != 0 {
+			if failing := time.Since(time.Unix(0, since)); failing > after {
+				stalled[name] = fmt.Sprintf("accept failing for %s", failing.Round(time.Second))
+			}
+		}
+	}
+	return stalled
+}
+
 // ListActiveEndpoints returns a list of all active endpoint names
 func (m *Manager) ListActiveEndpoints() []string {
 	m.mu.RLock()
@@ -183,6 +336,18 @@ func (m *Manager) ListActiveEndpoints() []string {
 	return endpoints
 }
 
+// ActiveEndpoints returns the endpoints that have a listener
+func (m *Manager) ActiveEndpoints() []forwarder.BoundEndpoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	endpoints := make([]forwarder.BoundEndpoint, 0, len(m.listeners))
+	for _, active := range m.listeners {
+		endpoints = append(endpoints, active.current())
+	}
+	return endpoints
+}
+
 // Close stops all listeners
 func (m *Manager) Close() error {
 	m.mu.Lock()
@@ -198,3 +363,40 @@ func (m *Manager) Close() error {
 
 	return nil
 }
+
+// Shutdown stops accepting on all listeners and waits for in-flight
+// connections to finish. Connections still open when ctx is done are
+// force-closed.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.Close()
+
+	m.connMu.Lock()
+	m.draining = true
+	remaining := len(m.conns)
+	m.connMu.Unlock()
+	if remaining > 0 {
+		m.logger.Info("draining connections", "count", remaining)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.connMu.Lock()
+	m.logger.Info("drain deadline reached, closing connections", "count", len(m.conns))
+	for c := range m.conns {
+		c.Close()
+	}
+	m.connMu.Unlock()
+
+	<-done
+	return ctx.Err()
+}
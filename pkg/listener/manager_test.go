@@ -0,0 +1,129 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/forwarder"
+)
+
+// handle tracks conn like the accept loop does and stands in for the
+// forwarder: it copies until the peer or Shutdown closes the connection.
+// The returned channel is closed once the connection is untracked.
+func handle(t *testing.T, m *Manager, conn net.Conn) <-chan struct{} {
+	t.Helper()
+
+	if !m.trackConn(conn) {
+		t.Fatal("trackConn() = false before Shutdown")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer m.untrackConn(conn)
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+	return done
+}
+
+func TestShutdownWaitsForInflight(t *testing.T) {
+	m := New(nil, logr.Discard())
+
+	local, peer := net.Pipe()
+	done := handle(t, m, local)
+
+	// The client finishes shortly after shutdown starts
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		peer.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = %v, want the connection drained", err)
+	}
+
+	select {
+	case <-done:
+	default:
+		t.Error("Shutdown returned before the connection finished")
+	}
+}
+
+func TestShutdownForceClosesAfterDeadline(t *testing.T) {
+	m := New(nil, logr.Discard())
+
+	local, peer := net.Pipe()
+	defer peer.Close()
+	done := handle(t, m, local)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-done:
+	default:
+		t.Fatal("Shutdown returned with the connection still tracked")
+	}
+	if _, err := peer.Write([]byte{0}); err == nil {
+		t.Error("connection still open after the drain deadline")
+	}
+}
+
+func TestShutdownRefusesNewConnections(t *testing.T) {
+	m := New(nil, logr.Discard())
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A connection accepted just before the listener closed
+	local, peer := net.Pipe()
+	defer local.Close()
+	defer peer.Close()
+
+	if m.trackConn(local) {
+		t.Fatal("trackConn() = true after Shutdown")
+	}
+	if len(m.conns) != 0 {
+		t.Errorf("%d connections tracked after a refused one", len(m.conns))
+	}
+}
+
+func TestShutdownClosesListeners(t *testing.T) {
+	m := New(nil, logr.Discard())
+	ctx := context.Background()
+
+	// Port 0 picks a free loopback port
+	endpoint := forwarder.BoundEndpoint{Name: "ep", URI: "https://app.example.com", LocalAddress: "127.0.0.1"}
+	if err := m.StartListener(ctx, endpoint); err != nil {
+		t.Fatal(err)
+	}
+	addr := m.listeners["ep"].listener.Addr().String()
+	accepting := m.listeners["ep"].done
+
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-accepting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("accept loop still running after Shutdown")
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("listener still accepting after Shutdown")
+	}
+	if got := m.ListActiveEndpoints(); len(got) != 0 {
+		t.Errorf("active endpoints after Shutdown = %v", got)
+	}
+}
@@ -0,0 +1,168 @@
+// Package metrics implements the few Prometheus metric types ngrokd needs
+// and writes them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are histogram bounds in seconds for network round trips
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into fixed buckets. It is safe for
+// concurrent use.
+type Histogram struct {
+	bounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates a histogram with the given ascending upper bounds
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe records a value
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// ObserveDuration records a duration in seconds
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// CounterVec is a set of counters told apart by the value of one label.
+// It is safe for concurrent use.
+type CounterVec struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// NewCounterVec creates an empty CounterVec
+func NewCounterVec() *CounterVec {
+	return &CounterVec{counts: make(map[string]uint64)}
+}
+
+// Inc increments the counter for value
+func (c *CounterVec) Inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[value]++
+}
+
+// Writer writes metric families in the Prometheus text exposition format.
+// Every family starts with Family, followed by its samples.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter creates a Writer on w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Family writes the HELP and TYPE lines of a metric family. typ is
+// "counter", "gauge" or "histogram".
+func (w *Writer) Family(name, typ, help string) {
+	fmt.Fprintf(w.w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w.w, "# TYPE %s %s\n", name, typ)
+}
+
+// Sample writes one sample. labels are name/value pairs.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	fmt.Fprintf(w.w, "%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+// Histogram writes the bucket, sum and count samples of h
+func (w *Writer) Histogram(name string, h *Histogram, labels ...string) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += counts[i]
+		w.Sample(name+"_bucket", float64(cumulative), append(labels, "le", formatValue(bound))...)
+	}
+	w.Sample(name+"_bucket", float64(count), append(labels, "le", "+Inf")...)
+	w.Sample(name+"_sum", sum, labels...)
+	w.Sample(name+"_count", float64(count), labels...)
+}
+
+// CounterVec writes one sample per value of c, labeled label=value
+func (w *Writer) CounterVec(name, label string, c *CounterVec, labels ...string) {
+	c.mu.Lock()
+	values := make([]string, 0, len(c.counts))
+	for value := range c.counts {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	counts := make([]uint64, len(values))
+	for i, value := range values {
+		counts[i] = c.counts[value]
+	}
+	c.mu.Unlock()
+
+	for i, value := range values {
+		w.Sample(name, float64(counts[i]), append(labels, label, value)...)
+	}
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.1) // Bounds are inclusive
+	h.Observe(0.5)
+	h.Observe(3)
+
+	c := NewCounterVec()
+	c.Inc("timeout")
+	c.Inc("refused")
+	c.Inc("timeout")
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	w.Family("ngrokd_up", "gauge", "Whether the daemon is up.\nAlways 1 \\o/")
+	w.Sample("ngrokd_up", 1)
+
+	w.Family("ngrokd_endpoint_info", "gauge", "Endpoint labels")
+	w.Sample("ngrokd_endpoint_info", 1, "url", `https://a.ngrok.app/"quoted"`, "note", "back\\slash\nnewline")
+
+	w.Family("ngrokd_dial_seconds", "histogram", "Dial latency")
+	w.Histogram("ngrokd_dial_seconds", h, "ingress", "a:443")
+
+	w.Family("ngrokd_errors_total", "counter", "Errors by kind")
+	w.CounterVec("ngrokd_errors_total", "kind", c, "endpoint", "ep_1")
+
+	want := `# HELP ngrokd_up Whether the daemon is up.\nAlways 1 \\o/
+# TYPE ngrokd_up gauge
+ngrokd_up 1
+# HELP ngrokd_endpoint_info Endpoint labels
+# TYPE ngrokd_endpoint_info gauge
+ngrokd_endpoint_info{url="https://a.ngrok.app/\"quoted\"",note="back\\slash\nnewline"} 1
+# HELP ngrokd_dial_seconds Dial latency
+# TYPE ngrokd_dial_seconds histogram
+ngrokd_dial_seconds_bucket{ingress="a:443",le="0.1"} 2
+ngrokd_dial_seconds_bucket{ingress="a:443",le="1"} 3
+ngrokd_dial_seconds_bucket{ingress="a:443",le="+Inf"} 4
+ngrokd_dial_seconds_sum{ingress="a:443"} 3.65
+ngrokd_dial_seconds_count{ingress="a:443"} 4
+# HELP ngrokd_errors_total Errors by kind
+# TYPE ngrokd_errors_total counter
+ngrokd_errors_total{endpoint="ep_1",kind="refused"} 1
+ngrokd_errors_total{endpoint="ep_1",kind="timeout"} 2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriterEmptyHistogram(t *testing.T) {
+	var buf bytes.Buffer
+	NewWriter(&buf).Histogram("h", NewHistogram([]float64{1}))
+
+	want := `h_bucket{le="1"} 0
+h_bucket{le="+Inf"} 0
+h_sum 0
+h_count 0
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{0, "0"},
+		{42, "42"},
+		{0.005, "0.005"},
+		{1e21, "1e+21"},
+		{-2.5, "-2.5"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		if got := formatValue(tt.v); got != tt.want {
+			t.Errorf("formatValue(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
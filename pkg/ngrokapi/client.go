@@ -3,34 +3,255 @@ package ngrokapi
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/go-logr/logr"
 )
 
 const (
-	defaultBaseURL = "https://api.ngrok.com"
-	apiVersion     = "2"
+	defaultBaseURL   = "https://api.ngrok.com"
+	defaultTimeout   = 30 * time.Second
+	defaultUserAgent = "ngrokd/0.2.0"
+	defaultPageSize  = 100
+	defaultMaxPages  = 100
+	apiVersion       = "2"
 )
 
+// Config holds the configuration for the ngrok API client
+type Config struct {
+	// BaseURL is the ngrok API base URL
+	// Default: https://api.ngrok.com
+	BaseURL string
+
+	// APIKey is the ngrok API key used for bearer authentication
+	APIKey string
+
+	// Timeout is the per-request timeout
+	// Default: 30s
+	Timeout time.Duration
+
+	// ProxyURL is an optional HTTP(S) proxy for API requests.
+	// If empty, the standard HTTPS_PROXY/NO_PROXY environment is honored.
+	ProxyURL string
+
+	// CABundle is an optional path to a PEM bundle trusted in addition
+	// to the system roots
+	CABundle string
+
+	// UserAgent is sent with every request
+	UserAgent string
+
+	// PageSize is the number of items requested per page for list calls
+	// Default: 100
+	PageSize int
+
+	// MaxPages caps how many pages a single list call will follow
+	// Default: 100
+	MaxPages int
+
+	// MaxRetries is how many times a failed request is retried with
+	// exponential backoff. Negative disables retries.
+	// Default: 3
+	MaxRetries int
+
+	// Logger for structured logging
+	Logger logr.Logger
+}
+
 // Client is an ngrok API client
 type Client struct {
 	baseURL    string
-	apiKey     string
+	userAgent  string
+	pageSize   int
+	maxPages   int
 	httpClient *http.Client
+	logger     logr.Logger
+
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	mu     sync.RWMutex
+	apiKey string
 }
 
-// NewClient creates a new ngrok API client
-func NewClient(apiKey string) *Client {
+// New creates a new ngrok API client
+func New(config Config) (*Client, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = defaultBaseURL
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = defaultUserAgent
+	}
+	if config.PageSize == 0 {
+		config.PageSize = defaultPageSize
+	}
+	if config.MaxPages == 0 {
+		config.MaxPages = defaultMaxPages
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	} else if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+
+	if u, err := url.Parse(config.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid API base URL %q", config.BaseURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if config.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(config.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in API CA bundle %s", config.CABundle)
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
 	return &Client{
-		baseURL: defaultBaseURL,
-		apiKey:  apiKey,
+		baseURL:   strings.TrimSuffix(config.BaseURL, "/"),
+		userAgent: config.UserAgent,
+		pageSize:  config.PageSize,
+		maxPages:  config.MaxPages,
+		apiKey:    config.APIKey,
+		logger:    config.Logger,
+
+		maxRetries:     config.MaxRetries,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   config.Timeout,
+			Transport: transport,
 		},
+	}, nil
+}
+
+// SetAPIKey replaces the API key used for subsequent requests
+func (c *Client) SetAPIKey(apiKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apiKey = apiKey
+}
+
+// BaseURL returns the API base URL the client talks to
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// newRequest builds an API request with the standard ngrok headers set
+func (c *Client) newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
 	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.mu.RLock()
+	apiKey := c.apiKey
+	c.mu.RUnlock()
+
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	httpReq.Header.Set("Ngrok-Version", apiVersion)
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	return httpReq, nil
+}
+
+// do executes an API request, retrying transient failures with backoff,
+// and returns the response body. Non-2xx responses are returned as *APIError.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	var lastErr error
+
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := c.backoff(attempt-1, lastErr)
+			c.logger.Info("Retrying ngrok API request",
+				"method", method,
+				"path", path,
+				"attempt", attempt,
+				"delay", delay.String(),
+				"error", lastErr.Error())
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, lastErr
+			}
+		}
+
+		respBody, err := c.doOnce(ctx, method, path, body)
+		if err == nil {
+			return respBody, nil
+		}
+		lastErr = err
+
+		if !shouldRetry(method, err) {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
+
+// doOnce executes a single API request attempt
+func (c *Client) doOnce(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	httpReq, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newAPIError(resp, bodyBytes)
+	}
+
+	return bodyBytes, nil
 }
 
 // KubernetesOperatorCreate represents the request to create a Kubernetes operator
@@ -82,28 +303,9 @@ func (c *Client) CreateKubernetesOperator(ctx context.Context, req *KubernetesOp
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/kubernetes_operators", bytes.NewReader(body))
+	bodyBytes, err := c.do(ctx, http.MethodPost, "/kubernetes_operators", body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Ngrok-Version", apiVersion)
-
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(bodyBytes))
+		return nil, err
 	}
 
 	var operator KubernetesOperator
@@ -129,35 +331,69 @@ type Endpoint struct {
 	Binding     string `json:"binding,omitempty"`
 }
 
-// ListBoundEndpoints lists all endpoints bound to a Kubernetes operator
+// PaginationError is returned by list calls when pagination cannot be
+// completed. Endpoints holds the results fetched before the failure, which
+// callers must treat as incomplete.
+type PaginationError struct {
+	Page      int        // 1-based page that failed
+	Endpoints []Endpoint // partial results from earlier pages
+	Err       error
+}
+
+func (e *PaginationError) Error() string {
+	return fmt.Sprintf("incomplete endpoint list: page %d (%d endpoints fetched so far): %v", e.Page, len(e.Endpoints), e.Err)
+}
+
+func (e *PaginationError) Unwrap() error {
+	return e.Err
+}
+
+// ErrPageLimitExceeded is wrapped in a PaginationError when more pages
+// remain after MaxPages have been fetched
+var ErrPageLimitExceeded = errors.New("page limit exceeded")
+
+// ListBoundEndpoints lists all endpoints bound to a Kubernetes operator,
+// following next_page_uri until every page has been fetched. A failure
+// after the first page returns a *PaginationError.
 func (c *Client) ListBoundEndpoints(ctx context.Context, operatorID string) ([]Endpoint, error) {
 	if operatorID == "" {
 		return nil, fmt.Errorf("operator ID is empty - certificate may not be properly provisioned")
 	}
 
-	url := fmt.Sprintf("%s/kubernetes_operators/%s/bound_endpoints", c.baseURL, operatorID)
-	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	path := fmt.Sprintf("/kubernetes_operators/%s/bound_endpoints?limit=%d", operatorID, c.pageSize)
+
+	var endpoints []Endpoint
+	for page := 1; ; page++ {
+		if page > c.maxPages {
+			return nil, &PaginationError{Page: page, Endpoints: endpoints, Err: ErrPageLimitExceeded}
+		}
+
+		pageEndpoints, next, err := c.listBoundEndpointsPage(ctx, path)
+		if err != nil {
+			if page == 1 {
+				return nil, err
+			}
+			return nil, &PaginationError{Page: page, Endpoints: endpoints, Err: err}
+		}
+		endpoints = append(endpoints, pageEndpoints...)
+
+		if next == "" {
+			return endpoints, nil
+		}
+
+		path, err = c.relativePath(next)
+		if err != nil {
+			return nil, &PaginationError{Page: page + 1, Endpoints: endpoints, Err: err}
+		}
 	}
+}
 
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
-	httpReq.Header.Set("Ngrok-Version", apiVersion)
-	httpReq.Header.Set("User-Agent", "ngrokd-forward-proxy/0.1.0")
-
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
+// listBoundEndpointsPage fetches a single page of bound endpoints and
+// returns the next page URI, if any
+func (c *Client) listBoundEndpointsPage(ctx context.Context, path string) ([]Endpoint, string, error) {
+	bodyBytes, err := c.do(ctx, http.MethodGet, path, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(bodyBytes))
+		return nil, "", err
 	}
 
 	var result struct {
@@ -167,35 +403,77 @@ func (c *Client) ListBoundEndpoints(ctx context.Context, operatorID string) ([]E
 	}
 
 	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, "", fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
-	return result.Endpoints, nil
+	return result.Endpoints, result.NextPage, nil
 }
 
-// GetKubernetesOperator retrieves a Kubernetes operator by ID
-func (c *Client) GetKubernetesOperator(ctx context.Context, id string) (*KubernetesOperator, error) {
-	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/kubernetes_operators/"+id, nil)
+// relativePath converts a next_page_uri returned by the API into a path
+// relative to the client's base URL. The base URL's path prefix (e.g. /v1)
+// is stripped once, whether the URI is absolute or relative.
+func (c *Client) relativePath(pageURI string) (string, error) {
+	u, err := url.Parse(pageURI)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("invalid next_page_uri %q: %w", pageURI, err)
 	}
+	path := u.RequestURI()
 
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
-	httpReq.Header.Set("Ngrok-Version", apiVersion)
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid API base URL %q: %w", c.baseURL, err)
+	}
+	prefix := strings.TrimSuffix(base.Path, "/")
+	if prefix == "" {
+		return path, nil
+	}
 
-	resp, err := c.httpClient.Do(httpReq)
+	rest, found := strings.CutPrefix(path, prefix)
+	if !found || (rest != "" && rest[0] != '/' && rest[0] != '?') {
+		// Not under the prefix, e.g. /v1beta/... against /v1
+		return path, nil
+	}
+	return rest, nil
+}
+
+// GetKubernetesOperator retrieves a Kubernetes operator by ID
+func (c *Client) GetKubernetesOperator(ctx context.Context, id string) (*KubernetesOperator, error) {
+	bodyBytes, err := c.do(ctx, http.MethodGet, "/kubernetes_operators/"+id, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	var operator KubernetesOperator
+	if err := json.Unmarshal(bodyBytes, &operator); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return &operator, nil
+}
+
+// KubernetesOperatorUpdate represents the request to update a Kubernetes operator
+type KubernetesOperatorUpdate struct {
+	Description string                           `json:"description,omitempty"`
+	Metadata    string                           `json:"metadata,omitempty"`
+	Binding     *KubernetesOperatorBindingUpdate `json:"binding,omitempty"`
+}
+
+// KubernetesOperatorBindingUpdate represents the binding fields that can be updated
+type KubernetesOperatorBindingUpdate struct {
+	EndpointSelectors []string `json:"endpoint_selectors,omitempty"`
+	CSR               string   `json:"csr,omitempty"` // New CSR to re-issue the binding certificate
+}
+
+// UpdateKubernetesOperator updates an existing Kubernetes operator
+func (c *Client) UpdateKubernetesOperator(ctx context.Context, id string, req *KubernetesOperatorUpdate) (*KubernetesOperator, error) {
+	body, err := json.Marshal(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(bodyBytes))
+	bodyBytes, err := c.do(ctx, http.MethodPatch, "/kubernetes_operators/"+id, body)
+	if err != nil {
+		return nil, err
 	}
 
 	var operator KubernetesOperator
@@ -0,0 +1,171 @@
+package ngrokapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// pagedServer serves total bound endpoints for k8sop_1 under basePath in
+// pages of the requested limit. failPage, if set, answers that page with
+// a 400.
+func pagedServer(t *testing.T, basePath string, total, failPage int, absoluteNext bool) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test" || r.Header.Get("Ngrok-Version") != "2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != basePath+"/kubernetes_operators/k8sop_1/bound_endpoints" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code":"ERR_NGROK_404","msg":"not found"}`))
+			return
+		}
+
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if page == failPage {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error_code":"ERR_NGROK_400","msg":"bad page"}`))
+			return
+		}
+
+		var result struct {
+			Endpoints []Endpoint `json:"endpoints"`
+			NextPage  string     `json:"next_page_uri,omitempty"`
+		}
+		for i := (page - 1) * limit; i < page*limit && i < total; i++ {
+			result.Endpoints = append(result.Endpoints, Endpoint{ID: fmt.Sprintf("ep_%d", i)})
+		}
+		if page*limit < total {
+			result.NextPage = fmt.Sprintf("%s?limit=%d&page=%d", r.URL.Path, limit, page+1)
+			if absoluteNext {
+				result.NextPage = srv.URL + result.NextPage
+			}
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	return srv
+}
+
+func TestListBoundEndpointsPagination(t *testing.T) {
+	tests := []struct {
+		name         string
+		total        int
+		pageSize     int
+		maxPages     int
+		failPage     int
+		absoluteNext bool
+		basePath     string
+
+		wantCount   int
+		wantPageErr int // failing page of a *PaginationError, 0 for success
+		wantLimit   bool
+	}{
+		{name: "single page", total: 3, pageSize: 10, maxPages: 5, wantCount: 3},
+		{name: "empty", total: 0, pageSize: 10, maxPages: 5, wantCount: 0},
+		{name: "exact pages", total: 20, pageSize: 10, maxPages: 5, wantCount: 20},
+		{name: "several pages", total: 25, pageSize: 10, maxPages: 5, wantCount: 25},
+		{name: "absolute next_page_uri", total: 25, pageSize: 10, maxPages: 5, absoluteNext: true, wantCount: 25},
+		{name: "base URL with path prefix", total: 25, pageSize: 10, maxPages: 5, basePath: "/v1", wantCount: 25},
+		{name: "absolute next_page_uri with path prefix", total: 25, pageSize: 10, maxPages: 5, absoluteNext: true, basePath: "/v1", wantCount: 25},
+		{name: "page limit", total: 25, pageSize: 10, maxPages: 2, wantPageErr: 3, wantLimit: true},
+		{name: "later page fails", total: 25, pageSize: 10, maxPages: 5, failPage: 2, wantPageErr: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := pagedServer(t, tt.basePath, tt.total, tt.failPage, tt.absoluteNext)
+			defer srv.Close()
+
+			c, err := New(Config{BaseURL: srv.URL + tt.basePath, APIKey: "test", PageSize: tt.pageSize, MaxPages: tt.maxPages, MaxRetries: -1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			endpoints, err := c.ListBoundEndpoints(context.Background(), "k8sop_1")
+			if tt.wantPageErr == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(endpoints) != tt.wantCount {
+					t.Fatalf("got %d endpoints, want %d", len(endpoints), tt.wantCount)
+				}
+				for i, ep := range endpoints {
+					if want := fmt.Sprintf("ep_%d", i); ep.ID != want {
+						t.Fatalf("endpoint %d = %s, want %s", i, ep.ID, want)
+					}
+				}
+				return
+			}
+
+			var pageErr *PaginationError
+			if !errors.As(err, &pageErr) {
+				t.Fatalf("err = %v, want *PaginationError", err)
+			}
+			if endpoints != nil {
+				t.Errorf("got %d endpoints alongside the error, want none", len(endpoints))
+			}
+			if pageErr.Page != tt.wantPageErr {
+				t.Errorf("failed page = %d, want %d", pageErr.Page, tt.wantPageErr)
+			}
+			if want := (tt.wantPageErr - 1) * tt.pageSize; len(pageErr.Endpoints) != want {
+				t.Errorf("partial results = %d, want %d", len(pageErr.Endpoints), want)
+			}
+			if got := errors.Is(err, ErrPageLimitExceeded); got != tt.wantLimit {
+				t.Errorf("errors.Is(ErrPageLimitExceeded) = %v, want %v", got, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestListBoundEndpointsFirstPageError(t *testing.T) {
+	srv := pagedServer(t, "", 5, 1, false)
+	defer srv.Close()
+
+	c, err := New(Config{BaseURL: srv.URL, APIKey: "test", MaxRetries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.ListBoundEndpoints(context.Background(), "k8sop_1")
+	var pageErr *PaginationError
+	if errors.As(err, &pageErr) {
+		t.Fatalf("first page failure returned a PaginationError: %v", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode != "ERR_NGROK_400" {
+		t.Fatalf("err = %v, want the API error", err)
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	c := &Client{baseURL: "https://api.example.com/v1"}
+
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"https://api.example.com/v1/things?page=2", "/things?page=2"},
+		{"https://other.example.com/things?before_id=x", "/things?before_id=x"},
+		{"/things?page=3", "/things?page=3"},
+		{"/v1/things?page=3", "/things?page=3"},
+		{"/v1?page=3", "?page=3"},
+		{"/v1beta/things", "/v1beta/things"},
+	}
+	for _, tt := range tests {
+		got, err := c.relativePath(tt.uri)
+		if err != nil || got != tt.want {
+			t.Errorf("relativePath(%q) = %q, %v; want %q", tt.uri, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ngrokapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is returned when the ngrok API responds with a non-2xx status
+type APIError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+
+	// ErrorCode is the ngrok error code (e.g. ERR_NGROK_123), if provided
+	ErrorCode string
+
+	// Message is the human-readable error message from the API
+	Message string
+
+	// RetryAfter is the delay requested by the Retry-After header, if any
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.ErrorCode != "" {
+		return fmt.Sprintf("API error %d [%s]: %s", e.StatusCode, e.ErrorCode, e.Message)
+	}
+	return fmt.Sprintf("API error %d: %s", e.StatusCode, e.Message)
+}
+
+// Retryable reports whether the request may succeed if retried
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// IsRateLimited reports whether err is an API 429 response
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// newAPIError builds an APIError from a failed response and its body
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	// ngrok API errors look like {"error_code":"ERR_NGROK_...","status_code":429,"msg":"..."}
+	var payload struct {
+		ErrorCode string `json:"error_code"`
+		Msg       string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		apiErr.ErrorCode = payload.ErrorCode
+		if payload.Msg != "" {
+			apiErr.Message = payload.Msg
+		}
+	}
+
+	return apiErr
+}
+
+// parseRetryAfter parses a Retry-After header given either as delay
+// seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,78 @@
+package ngrokapi
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMaxRetries     = 3
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// shouldRetry reports whether a failed request may be retried.
+// Non-idempotent requests are only retried when the API signals the
+// request was not processed (rate limited or unavailable); a 502 or 504
+// may come after the request was already applied.
+func shouldRetry(method string, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		// Transport error - safe to retry idempotent requests
+		return method == http.MethodGet
+	}
+
+	if method == http.MethodGet {
+		return apiErr.Retryable()
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before retry number attempt (0-based): full
+// jitter exponential backoff, raised to Retry-After when the API asked
+// for a longer wait. Retry-After is capped at the maximum backoff so a
+// large value can't stall the caller.
+func (c *Client) backoff(attempt int, err error) time.Duration {
+	ceiling := c.initialBackoff << attempt
+	if ceiling <= 0 || ceiling > c.maxBackoff {
+		ceiling = c.maxBackoff
+	}
+	delay := time.Duration(rand.Int63n(int64(ceiling) + 1))
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > delay {
+		delay = min(apiErr.RetryAfter, c.maxBackoff)
+	}
+
+	return delay
+}
+
+// sleepContext waits for d or until ctx is done. It fails right away if
+// ctx's deadline comes before d has passed.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return context.DeadlineExceeded
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
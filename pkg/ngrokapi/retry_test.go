@@ -0,0 +1,187 @@
+package ngrokapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestShouldRetry(t *testing.T) {
+	apiErr := func(status int) error { return &APIError{StatusCode: status} }
+
+	tests := []struct {
+		name   string
+		method string
+		err    error
+		want   bool
+	}{
+		{"GET transport error", http.MethodGet, errors.New("connection refused"), true},
+		{"POST transport error", http.MethodPost, errors.New("connection refused"), false},
+		{"GET 429", http.MethodGet, apiErr(http.StatusTooManyRequests), true},
+		{"GET 500", http.MethodGet, apiErr(http.StatusInternalServerError), true},
+		{"GET 502", http.MethodGet, apiErr(http.StatusBadGateway), true},
+		{"GET 404", http.MethodGet, apiErr(http.StatusNotFound), false},
+		{"POST 429", http.MethodPost, apiErr(http.StatusTooManyRequests), true},
+		{"POST 503", http.MethodPost, apiErr(http.StatusServiceUnavailable), true},
+		{"POST 500", http.MethodPost, apiErr(http.StatusInternalServerError), false},
+		{"POST 502", http.MethodPost, apiErr(http.StatusBadGateway), false},
+		{"POST 504", http.MethodPost, apiErr(http.StatusGatewayTimeout), false},
+		{"PATCH 502", http.MethodPatch, apiErr(http.StatusBadGateway), false},
+		{"GET canceled", http.MethodGet, context.Canceled, false},
+		{"GET deadline", http.MethodGet, fmt.Errorf("wrapped: %w", context.DeadlineExceeded), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldRetry(tt.method, tt.err); got != tt.want {
+				t.Errorf("shouldRetry(%s, %v) = %v, want %v", tt.method, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffCapsRetryAfter(t *testing.T) {
+	c := &Client{initialBackoff: 10 * time.Millisecond, maxBackoff: time.Second}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		if d := c.backoff(attempt, errors.New("boom")); d < 0 || d > c.maxBackoff {
+			t.Errorf("backoff(%d) = %s, want within [0, %s]", attempt, d, c.maxBackoff)
+		}
+	}
+
+	if d := c.backoff(0, &APIError{StatusCode: 429, RetryAfter: 500 * time.Millisecond}); d < 500*time.Millisecond {
+		t.Errorf("backoff with Retry-After 500ms = %s, want at least 500ms", d)
+	}
+	if d := c.backoff(0, &APIError{StatusCode: 429, RetryAfter: time.Hour}); d != c.maxBackoff {
+		t.Errorf("backoff with Retry-After 1h = %s, want %s", d, c.maxBackoff)
+	}
+}
+
+// newTestClient returns a client for srv that retries without waiting long
+func newTestClient(t *testing.T, srv *httptest.Server) *Client {
+	t.Helper()
+	c, err := New(Config{BaseURL: srv.URL, APIKey: "test", Logger: logr.Discard()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.initialBackoff = time.Millisecond
+	c.maxBackoff = 5 * time.Millisecond
+	return c
+}
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		status    int
+		wantCalls int32
+	}{
+		{"GET retries 502", http.MethodGet, http.StatusBadGateway, 4},
+		{"GET doesn't retry 400", http.MethodGet, http.StatusBadRequest, 1},
+		{"POST retries 503", http.MethodPost, http.StatusServiceUnavailable, 4},
+		{"POST doesn't retry 502", http.MethodPost, http.StatusBadGateway, 1},
+		{"POST doesn't retry 504", http.MethodPost, http.StatusGatewayTimeout, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			c := newTestClient(t, srv)
+			_, err := c.do(context.Background(), tt.method, "/test", nil)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("err = %v, want APIError with status %d", err, tt.status)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoRecoversAfterRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	body, err := newTestClient(t, srv).do(context.Background(), http.MethodGet, "/test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"ok":true}` || calls.Load() != 3 {
+		t.Errorf("body = %q after %d calls, want success on the third", body, calls.Load())
+	}
+}
+
+func TestDoStopsWhenRetryAfterExceedsDeadline(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv)
+	c.maxBackoff = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.do(ctx, http.MethodGet, "/test", nil)
+	if !IsRateLimited(err) {
+		t.Fatalf("err = %v, want the 429", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("do took %s, want it to give up without waiting for the deadline", elapsed)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"0", 0},
+		{"-3", 0},
+		{"soon", 0},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0}, // in the past
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got <= 0 || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %s, want within a minute", future, got)
+	}
+}
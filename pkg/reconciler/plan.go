@@ -0,0 +1,252 @@
+package reconciler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/forwarder"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/ipalloc"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
+)
+
+// Action is the kind of change a plan makes to an endpoint
+type Action string
+
+const (
+	ActionAdd    Action = "add"
+	ActionUpdate Action = "update"
+	ActionRemove Action = "remove"
+)
+
+// FieldChange describes one field that differs between actual and desired state
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// Change is a single planned change to one endpoint
+type Change struct {
+	Action Action
+
+	// Desired is the endpoint as returned by the API (add/update)
+	Desired ngrokapi.Endpoint
+
+	// Current is the tracked endpoint (update/remove)
+	Current *Endpoint
+
+	// Hostname and Port parsed from the desired URL (or current, for removals)
+	Hostname string
+	Port     int
+
+	// Placement is where the endpoint will listen (add/update) or was
+	// listening (remove). For adds it is a preview and may differ slightly
+	// once applied, e.g. after a port conflict.
+	Placement Placement
+
+	// Options are the forwarding settings the endpoint will use
+	Options forwarder.EndpointOptions
+
+	// Fields lists what changed (update only)
+	Fields []FieldChange
+
+	// Err is set if the change can't be applied, e.g. the listen interface
+	// doesn't resolve. Such changes are skipped by Apply.
+	Err error
+}
+
+// optionFields are the fields optionChanges reports
+var optionFields = map[string]bool{
+	"forwarded_headers": true,
+	"proxy_protocol":    true,
+	"idle_timeout":      true,
+	"max_lifetime":      true,
+}
+
+// OptionsOnly reports whether an update changes only forwarding settings,
+// which don't need the listener restarted
+func (c Change) OptionsOnly() bool {
+	if c.Action != ActionUpdate || len(c.Fields) == 0 {
+		return false
+	}
+	for _, f := range c.Fields {
+		if !optionFields[f.Field] {
+			return false
+		}
+	}
+	return true
+}
+
+// ID returns the endpoint ID the change applies to
+func (c Change) ID() string {
+	if c.Current != nil {
+		return c.Current.ID
+	}
+	return c.Desired.ID
+}
+
+// URL returns the endpoint URL the change applies to
+func (c Change) URL() string {
+	if c.Action == ActionRemove {
+		return c.Current.URL
+	}
+	return c.Desired.URL
+}
+
+// Plan is the set of changes needed to converge the tracked endpoints on
+// the desired state
+type Plan struct {
+	Changes   []Change
+	Unchanged int
+}
+
+// Empty reports whether the plan makes no changes
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// plan computes the changes from the tracked state to desired. It never
+// mutates state. Caller must hold r.mu.
+func (r *Reconciler) plan(desired []ngrokapi.Endpoint) *Plan {
+	plan := &Plan{}
+	desiredByID := make(map[string]ngrokapi.Endpoint, len(desired))
+
+	for _, ep := range desired {
+		desiredByID[ep.ID] = ep
+	}
+
+	// Removals
+	for id, cur := range r.endpoints {
+		if _, exists := desiredByID[id]; exists {
+			continue
+		}
+		cur := cur
+		plan.Changes = append(plan.Changes, Change{
+			Action:    ActionRemove,
+			Current:   &cur,
+			Hostname:  cur.Hostname,
+			Port:      cur.Port,
+			Placement: cur.Placement,
+		})
+	}
+
+	// Adds and updates
+	for id, ep := range desiredByID {
+		hostname, port, err := ipalloc.ParseHostname(ep.URL)
+		if err != nil {
+			err = fmt.Errorf("failed to parse endpoint URL %s: %w", ep.URL, err)
+		}
+
+		var placement Placement
+		var options forwarder.EndpointOptions
+		if err == nil {
+			placement, err = r.allocator.Preview(hostname, port)
+			options = r.endpointOptions(hostname, port)
+		}
+
+		cur, exists := r.endpoints[id]
+		if !exists {
+			plan.Changes = append(plan.Changes, Change{
+				Action:    ActionAdd,
+				Desired:   ep,
+				Hostname:  hostname,
+				Port:      port,
+				Placement: placement,
+				Options:   options,
+				Err:       err,
+			})
+			continue
+		}
+
+		fields := endpointChanges(cur, ep, hostname, port)
+		if err == nil {
+			fields = append(fields, placementChanges(cur.Placement, placement)...)
+			fields = append(fields, optionChanges(cur.Options, options)...)
+		}
+		if len(fields) == 0 {
+			plan.Unchanged++
+			continue
+		}
+
+		plan.Changes = append(plan.Changes, Change{
+			Action:    ActionUpdate,
+			Desired:   ep,
+			Current:   &cur,
+			Hostname:  hostname,
+			Port:      port,
+			Placement: placement,
+			Options:   options,
+			Fields:    fields,
+			Err:       err,
+		})
+	}
+
+	// Removals first so freed IPs/ports can be reused, then by URL for stable output
+	order := map[Action]int{ActionRemove: 0, ActionUpdate: 1, ActionAdd: 2}
+	sort.Slice(plan.Changes, func(i, j int) bool {
+		a, b := plan.Changes[i], plan.Changes[j]
+		if order[a.Action] != order[b.Action] {
+			return order[a.Action] < order[b.Action]
+		}
+		return a.URL() < b.URL()
+	})
+
+	return plan
+}
+
+// endpointChanges compares a tracked endpoint against the desired API state
+func endpointChanges(cur Endpoint, ep ngrokapi.Endpoint, hostname string, port int) []FieldChange {
+	var changes []FieldChange
+
+	if cur.URL != ep.URL {
+		changes = append(changes, FieldChange{"url", cur.URL, ep.URL})
+
+		if hostname != "" && hostname != cur.Hostname {
+			changes = append(changes, FieldChange{"hostname", cur.Hostname, hostname})
+		}
+		if port != 0 && port != cur.Port {
+			changes = append(changes, FieldChange{"port", fmt.Sprint(cur.Port), fmt.Sprint(port)})
+		}
+	}
+
+	if cur.Proto != ep.Proto {
+		changes = append(changes, FieldChange{"proto", cur.Proto, ep.Proto})
+	}
+
+	return changes
+}
+
+// placementChanges compares where an endpoint listens today against where
+// the current configuration would place it
+func placementChanges(cur, next Placement) []FieldChange {
+	var changes []FieldChange
+
+	if cur.ListenInterface != next.ListenInterface {
+		changes = append(changes, FieldChange{"listen_interface", cur.ListenInterface, next.ListenInterface})
+	}
+	if cur.ListenAddr() != next.ListenAddr() {
+		changes = append(changes, FieldChange{"listen_address", cur.ListenAddr(), next.ListenAddr()})
+	}
+
+	return changes
+}
+
+// optionChanges compares an endpoint's forwarding settings against the configured ones
+func optionChanges(cur, next forwarder.EndpointOptions) []FieldChange {
+	var changes []FieldChange
+
+	if cur.ForwardedHeaders != next.ForwardedHeaders {
+		changes = append(changes, FieldChange{"forwarded_headers", cur.ForwardedHeaders, next.ForwardedHeaders})
+	}
+	if cur.ProxyProtocol != next.ProxyProtocol {
+		changes = append(changes, FieldChange{"proxy_protocol", cur.ProxyProtocol, next.ProxyProtocol})
+	}
+	if cur.IdleTimeout != next.IdleTimeout {
+		changes = append(changes, FieldChange{"idle_timeout", cur.IdleTimeout.String(), next.IdleTimeout.String()})
+	}
+	if cur.MaxLifetime != next.MaxLifetime {
+		changes = append(changes, FieldChange{"max_lifetime", cur.MaxLifetime.String(), next.MaxLifetime.String()})
+	}
+
+	return changes
+}
@@ -0,0 +1,213 @@
+package reconciler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/forwarder"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
+)
+
+// fakeAllocator places every endpoint on the IP named in ips, listening
+// on its own port
+type fakeAllocator struct {
+	Allocator
+	ips      map[string]string
+	listenOn string
+	unplaced string // hostname Preview fails for
+}
+
+func (a *fakeAllocator) Preview(hostname string, port int) (Placement, error) {
+	if hostname == a.unplaced {
+		return Placement{}, errors.New("listen interface doesn't resolve")
+	}
+	return Placement{IP: a.ips[hostname], ListenInterface: a.listenOn, ListenAddress: a.ips[hostname], ListenPort: port}, nil
+}
+
+func tracked(id, url, proto, hostname string, port int, ip string) Endpoint {
+	return Endpoint{
+		ID:            id,
+		URL:           url,
+		Proto:         proto,
+		Hostname:      hostname,
+		Port:          port,
+		Placement:     Placement{IP: ip, ListenInterface: "virtual", ListenAddress: ip, ListenPort: port},
+		LocalListener: true,
+	}
+}
+
+func TestPlan(t *testing.T) {
+	ips := map[string]string{"api.ngrok.app": "10.107.0.1", "web.ngrok.app": "10.107.0.2", "db.ngrok.app": "10.107.0.3"}
+	api := tracked("ep_api", "https://api.ngrok.app", "https", "api.ngrok.app", 443, "10.107.0.1")
+	web := tracked("ep_web", "http://web.ngrok.app", "http", "web.ngrok.app", 80, "10.107.0.2")
+
+	type change struct {
+		action Action
+		id     string
+		fields []FieldChange
+		err    bool
+	}
+
+	tests := []struct {
+		name          string
+		current       []Endpoint
+		desired       []ngrokapi.Endpoint
+		listenOn      string
+		unplaced      string
+		options       forwarder.EndpointOptions
+		want          []change
+		wantUnchanged int
+	}{
+		{
+			name: "nothing to do",
+		},
+		{
+			name:    "add",
+			desired: []ngrokapi.Endpoint{{ID: "ep_api", URL: "https://api.ngrok.app", Proto: "https"}},
+			want:    []change{{action: ActionAdd, id: "ep_api"}},
+		},
+		{
+			name:    "remove",
+			current: []Endpoint{api},
+			want:    []change{{action: ActionRemove, id: "ep_api"}},
+		},
+		{
+			name:          "unchanged",
+			current:       []Endpoint{api, web},
+			desired:       []ngrokapi.Endpoint{{ID: "ep_api", URL: "https://api.ngrok.app", Proto: "https"}, {ID: "ep_web", URL: "http://web.ngrok.app", Proto: "http"}},
+			wantUnchanged: 2,
+		},
+		{
+			name:    "proto changed",
+			current: []Endpoint{api},
+			desired: []ngrokapi.Endpoint{{ID: "ep_api", URL: "https://api.ngrok.app", Proto: "tls"}},
+			want:    []change{{action: ActionUpdate, id: "ep_api", fields: []FieldChange{{"proto", "https", "tls"}}}},
+		},
+		{
+			name:    "url changed",
+			current: []Endpoint{api},
+			desired: []ngrokapi.Endpoint{{ID: "ep_api", URL: "tcp://db.ngrok.app:5432", Proto: "https"}},
+			want: []change{{action: ActionUpdate, id: "ep_api", fields: []FieldChange{
+				{"url", "https://api.ngrok.app", "tcp://db.ngrok.app:5432"},
+				{"hostname", "api.ngrok.app", "db.ngrok.app"},
+				{"port", "443", "5432"},
+				{"listen_address", "10.107.0.1:443", "10.107.0.3:5432"},
+			}}},
+		},
+		{
+			name:     "listen interface changed",
+			current:  []Endpoint{api},
+			desired:  []ngrokapi.Endpoint{{ID: "ep_api", URL: "https://api.ngrok.app", Proto: "https"}},
+			listenOn: "0.0.0.0",
+			want:     []change{{action: ActionUpdate, id: "ep_api", fields: []FieldChange{{"listen_interface", "virtual", "0.0.0.0"}}}},
+		},
+		{
+			name:    "options changed",
+			current: []Endpoint{api},
+			desired: []ngrokapi.Endpoint{{ID: "ep_api", URL: "https://api.ngrok.app", Proto: "https"}},
+			options: forwarder.EndpointOptions{ForwardedHeaders: forwarder.ForwardedReplace, IdleTimeout: time.Hour},
+			want: []change{{action: ActionUpdate, id: "ep_api", fields: []FieldChange{
+				{"forwarded_headers", "", "replace"},
+				{"idle_timeout", "0s", "1h0m0s"},
+			}}},
+		},
+		{
+			name:    "unparseable url",
+			desired: []ngrokapi.Endpoint{{ID: "ep_bad", URL: "api.ngrok.app", Proto: "https"}},
+			want:    []change{{action: ActionAdd, id: "ep_bad", err: true}},
+		},
+		{
+			name:     "placement fails",
+			desired:  []ngrokapi.Endpoint{{ID: "ep_api", URL: "https://api.ngrok.app", Proto: "https"}},
+			unplaced: "api.ngrok.app",
+			want:     []change{{action: ActionAdd, id: "ep_api", err: true}},
+		},
+		{
+			name:    "removals, then updates, then adds by url",
+			current: []Endpoint{api, web},
+			desired: []ngrokapi.Endpoint{
+				{ID: "ep_db2", URL: "tcp://db.ngrok.app:5433", Proto: "tcp"},
+				{ID: "ep_db1", URL: "tcp://db.ngrok.app:5432", Proto: "tcp"},
+				{ID: "ep_web", URL: "http://web.ngrok.app", Proto: "https"},
+			},
+			want: []change{
+				{action: ActionRemove, id: "ep_api"},
+				{action: ActionUpdate, id: "ep_web", fields: []FieldChange{{"proto", "http", "https"}}},
+				{action: ActionAdd, id: "ep_db1"},
+				{action: ActionAdd, id: "ep_db2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listenOn := tt.listenOn
+			if listenOn == "" {
+				listenOn = "virtual"
+			}
+			r := New(Config{
+				Allocator: &fakeAllocator{ips: ips, listenOn: listenOn, unplaced: tt.unplaced},
+				Options:   func(string, int) forwarder.EndpointOptions { return tt.options },
+				Logger:    logr.Discard(),
+			})
+			for _, ep := range tt.current {
+				r.endpoints[ep.ID] = ep
+			}
+
+			plan := r.Plan(tt.desired)
+
+			var got []change
+			for _, c := range plan.Changes {
+				got = append(got, change{action: c.Action, id: c.ID(), fields: c.Fields, err: c.Err != nil})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes = %+v\nwant %+v", got, tt.want)
+			}
+			if plan.Unchanged != tt.wantUnchanged {
+				t.Errorf("unchanged = %d, want %d", plan.Unchanged, tt.wantUnchanged)
+			}
+			if plan.Empty() != (len(tt.want) == 0) {
+				t.Errorf("Empty() = %v with %d changes", plan.Empty(), len(plan.Changes))
+			}
+		})
+	}
+}
+
+func TestPlanDoesNotMutateState(t *testing.T) {
+	r := New(Config{
+		Allocator: &fakeAllocator{ips: map[string]string{}, listenOn: "virtual"},
+		Logger:    logr.Discard(),
+	})
+	api := tracked("ep_api", "https://api.ngrok.app", "https", "api.ngrok.app", 443, "10.107.0.1")
+	r.endpoints[api.ID] = api
+
+	r.Plan([]ngrokapi.Endpoint{{ID: "ep_web", URL: "http://web.ngrok.app", Proto: "http"}})
+
+	if len(r.endpoints) != 1 || !reflect.DeepEqual(r.endpoints[api.ID], api) {
+		t.Errorf("tracked endpoints changed by Plan: %+v", r.endpoints)
+	}
+}
+
+func TestChangeOptionsOnly(t *testing.T) {
+	tests := []struct {
+		name   string
+		change Change
+		want   bool
+	}{
+		{"option fields", Change{Action: ActionUpdate, Fields: []FieldChange{{"idle_timeout", "0s", "1m0s"}, {"proxy_protocol", "", "v2"}}}, true},
+		{"port and option", Change{Action: ActionUpdate, Fields: []FieldChange{{"port", "80", "8080"}, {"idle_timeout", "0s", "1m0s"}}}, false},
+		{"no fields", Change{Action: ActionUpdate}, false},
+		{"add", Change{Action: ActionAdd, Fields: []FieldChange{{"idle_timeout", "0s", "1m0s"}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.change.OptionsOnly(); got != tt.want {
+				t.Errorf("OptionsOnly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/forwarder"
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
+)
+
+// maxBindAttempts bounds how many network ports are tried when binding
+// a listener hits "address already in use"
+const maxBindAttempts = 20
+
+// Network manages IP addresses on the virtual interface (netif.Interface)
+type Network interface {
+	AddIP(ip net.IP) error
+	RemoveIP(ip net.IP) error
+}
+
+// Listeners starts and stops local listeners (listener.Manager)
+type Listeners interface {
+	StartListener(ctx context.Context, endpoint forwarder.BoundEndpoint) error
+	StopListener(endpointName string) error
+	UpdateOptions(endpointName string, options forwarder.EndpointOptions) error
+}
+
+// Hosts publishes hostname -> IP mappings (hosts.Manager)
+type Hosts interface {
+	UpdateHosts(mappings map[string]string) error
+}
+
+// Status tracks endpoints for health reporting (health.Server)
+type Status interface {
+	RegisterEndpoint(name, localAddr, targetURI string)
+	UnregisterEndpoint(name string)
+}
+
+// Allocator decides where endpoints listen
+type Allocator interface {
+	// Preview returns the placement an endpoint would get, without reserving anything
+	Preview(hostname string, port int) (Placement, error)
+
+	// Allocate reserves an IP and listen address for an endpoint
+	Allocate(hostname string, port int) (Placement, error)
+
+	// Reassign moves a network-mode endpoint to a new listen port after a bind conflict
+	Reassign(hostname string, port int, current Placement) (Placement, error)
+
+	// Release frees the endpoint's port; releaseIP also drops the hostname's IP allocation
+	Release(hostname string, port int, releaseIP bool)
+
+	// Mappings returns all hostname -> IP allocations
+	Mappings() map[string]string
+}
+
+// Placement describes where an endpoint is reachable locally
+type Placement struct {
+	IP              string // Virtual IP allocated to the hostname
+	ListenInterface string // "virtual", "0.0.0.0" or a specific IP
+	ListenAddress   string // Address the local listener binds
+	ListenPort      int    // Port the local listener binds
+}
+
+// Virtual reports whether the endpoint listens on its own virtual IP
+func (p Placement) Virtual() bool {
+	return p.ListenInterface == "virtual"
+}
+
+// ListenAddr returns the host:port the local listener binds
+func (p Placement) ListenAddr() string {
+	return net.JoinHostPort(p.ListenAddress, fmt.Sprint(p.ListenPort))
+}
+
+// Endpoint is a bound endpoint as tracked by the reconciler
+type Endpoint struct {
+	ID            string
+	URL           string
+	Proto         string
+	Hostname      string
+	Port          int
+	Placement     Placement
+	Options       forwarder.EndpointOptions
+	LocalListener bool
+}
+
+// Config holds the reconciler's dependencies
+type Config struct {
+	Network   Network // optional
+	Listeners Listeners
+	Hosts     Hosts
+	Status    Status // optional
+	Allocator Allocator
+
+	// Options returns per-endpoint forwarding settings (optional)
+	Options func(hostname string, port int) forwarder.EndpointOptions
+
+	Logger logr.Logger
+}
+
+// Reconciler converges local listeners, IPs and hosts entries on the set of
+// bound endpoints returned by the ngrok API
+type Reconciler struct {
+	network   Network
+	listeners Listeners
+	hosts     Hosts
+	status    Status
+	allocator Allocator
+	options   func(hostname string, port int) forwarder.EndpointOptions
+	logger    logr.Logger
+
+	mu          sync.RWMutex
+	endpoints   map[string]Endpoint // endpoint ID -> tracked state
+	lastDesired []ngrokapi.Endpoint
+}
+
+// New creates a new Reconciler
+func New(config Config) *Reconciler {
+	return &Reconciler{
+		network:   config.Network,
+		listeners: config.Listeners,
+		hosts:     config.Hosts,
+		status:    config.Status,
+		allocator: config.Allocator,
+		options:   config.Options,
+		logger:    config.Logger,
+		endpoints: make(map[string]Endpoint),
+	}
+}
+
+// Plan computes the changes needed to converge on desired without applying them
+func (r *Reconciler) Plan(desired []ngrokapi.Endpoint) *Plan {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.plan(desired)
+}
+
+// Reconcile plans and applies the changes needed to converge on desired
+func (r *Reconciler) Reconcile(ctx context.Context, desired []ngrokapi.Endpoint) *Plan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastDesired = desired
+	plan := r.plan(desired)
+	r.apply(ctx, plan)
+
+	return plan
+}
+
+// Resync re-applies the last desired state, e.g. after listen settings
+// changed in the config
+func (r *Reconciler) Resync(ctx context.Context) *Plan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	plan := r.plan(r.lastDesired)
+	r.apply(ctx, plan)
+
+	return plan
+}
+
+// Endpoints returns a snapshot of the tracked endpoints
+func (r *Reconciler) Endpoints() []Endpoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]Endpoint, 0, len(r.endpoints))
+	for _, ep := range r.endpoints {
+		result = append(result, ep)
+	}
+	return result
+}
+
+// endpointOptions returns the forwarding settings for an endpoint
+func (r *Reconciler) endpointOptions(hostname string, port int) forwarder.EndpointOptions {
+	if r.options == nil {
+		return forwarder.EndpointOptions{}
+	}
+	return r.options(hostname, port)
+}
+
+// apply executes a plan. Caller must hold r.mu.
+func (r *Reconciler) apply(ctx context.Context, plan *Plan) {
+	for _, change := range plan.Changes {
+		if change.Err != nil {
+			r.logger.Error(change.Err, "⚠️  Skipping endpoint change",
+				"action", string(change.Action),
+				"endpoint", change.ID(),
+				"url", change.URL())
+			continue
+		}
+
+		switch change.Action {
+		case ActionRemove:
+			r.remove(change.Current.ID)
+		case ActionUpdate:
+			r.update(ctx, change)
+		case ActionAdd:
+			r.add(ctx, change)
+		}
+	}
+
+	if err := r.hosts.UpdateHosts(r.allocator.Mappings()); err != nil {
+		r.logger.Error(err, "Failed to update /etc/hosts")
+	}
+}
+
+func (r *Reconciler) add(ctx context.Context, change Change) {
+	ep := change.Desired
+
+	placement, err := r.allocator.Allocate(change.Hostname, change.Port)
+	if err != nil {
+		r.logger.Error(err, "Failed to place endpoint", "endpoint", ep.URL, "hostname", change.Hostname)
+		return
+	}
+
+	// Add IP to virtual interface
+	if r.network != nil {
+		if ip := net.ParseIP(placement.IP); ip != nil {
+			if err := r.network.AddIP(ip); err != nil {
+				r.logger.Error(err, "Failed to add IP to interface", "ip", placement.IP)
+				// Continue anyway - listener may still work
+			}
+		}
+	}
+
+	endpoint := forwarder.BoundEndpoint{
+		Name:         ep.ID,
+		URI:          ep.URL,
+		Port:         change.Port,
+		LocalPort:    placement.ListenPort,
+		LocalAddress: placement.ListenAddress,
+		Options:      change.Options,
+	}
+
+	// Create listener with retry on port conflict (network mode only)
+	started := false
+	for attempt := 0; attempt < maxBindAttempts; attempt++ {
+		err = r.listeners.StartListener(ctx, endpoint)
+		if err == nil {
+			started = true
+			break
+		}
+
+		if placement.Virtual() || !strings.Contains(err.Error(), "address already in use") {
+			break
+		}
+
+		next, rerr := r.allocator.Reassign(change.Hostname, change.Port, placement)
+		if rerr != nil {
+			err = rerr
+			break
+		}
+
+		r.logger.Info("Port in use, trying next port",
+			"endpoint", ep.URL,
+			"conflicted_port", placement.ListenPort,
+			"next_port", next.ListenPort)
+
+		placement = next
+		endpoint.LocalPort = placement.ListenPort
+	}
+
+	if !started {
+		r.logger.Error(err, "⚠️  Failed to start listener",
+			"endpoint", ep.URL,
+			"address", placement.ListenAddr())
+		if placement.Virtual() {
+			r.logger.Error(err, "⚠️  Endpoint unavailable - port conflict on unique IP")
+		}
+		r.allocator.Release(change.Hostname, change.Port, false)
+		return
+	}
+
+	if placement.Virtual() {
+		r.logger.Info("Started listener",
+			"endpoint", ep.URL,
+			"address", placement.ListenAddr(),
+			"mode", "virtual")
+	} else {
+		r.logger.Info("Started listener",
+			"endpoint", ep.URL,
+			"address", placement.ListenAddr(),
+			"mode", "network",
+			"accessible_from", placement.ListenInterface)
+	}
+
+	if r.status != nil {
+		r.status.RegisterEndpoint(ep.ID, net.JoinHostPort(placement.IP, fmt.Sprint(change.Port)), ep.URL)
+	}
+
+	r.endpoints[ep.ID] = Endpoint{
+		ID:            ep.ID,
+		URL:           ep.URL,
+		Proto:         ep.Proto,
+		Hostname:      change.Hostname,
+		Port:          change.Port,
+		Placement:     placement,
+		Options:       change.Options,
+		LocalListener: true,
+	}
+
+	r.logger.Info("Added bound endpoint",
+		"hostname", change.Hostname,
+		"ip", placement.IP,
+		"port", change.Port,
+		"url", ep.URL)
+}
+
+func (r *Reconciler) remove(id string) {
+	ep, exists := r.endpoints[id]
+	if !exists {
+		return
+	}
+
+	r.listeners.StopListener(id)
+	delete(r.endpoints, id)
+
+	// IPs and hostnames can be shared by endpoints on different ports
+	ipInUse, hostnameInUse := false, false
+	for _, other := range r.endpoints {
+		if other.Placement.IP == ep.Placement.IP {
+			ipInUse = true
+		}
+		if other.Hostname == ep.Hostname {
+			hostnameInUse = true
+		}
+	}
+
+	if r.network != nil && !ipInUse {
+		if ip := net.ParseIP(ep.Placement.IP); ip != nil {
+			if err := r.network.RemoveIP(ip); err != nil {
+				r.logger.Error(err, "Failed to remove IP from interface", "ip", ep.Placement.IP)
+			}
+		}
+	}
+
+	r.allocator.Release(ep.Hostname, ep.Port, !hostnameInUse)
+
+	if r.status != nil {
+		r.status.UnregisterEndpoint(id)
+	}
+
+	r.logger.Info("Removed bound endpoint", "hostname", ep.Hostname, "ip", ep.Placement.IP)
+}
+
+// update applies changes to an existing endpoint. Changed forwarding
+// settings alone are applied to the running listener, so open connections
+// survive. Otherwise the listener is restarted on the new port/target,
+// keeping the IP allocation when the hostname is unchanged.
+func (r *Reconciler) update(ctx context.Context, change Change) {
+	cur := change.Current
+
+	hostnameChanged := false
+	for _, f := range change.Fields {
+		r.logger.Info("Bound endpoint changed",
+			"event", "endpoint_changed",
+			"endpoint", cur.ID,
+			"field", f.Field,
+			"old", f.Old,
+			"new", f.New)
+		if f.Field == "hostname" {
+			hostnameChanged = true
+		}
+	}
+
+	if change.OptionsOnly() {
+		err := r.listeners.UpdateOptions(cur.ID, change.Options)
+		if err == nil {
+			updated := *cur
+			updated.Options = change.Options
+			r.endpoints[cur.ID] = updated
+
+			r.logger.Info("Bound endpoint updated in place",
+				"event", "endpoint_updated",
+				"endpoint", cur.ID,
+				"url", updated.URL,
+				"listen_address", updated.Placement.ListenAddr())
+			return
+		}
+		r.logger.Info("Could not update listener in place, restarting it",
+			"endpoint", cur.ID,
+			"error", err)
+	}
+
+	if hostnameChanged {
+		// New hostname needs its own allocation and hosts entry
+		r.remove(cur.ID)
+	} else {
+		r.listeners.StopListener(cur.ID)
+		delete(r.endpoints, cur.ID)
+		r.allocator.Release(cur.Hostname, cur.Port, false)
+		if r.status != nil {
+			r.status.UnregisterEndpoint(cur.ID)
+		}
+	}
+
+	r.add(ctx, change)
+
+	if updated, ok := r.endpoints[cur.ID]; ok {
+		r.logger.Info("Bound endpoint updated",
+			"event", "endpoint_updated",
+			"endpoint", cur.ID,
+			"url", updated.URL,
+			"listen_address", updated.Placement.ListenAddr())
+	} else {
+		r.logger.Info("⚠️  Bound endpoint update failed, will retry next poll",
+			"event", "endpoint_update_failed",
+			"endpoint", cur.ID,
+			"url", change.Desired.URL)
+	}
+}
@@ -0,0 +1,282 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
+)
+
+// ErrUnsupported is returned by Parse for expressions that are valid
+// ngrok selectors but outside the subset evaluated locally. Those are
+// still applied server-side by the ngrok API.
+var ErrUnsupported = errors.New("selector not supported for local evaluation")
+
+// Selector is a parsed endpoint selector expression.
+//
+// The supported subset is one or more terms joined by "&&", where each term is
+//   true | false
+//   endpoint.<field> == "value"   (or != )
+//   endpoint.<field>.startsWith("value") | endsWith | contains | matches
+//
+// optionally negated with a leading "!" for the method forms. Values are
+// quoted strings without quotes or escapes inside, or integers.
+//
+// Fields: id, url, hostname, port, proto, type, metadata, description.
+type Selector struct {
+	expr  string
+	terms []term
+}
+
+type term struct {
+	field string // empty for literal true/false
+	op    string
+	value string
+	re    *regexp.Regexp
+	not   bool
+}
+
+// literal is a quoted string without quotes inside, or an integer
+const literal = `"[^"']*"|'[^"']*'|-?\d+`
+
+var (
+	comparisonRe = regexp.MustCompile(`^endpoint\.(\w+)\s*(==|!=)\s*(` + literal + `)$`)
+	methodRe     = regexp.MustCompile(`^(!?)endpoint\.(\w+)\.(startsWith|endsWith|contains|matches)\(\s*(` + literal + `)\s*\)$`)
+)
+
+var fields = map[string]bool{
+	"id": true, "url": true, "hostname": true, "port": true,
+	"proto": true, "type": true, "metadata": true, "description": true,
+}
+
+// Parse parses a selector expression. It returns an error wrapping
+// ErrUnsupported if the expression can't be evaluated locally.
+func Parse(expr string) (*Selector, error) {
+	s := &Selector{expr: expr}
+
+	parts, err := splitTerms(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrUnsupported, expr, err)
+	}
+
+	for _, part := range parts {
+		t, err := parseTerm(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrUnsupported, expr, err)
+		}
+		s.terms = append(s.terms, t)
+	}
+
+	return s, nil
+}
+
+// splitTerms splits expr on the "&&" operators outside of quoted strings.
+// Anything beyond a plain conjunction, such as "||", or a quoted string
+// with escapes, is rejected; grouping and negation are left to parseTerm,
+// which only accepts whole terms.
+func splitTerms(expr string) ([]string, error) {
+	var parts []string
+	var quote byte
+	start := 0
+
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		if quote != 0 {
+			switch c {
+			case '\\':
+				return nil, fmt.Errorf("escapes in strings are not supported")
+			case quote:
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(expr[i:], "||"):
+			return nil, fmt.Errorf("|| is not supported")
+		case strings.HasPrefix(expr[i:], "&&"):
+			parts = append(parts, expr[start:i])
+			start = i + 2
+			i++
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string")
+	}
+
+	return append(parts, expr[start:]), nil
+}
+
+func parseTerm(part string) (term, error) {
+	switch part {
+	case "true":
+		return term{op: "true"}, nil
+	case "false":
+		return term{op: "false"}, nil
+	}
+
+	if m := methodRe.FindStringSubmatch(part); m != nil {
+		value, err := unquote(m[4])
+		if err != nil {
+			return term{}, err
+		}
+		t := term{field: m[2], op: m[3], value: value, not: m[1] == "!"}
+		if !fields[t.field] {
+			return term{}, fmt.Errorf("unknown field %q", t.field)
+		}
+		if t.op == "matches" {
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return term{}, fmt.Errorf("invalid regex: %w", err)
+			}
+			t.re = re
+		}
+		return t, nil
+	}
+
+	if m := comparisonRe.FindStringSubmatch(part); m != nil {
+		value, err := unquote(m[3])
+		if err != nil {
+			return term{}, err
+		}
+		t := term{field: m[1], op: m[2], value: value}
+		if !fields[t.field] {
+			return term{}, fmt.Errorf("unknown field %q", t.field)
+		}
+		return t, nil
+	}
+
+	return term{}, fmt.Errorf("unrecognized expression %q", part)
+}
+
+// unquote accepts a double/single-quoted string or a bare integer
+func unquote(value string) (string, error) {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1], nil
+	}
+	if _, err := strconv.Atoi(value); err == nil {
+		return value, nil
+	}
+	return "", fmt.Errorf("expected quoted string or integer, got %s", value)
+}
+
+// String returns the original expression
+func (s *Selector) String() string {
+	return s.expr
+}
+
+// Match reports whether the endpoint satisfies every term of the selector
+func (s *Selector) Match(ep ngrokapi.Endpoint) bool {
+	for _, t := range s.terms {
+		if !t.match(ep) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t term) match(ep ngrokapi.Endpoint) bool {
+	switch t.op {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	v := fieldValue(ep, t.field)
+
+	var ok bool
+	switch t.op {
+	case "==":
+		ok = v == t.value
+	case "!=":
+		ok = v != t.value
+	case "startsWith":
+		ok = strings.HasPrefix(v, t.value)
+	case "endsWith":
+		ok = strings.HasSuffix(v, t.value)
+	case "contains":
+		ok = strings.Contains(v, t.value)
+	case "matches":
+		ok = t.re.MatchString(v)
+	}
+
+	if t.not {
+		return !ok
+	}
+	return ok
+}
+
+func fieldValue(ep ngrokapi.Endpoint, field string) string {
+	switch field {
+	case "id":
+		return ep.ID
+	case "url":
+		return ep.URL
+	case "hostname":
+		return ep.Hostname
+	case "port":
+		return strconv.Itoa(ep.Port)
+	case "proto":
+		return ep.Proto
+	case "type":
+		return ep.Type
+	case "metadata":
+		return ep.Metadata
+	case "description":
+		return ep.Description
+	}
+	return ""
+}
+
+// Set is a list of selectors; an endpoint matches the set if it matches any selector
+type Set struct {
+	selectors []*Selector
+	matchAll  bool // set when a selector can only be evaluated server-side
+}
+
+// NewSet parses every expression. Expressions that can't be evaluated
+// locally are returned in unsupported and make the set match everything,
+// deferring to the API's server-side filtering.
+func NewSet(exprs []string) (set *Set, unsupported []string) {
+	set = &Set{}
+	for _, expr := range exprs {
+		s, err := Parse(expr)
+		if err != nil {
+			unsupported = append(unsupported, expr)
+			set.matchAll = true
+			continue
+		}
+		set.selectors = append(set.selectors, s)
+	}
+	return set, unsupported
+}
+
+// Match reports whether the endpoint matches any selector in the set
+func (s *Set) Match(ep ngrokapi.Endpoint) bool {
+	if s == nil || s.matchAll || len(s.selectors) == 0 {
+		return true
+	}
+	for _, sel := range s.selectors {
+		if sel.Match(ep) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the endpoints that match the set
+func (s *Set) Filter(endpoints []ngrokapi.Endpoint) []ngrokapi.Endpoint {
+	result := make([]ngrokapi.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if s.Match(ep) {
+			result = append(result, ep)
+		}
+	}
+	return result
+}
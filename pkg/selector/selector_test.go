@@ -0,0 +1,136 @@
+package selector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ishanjain/ngrok-forward-proxy/pkg/ngrokapi"
+)
+
+func TestParseUnsupported(t *testing.T) {
+	tests := []string{
+		`endpoint.url == "a" || endpoint.url == "b"`,
+		`endpoint.url == "a" ||endpoint.url == "b"`,
+		`(endpoint.url == "a")`,
+		`endpoint.url == "a" && (endpoint.port == 80)`,
+		`!(endpoint.url == "a")`,
+		`! endpoint.url.startsWith("a")`,
+		`!endpoint.url == "a"`,
+		`endpoint.url == "a\"b"`,
+		`endpoint.url == "it's"`,
+		`endpoint.url == 'say "hi"'`,
+		`endpoint.url == "unterminated`,
+		`endpoint.url.matches("^api\\.")`,
+		`endpoint.url == a`,
+		`endpoint.url == "a" "b"`,
+		`endpoint.url.startsWith("a", "b")`,
+		`endpoint.url.startsWith(endpoint.hostname)`,
+		`endpoint.nope == "a"`,
+		`endpoint.url.matches("(")`,
+		`endpoint.metadata.contains("x") && `,
+		`size(endpoint.url) > 3`,
+		``,
+	}
+
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if s, err := Parse(expr); !errors.Is(err, ErrUnsupported) {
+				t.Errorf("Parse(%q) = %v, %v; want ErrUnsupported", expr, s, err)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	ep := ngrokapi.Endpoint{
+		ID:       "ep_123",
+		URL:      "https://api.company.ngrok.app",
+		Hostname: "api.company.ngrok.app",
+		Port:     443,
+		Proto:    "https",
+		Type:     "cloud",
+		Metadata: `{"team":"payments"}`,
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`true`, true},
+		{`false`, false},
+		{`endpoint.url == "https://api.company.ngrok.app"`, true},
+		{`endpoint.url == 'https://api.company.ngrok.app'`, true},
+		{`endpoint.url != "https://api.company.ngrok.app"`, false},
+		{`endpoint.port == 443`, true},
+		{`endpoint.port == "443"`, true},
+		{`endpoint.port == 80`, false},
+		{`endpoint.hostname.endsWith(".ngrok.app")`, true},
+		{`endpoint.hostname.startsWith("web.")`, false},
+		{`!endpoint.hostname.startsWith("web.")`, true},
+		{`endpoint.metadata.contains("payments")`, true},
+		{`endpoint.url.matches("^https://[a-z]+[.]company")`, true},
+		{`endpoint.proto == "https" && endpoint.port == 443`, true},
+		{`endpoint.proto == "https"&&endpoint.port == 80`, false},
+		{`endpoint.id == "ep_123" && true && endpoint.type == "cloud"`, true},
+		{`endpoint.description == ""`, true},
+		{`endpoint.url.contains("&&")`, false},
+		{`endpoint.url.contains("||")`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := s.Match(ep); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSplitsOnlyOutsideQuotes(t *testing.T) {
+	s, err := Parse(`endpoint.metadata == "a && b" && endpoint.port == 80`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.terms) != 2 || s.terms[0].value != "a && b" {
+		t.Fatalf("terms = %+v, want the quoted && kept in the first value", s.terms)
+	}
+	if !s.Match(ngrokapi.Endpoint{Metadata: "a && b", Port: 80}) {
+		t.Error("expected match")
+	}
+}
+
+func TestSet(t *testing.T) {
+	api := ngrokapi.Endpoint{URL: "https://api.company.ngrok.app"}
+	web := ngrokapi.Endpoint{URL: "https://web.company.ngrok.app"}
+	all := []ngrokapi.Endpoint{api, web}
+
+	tests := []struct {
+		name            string
+		exprs           []string
+		wantMatched     int
+		wantUnsupported int
+	}{
+		{"empty matches all", nil, 2, 0},
+		{"one selector", []string{`endpoint.url.startsWith("https://api.")`}, 1, 0},
+		{"any selector matches", []string{`endpoint.url == "https://api.company.ngrok.app"`, `endpoint.url == "https://web.company.ngrok.app"`}, 2, 0},
+		{"none match", []string{`false`}, 0, 0},
+		{"or defers to the API", []string{`endpoint.url == "https://api.company.ngrok.app" || endpoint.url == "x"`}, 2, 1},
+		{"unsupported wins over a supported selector", []string{`false`, `(true)`}, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, unsupported := NewSet(tt.exprs)
+			if len(unsupported) != tt.wantUnsupported {
+				t.Errorf("unsupported = %v, want %d", unsupported, tt.wantUnsupported)
+			}
+			if got := len(set.Filter(all)); got != tt.wantMatched {
+				t.Errorf("Filter kept %d endpoints, want %d", got, tt.wantMatched)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"time"
 
 	"github.com/go-logr/logr"
 )
@@ -15,6 +16,9 @@ type DaemonController interface {
 	GetStatus() StatusResponse
 	ListEndpoints() []EndpointInfo
 	SetAPIKey(key string) error
+	Plan() (PlanResponse, error)
+	HealthEndpoint() HealthEndpoint
+	Connections(endpoint string) ConnectionsResponse
 }
 
 // Command represents a command from the ngrok client
@@ -36,6 +40,45 @@ type StatusResponse struct {
 	OperatorID     string `json:"operator_id,omitempty"`
 	EndpointCount  int    `json:"endpoint_count"`
 	IngressEndpoint string `json:"ingress_endpoint"`
+	ConfiguredIngress string `json:"configured_ingress,omitempty"` // ingressEndpoint from the config file
+	RegisteredIngress string `json:"registered_ingress,omitempty"` // Ingress named by the operator binding
+	IngressMismatch   bool   `json:"ingress_mismatch,omitempty"`   // Configured and registered ingress differ
+	IngressTLSVerify  string `json:"ingress_tls_verify,omitempty"` // "strict", "ca" or "insecure"
+	IngressPins       int    `json:"ingress_pins,omitempty"`       // Number of SPKI pins checked
+	Ingresses       []IngressStatus `json:"ingresses,omitempty"`
+	API             *APIStatus `json:"api,omitempty"`
+	CertExpiry      time.Time  `json:"cert_expiry,omitempty"`
+}
+
+// IngressStatus reports the health of one ingress endpoint
+type IngressStatus struct {
+	Address   string    `json:"address"`
+	Healthy   bool      `json:"healthy"`
+	Probed    bool      `json:"probed"`
+	Preferred bool      `json:"preferred"`                 // Dialed first for new connections
+	Latency   string    `json:"latency,omitempty"`         // Last successful handshake time
+	LastProbe time.Time `json:"last_probe,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// APIStatus reports ngrok API health as seen by the polling loop
+type APIStatus struct {
+	Healthy             bool       `json:"healthy"`
+	Circuit             string     `json:"circuit"` // "closed", "open" or "half-open"
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorCode       string     `json:"last_error_code,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"` // Nil until a poll succeeds
+	PollInterval        string     `json:"poll_interval"`          // Current effective poll interval
+	NextPoll            *time.Time `json:"next_poll,omitempty"`    // Set while the circuit is open
+}
+
+// HealthEndpoint tells clients where the health server listens
+type HealthEndpoint struct {
+	Enabled      bool   `json:"enabled"`
+	URL          string `json:"url,omitempty"`         // e.g. "http://127.0.0.1:8081"
+	AuthRequired bool   `json:"auth_required"`         // A bearer token is required on /status and /metrics
+	Certificate  string `json:"certificate,omitempty"` // PEM server certificate when serving HTTPS
 }
 
 // EndpointInfo contains bound endpoint information
@@ -45,9 +88,86 @@ type EndpointInfo struct {
 	IP              string `json:"ip"`
 	Port            int    `json:"port"`
 	URL             string `json:"url"`
+	Proto           string `json:"proto,omitempty"`
 	LocalListener   bool   `json:"local_listener"`    // True if listener is active
 	NetworkPort     int    `json:"network_port"`      // Network port if not virtual
 	ListenInterface string `json:"listen_interface"`  // "virtual", "0.0.0.0", or specific IP
+	Degraded        bool   `json:"degraded"`          // True if recent connections fail to be upgraded
+	Errors          int64  `json:"errors"`
+	LastErrorClass  string `json:"last_error_class,omitempty"`
+	LastErrorCode   string `json:"last_error_code,omitempty"`
+	LastError       string `json:"last_error,omitempty"`
+	Probe           *ProbeInfo `json:"probe,omitempty"` // Latest synthetic probe, if the prober is enabled
+}
+
+// ProbeInfo is the outcome of the latest synthetic probe of an endpoint
+type ProbeInfo struct {
+	OK                  bool      `json:"ok"`
+	Time                time.Time `json:"time"`
+	Latency             string    `json:"latency"`
+	StatusCode          int       `json:"status_code,omitempty"` // HTTP probes only
+	ErrorClass          string    `json:"error_class,omitempty"`
+	ErrorCode           string    `json:"error_code,omitempty"`
+	Error               string    `json:"error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// ConnectionsResponse reports forwarded traffic per endpoint and the most
+// recently finished connections
+type ConnectionsResponse struct {
+	Endpoints []EndpointTraffic `json:"endpoints"`
+	Recent    []ConnectionInfo  `json:"recent"` // Newest first
+}
+
+// EndpointTraffic totals an endpoint's traffic since its listener started
+type EndpointTraffic struct {
+	ID                string  `json:"id"`
+	URL               string  `json:"url"`
+	Active            int64   `json:"active"` // Connections currently open
+	Connections       int64   `json:"connections"`
+	BytesIn           int64   `json:"bytes_in"`
+	BytesOut          int64   `json:"bytes_out"`
+	ConnectionSeconds float64 `json:"connection_seconds"` // Summed duration of finished connections
+}
+
+// ConnectionInfo describes a finished forwarded connection
+type ConnectionInfo struct {
+	EndpointID  string    `json:"endpoint_id"`
+	URL         string    `json:"url"`
+	ClientAddr  string    `json:"client_addr"`
+	Start       time.Time `json:"start"`
+	Duration    string    `json:"duration"`
+	BytesIn     int64     `json:"bytes_in"`
+	BytesOut    int64     `json:"bytes_out"`
+	CloseReason string    `json:"close_reason"` // "closed", "idle_timeout", "max_lifetime" or a failure class
+}
+
+// PlanResponse lists the changes the next reconciliation would make
+type PlanResponse struct {
+	Changes   []PlannedChange `json:"changes"`
+	Unchanged int             `json:"unchanged"`
+}
+
+// PlannedChange is a single planned add, update or remove
+type PlannedChange struct {
+	Action        string        `json:"action"` // "add", "update" or "remove"
+	EndpointID    string        `json:"endpoint_id"`
+	URL           string        `json:"url"`
+	Hostname      string        `json:"hostname"`
+	IP            string        `json:"ip,omitempty"`
+	Port          int           `json:"port"`
+	ListenAddress string        `json:"listen_address,omitempty"`
+	ListenPort    int           `json:"listen_port,omitempty"`
+	Mode          string        `json:"mode"` // "virtual" or "network"
+	Changes       []FieldChange `json:"changes,omitempty"` // Updates only
+	Error         string        `json:"error,omitempty"`   // Set if the change can't be applied
+}
+
+// FieldChange describes one field an update changes
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
 }
 
 // Server handles unix socket communication
@@ -142,6 +262,24 @@ func (s *Server) executeCommand(cmd Command) Response {
 		}
 		return Response{Success: true, Data: "API key set successfully"}
 		
+	case "health-endpoint":
+		return Response{Success: true, Data: s.daemon.HealthEndpoint()}
+		
+	case "connections":
+		// Optional filter: endpoint ID or URL
+		var endpoint string
+		if len(cmd.Args) > 0 {
+			endpoint = cmd.Args[0]
+		}
+		return Response{Success: true, Data: s.daemon.Connections(endpoint)}
+		
+	case "plan":
+		plan, err := s.daemon.Plan()
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		return Response{Success: true, Data: plan}
+		
 	default:
 		return Response{Success: false, Error: fmt.Sprintf("unknown command: %s", cmd.Command)}
 	}